@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+// detectorResult sums up what one detector found on all trajectories
+type detectorResult struct {
+	detector  algorithms.StayPointDetector
+	stays     int
+	covered   time.Duration // Total duration of the stays
+	overlap   time.Duration // Part of covered also inside a stay of the sequential detector
+	withStays int           // Trajectories with at least one stay
+	elapsed   time.Duration
+}
+
+// Runs every stay point detector with the same thresholds on the same stored trajectories
+// and reports how many stays each finds and how much time they cover.
+func main() {
+	usersFlag := flag.String("users", "", "comma-separated user IDs whose trajectories are compared")
+	trajectoriesFlag := flag.String("trajectories", "", "comma-separated trajectory IDs to compare")
+	limit := flag.Int("limit", 500, "maximum number of trajectories, 0 for all")
+	distance := flag.Float64("distance", algorithms.DefaultStayDistanceThreshold, "distance threshold in meters")
+	duration := flag.Duration("time", algorithms.DefaultStayTimeThreshold, "time threshold")
+	flag.Parse()
+
+	userIDs, err := parseIDs(*usersFlag)
+	if err != nil {
+		log.Fatalf("invalid -users: %v", err)
+	}
+	trajectoryIDs, err := parseIDs(*trajectoriesFlag)
+	if err != nil {
+		log.Fatalf("invalid -trajectories: %v", err)
+	}
+	if *distance <= 0 || *duration <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	results := make([]*detectorResult, len(algorithms.StayPointAlgorithms))
+	for i, name := range algorithms.StayPointAlgorithms {
+		detector, err := algorithms.NewStayPointDetector(algorithms.StayPointParams{
+			Algorithm:         name,
+			DistanceThreshold: *distance,
+			TimeThreshold:     *duration,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		results[i] = &detectorResult{detector: detector}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := db.Load(cfg)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	query := db.Model(&models.Trajectory{}).Select("id", "points")
+	switch {
+	case len(userIDs) > 0 && len(trajectoryIDs) > 0:
+		query = query.Where("user_id IN ? OR id IN ?", userIDs, trajectoryIDs)
+	case len(userIDs) > 0:
+		query = query.Where("user_id IN ?", userIDs)
+	case len(trajectoryIDs) > 0:
+		query = query.Where("id IN ?", trajectoryIDs)
+	}
+	if *limit > 0 {
+		query = query.Limit(*limit)
+	}
+
+	compared, points := 0, 0
+	var batch []models.Trajectory
+	result := query.Order("id ASC").FindInBatches(&batch, 100, func(_ *gorm.DB, _ int) error {
+		for _, trajectory := range batch {
+			var gpsPoints []models.GPSPoint
+			if err := json.Unmarshal([]byte(trajectory.Points), &gpsPoints); err != nil {
+				log.Printf("skipping trajectory %d: %v", trajectory.ID, err)
+				continue
+			}
+			compared++
+			points += len(gpsPoints)
+
+			// The sequential detector comes first and is the baseline of the overlap
+			var baseline []models.StayPoint
+			for i, r := range results {
+				start := time.Now()
+				stayPoints := r.detector.Detect(gpsPoints)
+				r.elapsed += time.Since(start)
+
+				if i == 0 {
+					baseline = stayPoints
+				}
+				r.stays += len(stayPoints)
+				r.overlap += overlap(stayPoints, baseline)
+				for _, stay := range stayPoints {
+					r.covered += stay.DepartureTime.Sub(stay.ArrivalTime)
+				}
+				if len(stayPoints) > 0 {
+					r.withStays++
+				}
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		log.Fatalf("failed to load trajectories: %v", result.Error)
+	}
+	if compared == 0 {
+		log.Fatal("no trajectories found")
+	}
+
+	fmt.Printf("%d trajectories, %d points, thresholds %.0f m / %s\n", compared, points, *distance, *duration)
+	fmt.Printf("%-12s %8s %12s %12s %10s %12s %10s\n", "detector", "stays", "with stays", "covered", "mean stay", "overlap", "time")
+	for _, r := range results {
+		mean := time.Duration(0)
+		if r.stays > 0 {
+			mean = r.covered / time.Duration(r.stays)
+		}
+		share := 0.0
+		if r.covered > 0 {
+			share = 100 * r.overlap.Seconds() / r.covered.Seconds()
+		}
+		fmt.Printf("%-12s %8d %12d %11.1fh %10s %11.1f%% %10s\n",
+			r.detector.Name(), r.stays, r.withStays, r.covered.Hours(),
+			mean.Round(time.Second), share, r.elapsed.Round(time.Millisecond))
+	}
+	fmt.Println("overlap: share of the covered time also covered by the sequential detector")
+}
+
+// overlap returns how long the stays of a and b, each in chronological order without
+// overlapping one another, cover the same time
+func overlap(a, b []models.StayPoint) time.Duration {
+	var total time.Duration
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start := a[i].ArrivalTime
+		if b[j].ArrivalTime.After(start) {
+			start = b[j].ArrivalTime
+		}
+		end := a[i].DepartureTime
+		if b[j].DepartureTime.Before(end) {
+			end = b[j].DepartureTime
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+
+		if a[i].DepartureTime.Before(b[j].DepartureTime) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return total
+}
+
+func parseIDs(value string) ([]uint, error) {
+	var ids []uint
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
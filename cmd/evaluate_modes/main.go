@@ -0,0 +1,173 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// Evaluates the transportation mode classifier against the GeoLife labels imported by
+// cmd/load_dataset and prints a confusion matrix.
+func main() {
+	usersFlag := flag.String("users", "", "comma-separated user IDs to evaluate (default: all labelled users)")
+	segmentation := flag.String("segmentation", "auto", "\"auto\" scores every labelled point with the full pipeline, \"labels\" classifies each labelled segment as a whole")
+	flag.Parse()
+
+	if *segmentation != "auto" && *segmentation != "labels" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := db.Load(cfg)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	trajectorySvc := services.NewTrajectoryServices(db)
+	segmentSvc := services.NewTrajectorySegmentServices(db)
+
+	userIDs, err := parseUserIDs(*usersFlag)
+	if err != nil {
+		log.Fatalf("invalid -users: %v", err)
+	}
+	if len(userIDs) == 0 {
+		userIDs, err = segmentSvc.GetLabelledUserIDs()
+		if err != nil {
+			log.Fatalf("failed to get labelled users: %v", err)
+		}
+	}
+	if len(userIDs) == 0 {
+		log.Fatal("no labelled users found, load the GeoLife dataset with labels.txt files first")
+	}
+
+	params := algorithms.DefaultModeClassifierParams()
+	matrix := algorithms.NewModeConfusionMatrix(algorithms.ClassifierModes)
+	skipped := 0
+
+	for _, userID := range userIDs {
+		labels, err := segmentSvc.GetByUserID(userID, models.SourceLabel)
+		if err != nil {
+			log.Printf("failed to get labels of user %d: %v", userID, err)
+			continue
+		}
+
+		// Labels are ordered by trajectory, so each trajectory is loaded once
+		for start := 0; start < len(labels); {
+			end := start
+			for end < len(labels) && labels[end].TrajectoryID == labels[start].TrajectoryID {
+				end++
+			}
+
+			points, err := trajectorySvc.GetGPSPoints(labels[start].TrajectoryID)
+			if err != nil {
+				log.Printf("failed to get points of trajectory %d: %v", labels[start].TrajectoryID, err)
+				start = end
+				continue
+			}
+
+			if *segmentation == "labels" {
+				skipped += evaluateSegments(matrix, points, labels[start:end], params)
+			} else {
+				skipped += evaluatePoints(matrix, points, labels[start:end], params)
+			}
+			start = end
+		}
+	}
+
+	fmt.Printf("Users: %d  Segmentation: %s  Unit: %s\n\n", len(userIDs), *segmentation, unit(*segmentation))
+	if err := matrix.Write(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Skipped labels without a comparable mode: %d\n", skipped)
+}
+
+// evaluateSegments classifies the points of each label as a single segment
+func evaluateSegments(matrix *algorithms.ModeConfusionMatrix, points []models.GPSPoint, labels []models.TrajectorySegment, params algorithms.ModeClassifierParams) int {
+	skipped := 0
+	for _, label := range labels {
+		truth, ok := algorithms.EvaluationMode(label.Mode)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		var segmentPoints []models.GPSPoint
+		for _, p := range points {
+			if !p.Timestamp.Before(label.StartTime) && !p.Timestamp.After(label.EndTime) {
+				segmentPoints = append(segmentPoints, p)
+			}
+		}
+		if len(segmentPoints) < 2 {
+			continue
+		}
+
+		features := algorithms.ModeFeaturesOf(segmentPoints, params)
+		matrix.Add(truth, algorithms.ClassifyModeFeatures(features, params), 1)
+	}
+	return skipped
+}
+
+// evaluatePoints runs segmentation and classification on the whole trajectory and
+// compares the predicted mode of every labelled point
+func evaluatePoints(matrix *algorithms.ModeConfusionMatrix, points []models.GPSPoint, labels []models.TrajectorySegment, params algorithms.ModeClassifierParams) int {
+	predicted := make([]models.TransportMode, len(points))
+	for _, segment := range algorithms.ClassifyTransportModes(points, params) {
+		for i := segment.StartIndex; i <= segment.EndIndex; i++ {
+			predicted[i] = segment.Mode
+		}
+	}
+
+	skipped := 0
+	for _, label := range labels {
+		truth, ok := algorithms.EvaluationMode(label.Mode)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		for i, p := range points {
+			if p.Timestamp.Before(label.StartTime) || p.Timestamp.After(label.EndTime) || predicted[i] == "" {
+				continue
+			}
+			matrix.Add(truth, predicted[i], 1)
+		}
+	}
+	return skipped
+}
+
+func parseUserIDs(value string) ([]uint, error) {
+	var userIDs []uint
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, uint(id))
+	}
+	return userIDs, nil
+}
+
+func unit(segmentation string) string {
+	if segmentation == "labels" {
+		return "segments"
+	}
+	return "points"
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/formats"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+func main() {
+	username := flag.String("user", "", "username of the account to import into")
+	path := flag.String("path", "", "Takeout archive (.zip), extracted Takeout directory, or a single location history .json file")
+	filter := flag.Bool("filter", true, "drop duplicate timestamps and speed outliers before storing")
+	median := flag.Int("median", 0, "odd median filter window in points, 0 to disable")
+	kalman := flag.Bool("kalman", false, "smooth positions with a Kalman smoother")
+	split := flag.Bool("split", false, "store one trajectory per trip instead of one per day")
+	flag.Parse()
+
+	if *username == "" || *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := db.Load(cfg)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	userSvc := services.NewUserServices(db)
+	importSvc := services.NewImportServices(
+		services.NewTrajectoryServices(db),
+		services.NewStayPointServices(db),
+		services.NewLocationServices(db.DB),
+		services.NewTrajectorySegmentServices(db),
+	)
+
+	user, err := userSvc.GetByUserName(*username)
+	if err != nil {
+		log.Fatalf("failed to find user %s: %v", *username, err)
+	}
+
+	data, err := readTakeout(*path)
+	if err != nil {
+		log.Fatalf("failed to read Takeout data: %v", err)
+	}
+	fmt.Printf("Read %d location records and %d place visits\n", len(data.Points), len(data.Visits))
+
+	opts := services.DefaultImportOptions()
+	if !*filter {
+		opts.NoiseFilter = algorithms.NoiseFilterParams{}
+	}
+	opts.NoiseFilter.MedianWindow = *median
+	opts.NoiseFilter.Kalman = *kalman
+	opts.SplitTrips = *split
+
+	result := importSvc.ImportTakeout(user.ID, data, opts)
+
+	imported, existing, dropped, adjusted := 0, 0, 0, 0
+	for _, r := range result.Trajectories {
+		if r.NoiseFilter != nil {
+			dropped += r.NoiseFilter.Dropped
+			adjusted += r.NoiseFilter.Adjusted
+		}
+		existing += r.Skipped
+		if r.Error != "" {
+			fmt.Printf("Skipped %s: %s\n", r.Track, r.Error)
+			continue
+		}
+		if r.TrajectoryID != 0 {
+			imported++
+		}
+	}
+	fmt.Printf("Noise filter dropped %d and adjusted %d points\n", dropped, adjusted)
+	fmt.Printf("Imported %d daily trajectories, %d stay points, %d new locations (%d visits failed)\n",
+		imported, result.StayPoints, result.Locations, result.FailedVisits)
+	if existing > 0 || result.SkippedVisits > 0 {
+		fmt.Printf("Already imported: %d trajectories, %d visits\n", existing, result.SkippedVisits)
+	}
+	if result.VisitsWarning != "" {
+		fmt.Printf("Last visit error: %s\n", result.VisitsWarning)
+	}
+}
+
+// readTakeout reads location history from an archive, a directory or a single JSON file
+func readTakeout(path string) (*formats.TakeoutData, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		if strings.ToLower(filepath.Ext(path)) == ".zip" {
+			return formats.ParseTakeoutZip(file, info.Size())
+		}
+
+		data := &formats.TakeoutData{}
+		return data, formats.ParseTakeoutJSON(file, data)
+	}
+
+	data := &formats.TakeoutData{}
+	err = filepath.WalkDir(path, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(path, filePath)
+		if err != nil || !formats.IsTakeoutFile(filepath.ToSlash(rel)) {
+			return err
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := formats.ParseTakeoutJSON(file, data); err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		return nil
+	})
+
+	return data, err
+}
@@ -1,15 +1,57 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/db"
 	"github.com/th1enq/go-map/internal/handlers"
+	"github.com/th1enq/go-map/internal/models"
 	"github.com/th1enq/go-map/internal/services"
+	"gorm.io/gorm/logger"
 )
 
 func main() {
+	dataDir := flag.String("path", "dataset/Geolife Trajectories 1.3", "root of the GeoLife dataset (the directory containing Data)")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of files imported concurrently")
+	batchSize := flag.Int("batch", 50, "files stored per bulk insert transaction")
+	users := flag.String("users", "", "comma-separated user folders or ranges to load, e.g. 000,010-020 (default: all users)")
+	progress := flag.Duration("progress", 5*time.Second, "interval between progress reports, 0 to disable")
+	filter := flag.Bool("filter", true, "drop duplicate timestamps and speed outliers before detecting stay points")
+	maxSpeed := flag.Float64("max-speed", algorithms.DefaultNoiseFilterParams().MaxSpeed, "speed in m/s above which isolated points are dropped as outliers")
+	median := flag.Int("median", 0, "odd median filter window in points, 0 to disable")
+	kalman := flag.Bool("kalman", false, "smooth positions with a Kalman smoother")
+	clustering := flag.String("clustering", algorithms.ClusteringDBSCAN, "framework clustering: dbscan with fixed layer scales, or hdbscan with layers from the cluster tree")
+	update := flag.Bool("update", false, "update the active framework with the new stay points instead of building a new one (dbscan only)")
+	activate := flag.Bool("activate", true, "make the newly built framework the active one")
+	flag.Parse()
+
+	clusteringParams := algorithms.DefaultHierarchicalClusteringParams()
+	switch *clustering {
+	case algorithms.ClusteringDBSCAN:
+	case algorithms.ClusteringHDBSCAN:
+		clusteringParams.Algorithm = algorithms.ClusteringHDBSCAN
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -clustering: %q\n", *clustering)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	userFolders, err := parseUserFolders(*users)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -users: %v\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
@@ -20,19 +62,122 @@ func main() {
 		log.Fatalf("failed to load database: %v", err)
 	}
 
-	trajectorySvc := services.NewTrajectoryServices(db)
+	// Logging every statement would bury the progress reports
+	db.Config.Logger = logger.Default.LogMode(logger.Warn)
+
 	staypointSvc := services.NewStayPointServices(db)
 	userSvc := services.NewUserServices(db)
 	frameworkSvc := services.NewHierarchicalFrameworkService(db.DB)
-	locationSvc := services.NewLocationServices(db.DB)
+	segmentSvc := services.NewTrajectorySegmentServices(db)
+	importRecordSvc := services.NewImportRecordServices(db)
 
-	dataLoadingHandler := handlers.NewLoadingDataHandler(trajectorySvc, staypointSvc, userSvc)
-	frameworkHandler := handlers.NewHierarchicalFrameworkHandler(frameworkSvc, staypointSvc, locationSvc)
+	dataLoadingHandler := handlers.NewLoadingDataHandler(userSvc, staypointSvc, segmentSvc, importRecordSvc)
+	frameworkHandler := handlers.NewHierarchicalFrameworkHandler(frameworkSvc, staypointSvc)
 	userGraphHandler := handlers.NewUserGraphHandler(frameworkSvc, staypointSvc)
 
-	dataLoadingHandler.LoadGeolifeData("dataset/Geolife Trajectories 1.3")
-	frameworkHandler.BuildFramework()
-	for i := 1; i <= 182; i++ {
-		userGraphHandler.BuildUserGraph(uint(i))
+	noiseFilter := algorithms.NoiseFilterParams{}
+	if *filter {
+		noiseFilter = algorithms.DefaultNoiseFilterParams()
+		noiseFilter.MaxSpeed = *maxSpeed
+	}
+	noiseFilter.MedianWindow = *median
+	noiseFilter.Kalman = *kalman
+
+	summary, err := dataLoadingHandler.LoadGeolifeData(handlers.LoadOptions{
+		DataDir:          *dataDir,
+		Workers:          *workers,
+		BatchSize:        *batchSize,
+		Users:            userFolders,
+		ProgressInterval: *progress,
+		NoiseFilter:      noiseFilter,
+	})
+	if err != nil {
+		log.Fatalf("failed to load dataset: %v", err)
+	}
+
+	log.Printf("Loaded %d files (%d points, %d stay points) in %s, %d already imported, %d failed",
+		summary.Files, summary.Points, summary.StayPoints, summary.Elapsed.Round(time.Second), summary.Skipped, summary.Failed)
+	log.Printf("Noise filter dropped %d and adjusted %d points", summary.Dropped, summary.Adjusted)
+	if summary.Failed > 0 {
+		log.Printf("Run the loader again to retry the failed files")
+	}
+
+	var framework *models.HierarchicalFramework
+	if *update {
+		frameworkHandler.UpdateFramework(clusteringParams)
+		if framework, err = frameworkSvc.GetActiveFramework(); err != nil {
+			log.Fatalf("failed to load the updated framework: %v", err)
+		}
+	} else {
+		framework = frameworkHandler.BuildFramework(clusteringParams)
+		if framework == nil {
+			return
+		}
+		if *activate {
+			if _, err := frameworkSvc.ActivateFramework(framework.ID); err != nil {
+				log.Fatalf("failed to activate framework: %v", err)
+			}
+		}
+	}
+
+	// A new framework is built from all stay points, so every user gets a graph in it. An
+	// updated framework keeps its cluster IDs, so the graphs of users without new stay
+	// points stay valid; users who got some have their graph built again.
+	allUsers, err := userSvc.GetAll()
+	if err != nil {
+		log.Fatalf("failed to load users: %v", err)
+	}
+	changed := make(map[uint]bool, len(summary.Changed))
+	for _, userID := range summary.Changed {
+		changed[userID] = true
+	}
+	for _, user := range allUsers {
+		if *update {
+			if _, err := frameworkSvc.GetUserGraph(user.ID, framework.ID); err == nil {
+				if !changed[user.ID] {
+					continue
+				}
+				if err := frameworkSvc.DeleteUserGraph(user.ID, framework.ID); err != nil {
+					log.Printf("failed to delete the outdated graph of user %d: %v", user.ID, err)
+					continue
+				}
+			}
+		}
+		if err := userGraphHandler.BuildUserGraph(user.ID, framework.ID); err != nil {
+			log.Printf("failed to build graph of user %d: %v", user.ID, err)
+		}
+	}
+}
+
+// parseUserFolders expands a list such as "000,010-012" into GeoLife user folder names
+func parseUserFolders(value string) ([]string, error) {
+	var folders []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		from, to, isRange := strings.Cut(field, "-")
+		if !isRange {
+			folders = append(folders, field)
+			continue
+		}
+
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, err
+		}
+		if end < start {
+			return nil, fmt.Errorf("empty range %s", field)
+		}
+		for i := start; i <= end; i++ {
+			folders = append(folders, fmt.Sprintf("%0*d", len(from), i))
+		}
 	}
+	return folders, nil
 }
@@ -0,0 +1,72 @@
+// Command owntracks_client is a fake OwnTracks app that publishes a simulated walk
+// to the OwnTracks HTTP endpoint, for testing ingestion locally.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/api/owntracks", "OwnTracks endpoint")
+	user := flag.String("user", "", "account email or username for Basic auth")
+	password := flag.String("password", "", "account password or device token for Basic auth")
+	token := flag.String("token", "", "device token sent in the X-Device-Token header")
+	device := flag.String("device", "phone", "device name sent in the X-Limit-D header")
+	count := flag.Int("points", 20, "number of locations to publish")
+	interval := flag.Duration("interval", 10*time.Second, "time between simulated fixes")
+	lat := flag.Float64("lat", 39.9847, "starting latitude")
+	lon := flag.Float64("lon", 116.3184, "starting longitude")
+	flag.Parse()
+
+	start := time.Now().Add(-time.Duration(*count) * *interval)
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for i := 0; i < *count; i++ {
+		// Walk roughly 1.4 m/s to the north-east
+		step := float64(i) * interval.Seconds() * 1.4 / 111320
+		payload := map[string]any{
+			"_type": "location",
+			"lat":   *lat + step,
+			"lon":   *lon + step/math.Cos(*lat*math.Pi/180),
+			"alt":   50,
+			"tst":   start.Add(time.Duration(i) * *interval).Unix(),
+			"tid":   "ft",
+			"acc":   5,
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			log.Fatalf("failed to encode payload: %v", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+		if err != nil {
+			log.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Limit-D", *device)
+		if *token != "" {
+			req.Header.Set("X-Device-Token", *token)
+		}
+		if *user != "" || *password != "" {
+			req.SetBasicAuth(*user, *password)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatalf("failed to publish location %d: %v", i+1, err)
+		}
+		response, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		fmt.Printf("location %d/%d: %s %s\n", i+1, *count, resp.Status, bytes.TrimSpace(response))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// Recomputes the stored statistics of every trajectory, e.g. after upgrading a database
+// whose trajectories were stored before statistics were added.
+func main() {
+	batchSize := flag.Int("batch", 500, "trajectories loaded per batch")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := db.Load(cfg)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	start := time.Now()
+	updated, err := services.NewTrajectoryServices(db).RecomputeStats(*batchSize)
+	if err != nil {
+		log.Fatalf("failed after %d trajectories: %v", updated, err)
+	}
+
+	fmt.Printf("Recomputed the statistics of %d trajectories in %s\n", updated, time.Since(start).Round(time.Millisecond))
+}
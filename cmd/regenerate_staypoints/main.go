@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// Detects the stay points of stored trajectories again, e.g. after changing the stay
+// point detector or thresholds, without reloading the dataset.
+func main() {
+	usersFlag := flag.String("users", "", "comma-separated user IDs whose trajectories are processed")
+	trajectoriesFlag := flag.String("trajectories", "", "comma-separated trajectory IDs to process")
+	algorithm := flag.String("algorithm", "", "stay point detector ("+strings.Join(algorithms.StayPointAlgorithms, ", ")+"), empty uses the configured one")
+	distance := flag.Float64("distance", 0, "distance threshold in meters, 0 uses the configured thresholds")
+	duration := flag.Duration("time", 0, "time threshold, e.g. 20m, 0 uses the configured thresholds")
+	dryRun := flag.Bool("dry-run", false, "only report how the stay point counts would change")
+	flag.Parse()
+
+	userIDs, err := parseIDs(*usersFlag)
+	if err != nil {
+		log.Fatalf("invalid -users: %v", err)
+	}
+	trajectoryIDs, err := parseIDs(*trajectoriesFlag)
+	if err != nil {
+		log.Fatalf("invalid -trajectories: %v", err)
+	}
+	if len(userIDs) == 0 && len(trajectoryIDs) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *algorithm != "" && !algorithms.IsStayPointAlgorithm(*algorithm) {
+		log.Fatalf("unknown -algorithm %q", *algorithm)
+	}
+
+	opts := services.RegenerateOptions{
+		UserIDs:       userIDs,
+		TrajectoryIDs: trajectoryIDs,
+		Algorithm:     *algorithm,
+		DryRun:        *dryRun,
+	}
+	if *distance > 0 || *duration > 0 {
+		if *distance <= 0 || *duration <= 0 {
+			log.Fatal("-distance and -time must be set together")
+		}
+		opts.Params = &algorithms.StayPointParams{DistanceThreshold: *distance, TimeThreshold: *duration}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	db, err := db.Load(cfg)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	start := time.Now()
+	report, err := services.NewStayPointServices(db).Regenerate(opts)
+	if err != nil {
+		log.Fatalf("failed to regenerate stay points: %v", err)
+	}
+
+	fmt.Printf("%-8s %-12s %-22s %12s %8s %8s\n", "user", "algorithm", "thresholds", "trajectories", "before", "after")
+	for _, user := range report.Users {
+		thresholds := fmt.Sprintf("%.0f m / %s", user.DistanceThreshold, time.Duration(user.TimeThreshold)*time.Second)
+		fmt.Printf("%-8d %-12s %-22s %12d %8d %8d\n", user.UserID, user.Algorithm, thresholds, user.Trajectories, user.Before, user.After)
+	}
+	fmt.Printf("%d trajectories: %d stay points before, %d after (%d open sessions skipped) in %s\n",
+		report.Trajectories, report.Before, report.After, report.SkippedOpen, time.Since(start).Round(time.Millisecond))
+	if report.DryRun {
+		fmt.Println("Dry run, nothing was changed")
+	} else {
+		fmt.Println("Rebuild the hierarchical framework to cluster the new stay points")
+	}
+}
+
+func parseIDs(value string) ([]uint, error) {
+	var ids []uint
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
@@ -21,6 +21,7 @@ type Point struct {
 	LeaveTime   time.Time
 	ClusterID   int
 	Visited     bool
+	index       int // Position among the points being clustered
 }
 
 // Cluster represents a group of points
@@ -31,8 +32,23 @@ type Cluster struct {
 
 // dbscan implements the DBSCAN clustering algorithm
 func dbscan(points []Point, params DBSCANParams) []Cluster {
-	var clusters []Cluster
+	return dbscanIndexed(points, newPointIndex(points, params.Epsilon), params)
+}
+
+// newPointIndex indexes points for region queries of about radius km
+func newPointIndex(points []Point, radius float64) *SpatialIndex {
+	index := NewSpatialIndex(radius)
+	for _, point := range points {
+		index.Insert(point.Latitude, point.Longitude)
+	}
+	return index
+}
+
+// dbscanIndexed runs DBSCAN with an index built over the same points, in the same order.
+// The index can be reused by several runs with different parameters.
+func dbscanIndexed(points []Point, index *SpatialIndex, params DBSCANParams) []Cluster {
 	clusterID := 0
+	var neighbors []int
 
 	for i := range points {
 		if points[i].Visited {
@@ -40,77 +56,81 @@ func dbscan(points []Point, params DBSCANParams) []Cluster {
 		}
 
 		points[i].Visited = true
-		neighbors := getNeighbors(points, i, params.Epsilon)
+		neighbors = getNeighbors(index, points, i, params.Epsilon, neighbors[:0])
 
 		if len(neighbors) < params.MinPoints {
 			points[i].ClusterID = -1 // Noise point
 		} else {
 			clusterID++
-			expandCluster(points, neighbors, clusterID, params)
-			cluster := createCluster(points, clusterID)
-			clusters = append(clusters, cluster)
+			points[i].ClusterID = clusterID
+			expandCluster(index, points, neighbors, clusterID, params)
 		}
 	}
 
-	return clusters
+	return createClusters(points, clusterID)
 }
 
-// getNeighbors finds all points within epsilon distance of a given point
-func getNeighbors(points []Point, pointIndex int, epsilon float64) []int {
-	var neighbors []int
+// getNeighbors appends to dst the points within epsilon distance of a given point
+func getNeighbors(index *SpatialIndex, points []Point, pointIndex int, epsilon float64, dst []int) []int {
 	point := points[pointIndex]
-
-	for i := range points {
-		if i == pointIndex {
-			continue
-		}
-
-		distance := Distance(point.Latitude, point.Longitude,
-			points[i].Latitude, points[i].Longitude)
-
-		if distance <= epsilon {
-			neighbors = append(neighbors, i)
+	start := len(dst)
+	dst = index.Within(point.Latitude, point.Longitude, epsilon, dst)
+
+	// The point itself is not its own neighbor
+	for i := start; i < len(dst); i++ {
+		if dst[i] == pointIndex {
+			dst[i] = dst[len(dst)-1]
+			dst = dst[:len(dst)-1]
+			break
 		}
 	}
-
-	return neighbors
+	return dst
 }
 
-// expandCluster expands a cluster by adding density-reachable points
-func expandCluster(points []Point, neighbors []int, clusterID int, params DBSCANParams) {
-	for i := 0; i < len(neighbors); i++ {
-		pointIndex := neighbors[i]
-		if !points[pointIndex].Visited {
-			points[pointIndex].Visited = true
-			newNeighbors := getNeighbors(points, pointIndex, params.Epsilon)
-
-			if len(newNeighbors) >= params.MinPoints {
-				neighbors = append(neighbors, newNeighbors...)
-			}
+// expandCluster expands a cluster by adding density-reachable points. Points are marked
+// visited when queued, so each is queued and queried once.
+func expandCluster(index *SpatialIndex, points []Point, neighbors []int, clusterID int, params DBSCANParams) {
+	var queue []int
+	for _, neighbor := range neighbors {
+		if !points[neighbor].Visited {
+			points[neighbor].Visited = true
+			queue = append(queue, neighbor)
 		}
+	}
 
-		if points[pointIndex].ClusterID == 0 {
-			points[pointIndex].ClusterID = clusterID
+	var newNeighbors []int
+	for i := 0; i < len(queue); i++ {
+		pointIndex := queue[i]
+		points[pointIndex].ClusterID = clusterID
+
+		newNeighbors = getNeighbors(index, points, pointIndex, params.Epsilon, newNeighbors[:0])
+		if len(newNeighbors) >= params.MinPoints {
+			// Visited points already belong to a cluster or are noise
+			for _, neighbor := range newNeighbors {
+				if !points[neighbor].Visited {
+					points[neighbor].Visited = true
+					queue = append(queue, neighbor)
+				}
+			}
 		}
 	}
 }
 
-// createCluster creates a cluster from points with the same cluster ID
-func createCluster(points []Point, clusterID int) Cluster {
-	var clusterPoints []Point
+// createClusters groups the points by cluster ID, in order of the IDs 1 to count
+func createClusters(points []Point, count int) []Cluster {
+	clusters := make([]Cluster, count)
+	for i := range clusters {
+		clusters[i].ID = i + 1
+	}
 	for _, point := range points {
-		if point.ClusterID == clusterID {
-			clusterPoints = append(clusterPoints, point)
+		if point.ClusterID > 0 {
+			clusters[point.ClusterID-1].Points = append(clusters[point.ClusterID-1].Points, point)
 		}
 	}
-
-	return Cluster{
-		ID:     clusterID,
-		Points: clusterPoints,
-	}
+	return clusters
 }
 
-// calculateClusterMetrics calculates the center and radius of a cluster
+// calculateClusterMetrics calculates the center and radius in km of a cluster
 func calculateClusterMetrics(points []Point) (centerLat, centerLng, radius float64, visitCount int) {
 	if len(points) == 0 {
 		return 0, 0, 0, 0
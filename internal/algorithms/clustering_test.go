@@ -0,0 +1,205 @@
+package algorithms
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Beijing, where most GeoLife stay points are
+const benchCenterLat, benchCenterLng = 39.95, 116.35
+
+var benchSizes = []struct {
+	name string
+	n    int
+}{
+	{"10k", 10000},
+	{"100k", 100000},
+	{"1M", 1000000},
+}
+
+// TestHierarchicalFrameworkDistanceUnits builds frameworks over two groups of stay points
+// 3 km apart, each spread over about 100 m. The distances of the parameters are in km, so
+// every layer clusters both groups and none joins them, and radii are in km too.
+func TestHierarchicalFrameworkDistanceUnits(t *testing.T) {
+	var stayPoints []models.StayPoint
+	for group, lat := range []float64{benchCenterLat, benchCenterLat + 3/kmPerDegree} {
+		for i := 0; i < 10; i++ {
+			stayPoints = append(stayPoints, models.StayPoint{
+				ID:        uint(group*10 + i + 1),
+				Latitude:  lat + float64(i)*0.01/kmPerDegree,
+				Longitude: benchCenterLng,
+			})
+		}
+	}
+
+	for _, algorithm := range []string{ClusteringDBSCAN, ClusteringHDBSCAN} {
+		t.Run(algorithm, func(t *testing.T) {
+			params := DefaultHierarchicalClusteringParams()
+			params.Algorithm = algorithm
+
+			framework, err := BuildHierarchicalFramework(stayPoints, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, layer := range framework.Layers {
+				var groups [2]bool
+				for _, cluster := range layer.Clusters {
+					var joined [2]bool
+					for _, sp := range cluster.StayPoints {
+						joined[(sp.ID-1)/10] = true
+					}
+					if joined[0] && joined[1] {
+						t.Fatalf("layer %d has a cluster joining both groups", layer.Level)
+					}
+					if cluster.Radius > 0.1 {
+						t.Errorf("layer %d has a cluster of radius %g, want at most 0.1 km", layer.Level, cluster.Radius)
+					}
+					groups[0], groups[1] = groups[0] || joined[0], groups[1] || joined[1]
+				}
+				if !groups[0] || !groups[1] {
+					t.Errorf("layer %d clusters the groups %v, want both", layer.Level, groups)
+				}
+			}
+		})
+	}
+}
+
+// TestBuildHierarchicalFrameworkInvalidParams checks that parameters DBSCAN cannot build
+// layers with are rejected instead of failing while clustering
+func TestBuildHierarchicalFrameworkInvalidParams(t *testing.T) {
+	stayPoints := benchStayPoints(10)
+
+	tests := []struct {
+		name    string
+		modify  func(*HierarchicalClusteringParams)
+		wantErr bool
+	}{
+		{"defaults", func(p *HierarchicalClusteringParams) {}, false},
+		{"fewer layers than scales", func(p *HierarchicalClusteringParams) { p.MaxLayers = 2 }, false},
+		{"no layers", func(p *HierarchicalClusteringParams) { p.MaxLayers = 0 }, true},
+		{"no layer scales", func(p *HierarchicalClusteringParams) { p.LayerScales = nil }, true},
+		{"fewer scales than layers", func(p *HierarchicalClusteringParams) { p.MaxLayers = 4 }, true},
+		{"zero scale", func(p *HierarchicalClusteringParams) { p.LayerScales = []float64{1, 0, 4} }, true},
+		{"zero epsilon", func(p *HierarchicalClusteringParams) { p.Epsilon = 0 }, true},
+		{"zero min points", func(p *HierarchicalClusteringParams) { p.MinPoints = 0 }, true},
+		{"unknown algorithm", func(p *HierarchicalClusteringParams) { p.Algorithm = "optics" }, true},
+		{"hdbscan without layer limit", func(p *HierarchicalClusteringParams) {
+			p.Algorithm, p.MaxLayers, p.LayerScales = ClusteringHDBSCAN, 0, nil
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := DefaultHierarchicalClusteringParams()
+			tt.modify(&params)
+
+			_, err := BuildHierarchicalFramework(stayPoints, params)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidClusteringParams) {
+				t.Errorf("error = %v, want ErrInvalidClusteringParams", err)
+			}
+		})
+	}
+}
+
+// BenchmarkDBSCAN times DBSCAN with a 100 m radius on synthetic stay points, with the grid
+// index and with a single cell, which measures the distance to every point
+func BenchmarkDBSCAN(b *testing.B) {
+	params := DBSCANParams{Epsilon: 0.1, MinPoints: 3}
+
+	for _, size := range benchSizes {
+		b.Run(size.name+"/index", func(b *testing.B) {
+			benchDBSCAN(b, size.n, params.Epsilon, params)
+		})
+		b.Run(size.name+"/linear", func(b *testing.B) {
+			// n² distances: about 10 s for 10k points, 20 minutes for 100k and a day for 1M
+			if size.n > 10000 {
+				b.Skip("too slow without an index")
+			}
+			benchDBSCAN(b, size.n, 0, params)
+		})
+	}
+}
+
+func benchDBSCAN(b *testing.B, n int, cellSizeKm float64, params DBSCANParams) {
+	points := stayPointsToPoints(benchStayPoints(n))
+	run := make([]Point, len(points))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(run, points)
+		b.StartTimer()
+
+		index := NewSpatialIndex(cellSizeKm)
+		for _, point := range run {
+			index.Insert(point.Latitude, point.Longitude)
+		}
+		dbscanIndexed(run, index, params)
+	}
+}
+
+// BenchmarkHierarchicalFramework times building a whole framework with each clustering
+func BenchmarkHierarchicalFramework(b *testing.B) {
+	for _, algorithm := range []string{ClusteringDBSCAN, ClusteringHDBSCAN} {
+		for _, size := range benchSizes[:2] {
+			params := DefaultHierarchicalClusteringParams()
+			params.Algorithm = algorithm
+
+			b.Run(fmt.Sprintf("%s/%s", algorithm, size.name), func(b *testing.B) {
+				stayPoints := benchStayPoints(size.n)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := BuildHierarchicalFramework(stayPoints, params); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// benchStayPoints returns n stay points around Beijing: most of them gathered around
+// places, the rest spread uniformly. The area grows with n, 50 x 50 km for 100k points, so
+// that every size has the same density.
+func benchStayPoints(n int) []models.StayPoint {
+	r := rand.New(rand.NewSource(1))
+	extent := 0.45 * math.Sqrt(float64(n)/100000) // Degrees of latitude
+	cos := math.Cos(benchCenterLat * math.Pi / 180)
+	uniform := func() (float64, float64) {
+		return benchCenterLat + (r.Float64()-0.5)*extent, benchCenterLng + (r.Float64()-0.5)*extent/cos
+	}
+
+	places := max(n/50, 1)
+	placeLats, placeLngs := make([]float64, places), make([]float64, places)
+	for i := range placeLats {
+		placeLats[i], placeLngs[i] = uniform()
+	}
+
+	// About 100 m of spread around a place
+	spread := 0.1 / kmPerDegree
+	stayPoints := make([]models.StayPoint, n)
+	for i := range stayPoints {
+		var lat, lng float64
+		if r.Float64() < 0.8 {
+			place := r.Intn(places)
+			lat = placeLats[place] + r.NormFloat64()*spread
+			lng = placeLngs[place] + r.NormFloat64()*spread/cos
+		} else {
+			lat, lng = uniform()
+		}
+		stayPoints[i] = models.StayPoint{
+			ID:        uint(i + 1),
+			UserID:    uint(r.Intn(200) + 1),
+			Latitude:  lat,
+			Longitude: lng,
+		}
+	}
+	return stayPoints
+}
@@ -0,0 +1,197 @@
+package algorithms
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// LayerUpdate is how new stay points change the clusters of one framework layer
+type LayerUpdate struct {
+	Assigned map[int][]models.StayPoint // Stay points joining existing clusters, by position in the layer
+	Merges   [][]int                    // Positions of existing clusters joined by new stay points; the first absorbs the others
+	Seeds    [][]models.StayPoint       // Stay points of new clusters
+}
+
+// LayerEpsilon returns the DBSCAN neighborhood radius in km of a framework layer, level 1
+// being the finest. Only frameworks clustered with DBSCAN have one.
+func LayerEpsilon(params HierarchicalClusteringParams, level int) (float64, error) {
+	if params.Algorithm != "" && params.Algorithm != ClusteringDBSCAN {
+		return 0, fmt.Errorf("%s layers have no neighborhood radius", params.Algorithm)
+	}
+	if level < 1 || level > len(params.LayerScales) {
+		return 0, fmt.Errorf("no layer scale for layer %d", level)
+	}
+	return params.Epsilon * params.LayerScales[level-1], nil
+}
+
+// UpdateLayer assigns new stay points to the clusters of a layer the way DBSCAN with the
+// given neighborhood would have. members holds the stay points of each cluster. The new
+// stay points are clustered among themselves first; a stay point reaches a cluster when it
+// lies within epsilon of one of the cluster's stay points. Groups of new stay points join
+// every cluster they reach, merging them when there are several, and seed a new cluster
+// when they reach none. A new stay point in no group joins the nearest cluster it reaches,
+// and stays noise otherwise. The largest of merged clusters absorbs the others.
+func UpdateLayer(clusters []models.Cluster, members [][]models.StayPoint, stayPoints []models.StayPoint, epsilon float64, minPoints int) LayerUpdate {
+	update := LayerUpdate{Assigned: make(map[int][]models.StayPoint)}
+	if len(stayPoints) == 0 {
+		return update
+	}
+
+	points := stayPointsToPoints(stayPoints)
+	groups := dbscan(points, DBSCANParams{Epsilon: epsilon, MinPoints: minPoints})
+
+	// Clusters reached by a stay point, nearest member first
+	index := NewSpatialIndex(epsilon)
+	var owner []int // Cluster of every indexed member
+	sizes := make([]int, len(clusters))
+	for c := range clusters {
+		for _, sp := range members[c] {
+			index.Insert(sp.Latitude, sp.Longitude)
+			owner = append(owner, c)
+		}
+		sizes[c] = len(members[c])
+	}
+	type reach struct {
+		cluster  int
+		distance float64 // To the nearest member
+	}
+	var found []reach
+	nearest := make(map[int]float64)
+	reached := func(sp models.StayPoint) []reach {
+		clear(nearest)
+		index.Visit(sp.Latitude, sp.Longitude, epsilon, func(id int, distance float64) {
+			if d, ok := nearest[owner[id]]; !ok || distance < d {
+				nearest[owner[id]] = distance
+			}
+		})
+		found = found[:0]
+		for c, distance := range nearest {
+			found = append(found, reach{c, distance})
+		}
+		sort.Slice(found, func(a, b int) bool {
+			if found[a].distance != found[b].distance {
+				return found[a].distance < found[b].distance
+			}
+			return found[a].cluster < found[b].cluster
+		})
+		return found
+	}
+
+	// Clusters joined by one group of new stay points are merged
+	parent := make([]int, len(clusters))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(a, b int) {
+		ra, rb := find(a), find(b)
+		if ra == rb {
+			return
+		}
+		// The root is the cluster absorbing the others
+		if sizes[rb] > sizes[ra] || (sizes[rb] == sizes[ra] && rb < ra) {
+			ra, rb = rb, ra
+		}
+		parent[rb] = ra
+	}
+
+	joins := make(map[int][]models.StayPoint) // Stay points by a cluster they join, resolved to the absorbing cluster below
+	for _, group := range groups {
+		first := -1
+		for _, point := range group.Points {
+			for _, r := range reached(stayPoints[point.index]) {
+				if first < 0 {
+					first = r.cluster
+				} else {
+					union(first, r.cluster)
+				}
+			}
+		}
+
+		grouped := make([]models.StayPoint, len(group.Points))
+		for i, point := range group.Points {
+			grouped[i] = stayPoints[point.index]
+		}
+		if first < 0 {
+			update.Seeds = append(update.Seeds, grouped)
+		} else {
+			joins[first] = append(joins[first], grouped...)
+		}
+	}
+	for _, point := range points {
+		if point.ClusterID > 0 {
+			continue
+		}
+		if r := reached(stayPoints[point.index]); len(r) > 0 {
+			joins[r[0].cluster] = append(joins[r[0].cluster], stayPoints[point.index])
+		}
+	}
+
+	for c, joining := range joins {
+		root := find(c)
+		update.Assigned[root] = append(update.Assigned[root], joining...)
+	}
+
+	merged := make(map[int][]int)
+	for c := range clusters {
+		if root := find(c); root != c {
+			merged[root] = append(merged[root], c)
+		}
+	}
+	for root, absorbed := range merged {
+		update.Merges = append(update.Merges, append([]int{root}, absorbed...))
+	}
+	sort.Slice(update.Merges, func(a, b int) bool { return update.Merges[a][0] < update.Merges[b][0] })
+
+	return update
+}
+
+// SplitCluster clusters the stay points of a cluster again with DBSCAN, e.g. after some
+// were deleted, and returns the parts largest first. Stay points in no part are noise; a
+// single part means the cluster still holds together.
+func SplitCluster(stayPoints []models.StayPoint, epsilon float64, minPoints int) [][]models.StayPoint {
+	points := stayPointsToPoints(stayPoints)
+	clusters := dbscan(points, DBSCANParams{Epsilon: epsilon, MinPoints: minPoints})
+
+	parts := make([][]models.StayPoint, 0, len(clusters))
+	for _, cluster := range clusters {
+		part := make([]models.StayPoint, len(cluster.Points))
+		for i, point := range cluster.Points {
+			part[i] = stayPoints[point.index]
+		}
+		parts = append(parts, part)
+	}
+	sort.SliceStable(parts, func(a, b int) bool { return len(parts[a]) > len(parts[b]) })
+	return parts
+}
+
+// ClusterMetrics returns the center, the radius in km and the number of distinct users of
+// the stay points of a cluster
+func ClusterMetrics(stayPoints []models.StayPoint) (centerLat, centerLng, radius float64, visitCount int) {
+	return calculateClusterMetrics(stayPointsToPoints(stayPoints))
+}
+
+// stayPointsToPoints converts stay points to points for clustering
+func stayPointsToPoints(stayPoints []models.StayPoint) []Point {
+	points := make([]Point, len(stayPoints))
+	for j, sp := range stayPoints {
+		points[j] = Point{
+			ID:          sp.ID,
+			UserID:      sp.UserID,
+			Latitude:    sp.Latitude,
+			Longitude:   sp.Longitude,
+			ArrivalTime: sp.ArrivalTime,
+			LeaveTime:   sp.DepartureTime,
+			index:       j,
+		}
+	}
+	return points
+}
@@ -0,0 +1,156 @@
+package algorithms
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// testStayPoints returns stay points with IDs from firstID at the given meters east of
+// benchCenterLat, benchCenterLng
+func testStayPoints(firstID uint, east ...float64) []models.StayPoint {
+	stayPoints := make([]models.StayPoint, len(east))
+	for i, x := range east {
+		p := testTrack([3]float64{x, 0, 0})[0]
+		stayPoints[i] = models.StayPoint{ID: firstID + uint(i), Latitude: p.Latitude, Longitude: p.Longitude}
+	}
+	return stayPoints
+}
+
+// stayPointIDs returns the IDs of stay points in ascending order
+func stayPointIDs(stayPoints []models.StayPoint) []uint {
+	ids := make([]uint, len(stayPoints))
+	for i, sp := range stayPoints {
+		ids[i] = sp.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// TestUpdateLayer checks how new stay points join, merge and seed the clusters of a layer
+// clustered with a 100 m neighborhood
+func TestUpdateLayer(t *testing.T) {
+	members := [][]models.StayPoint{
+		testStayPoints(1, 0, 30),
+		testStayPoints(11, 1000, 1030, 1060),
+		testStayPoints(21, 5000, 5030),
+	}
+	clusters := make([]models.Cluster, len(members))
+
+	// New stay points 70 m apart from cluster 0 to cluster 1
+	var chain []float64
+	for x := 100.0; x < 1000; x += 70 {
+		chain = append(chain, x)
+	}
+
+	tests := []struct {
+		name     string
+		east     []float64 // Meters east of the new stay points, with IDs from 100
+		assigned map[int][]uint
+		merges   [][]int
+		seeds    [][]uint
+	}{
+		{
+			name: "no new stay points",
+		},
+		{
+			name:     "group joins a cluster",
+			east:     []float64{80, 110},
+			assigned: map[int][]uint{0: {100, 101}},
+		},
+		{
+			name:     "noise joins the nearest cluster",
+			east:     []float64{960},
+			assigned: map[int][]uint{1: {100}},
+		},
+		{
+			name: "noise out of reach",
+			east: []float64{3000},
+		},
+		{
+			name:  "group seeds a cluster",
+			east:  []float64{3000, 3050},
+			seeds: [][]uint{{100, 101}},
+		},
+		{
+			name:     "group merges clusters into the largest",
+			east:     chain,
+			assigned: map[int][]uint{1: stayPointIDs(testStayPoints(100, chain...))},
+			merges:   [][]int{{1, 0}},
+		},
+		{
+			name:     "groups join and seed",
+			east:     []float64{4900, 4930, 3000, 3050, 3500},
+			assigned: map[int][]uint{2: {100, 101}},
+			seeds:    [][]uint{{102, 103}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update := UpdateLayer(clusters, members, testStayPoints(100, tt.east...), 0.1, 1)
+
+			if len(update.Assigned) != len(tt.assigned) {
+				t.Errorf("assigned to %d clusters, want %d", len(update.Assigned), len(tt.assigned))
+			}
+			for c, want := range tt.assigned {
+				if got := stayPointIDs(update.Assigned[c]); !slices.Equal(got, want) {
+					t.Errorf("assigned %v to cluster %d, want %v", got, c, want)
+				}
+			}
+
+			if fmt.Sprint(update.Merges) != fmt.Sprint(tt.merges) {
+				t.Errorf("merges = %v, want %v", update.Merges, tt.merges)
+			}
+
+			if len(update.Seeds) != len(tt.seeds) {
+				t.Fatalf("seeded %d clusters, want %d", len(update.Seeds), len(tt.seeds))
+			}
+			for i, want := range tt.seeds {
+				if got := stayPointIDs(update.Seeds[i]); !slices.Equal(got, want) {
+					t.Errorf("seed %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestSplitCluster checks the parts a cluster falls into with a 100 m neighborhood
+func TestSplitCluster(t *testing.T) {
+	tests := []struct {
+		name  string
+		east  []float64
+		parts [][]uint // Largest first
+	}{
+		{
+			name:  "holds together",
+			east:  []float64{0, 30, 60, 90},
+			parts: [][]uint{{1, 2, 3, 4}},
+		},
+		{
+			name:  "split after the stay points between were removed",
+			east:  []float64{500, 530, 0, 30, 60, 2000},
+			parts: [][]uint{{3, 4, 5}, {1, 2}},
+		},
+		{
+			name: "only noise left",
+			east: []float64{0, 500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := SplitCluster(testStayPoints(1, tt.east...), 0.1, 1)
+			if len(parts) != len(tt.parts) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.parts))
+			}
+			for i, want := range tt.parts {
+				if got := stayPointIDs(parts[i]); !slices.Equal(got, want) {
+					t.Errorf("part %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package algorithms
+
+import (
+	"math"
+	"sort"
+)
+
+// The minimum spanning tree of HDBSCAN is computed on links from each stay point to its
+// hdbscanNeighbors nearest stay points and to the nearest one in each of hdbscanSectors
+// directions found by the neighbor search, instead of on all pairs, so the tree is an
+// approximation. The search stops once a stay point has enough neighbors to form a
+// cluster, and then its empty directions are not searched further: a stay point in a
+// dense group can miss the link to a sparser group nearby, which may then be left apart
+// or joined at a longer link than a full search would find.
+const (
+	hdbscanNeighbors = 10
+	hdbscanSectors   = 8
+)
+
+// DefaultMaxLinkDistance is the distance in km beyond which HDBSCAN never links two stay
+// points, so that the neighbor search stays local
+const DefaultMaxLinkDistance = 1.0
+
+// condensedCluster is a cluster of the condensed HDBSCAN tree
+type condensedCluster struct {
+	parent   int   // -1 for the top cluster of a group of linked stay points
+	children []int // Clusters it splits into
+	points   []int // Points that leave it as noise rather than through a child
+}
+
+// hdbscanLayers clusters the points with HDBSCAN and cuts the condensed cluster tree into
+// layers: layer k holds the largest clusters at most k levels above the leaves of the
+// tree, so layer 1 holds the leaves and every layer partitions the clustered points more
+// coarsely than the one below. Cutting stops once a layer holds only top clusters.
+func hdbscanLayers(points []Point, params HierarchicalClusteringParams) [][]Cluster {
+	minClusterSize := params.MinClusterSize
+	if minClusterSize <= 0 {
+		minClusterSize = params.MinPoints
+	}
+	maxDistance := params.MaxLinkDistance
+	if maxDistance <= 0 {
+		maxDistance = DefaultMaxLinkDistance
+	}
+
+	index := newPointIndex(points, maxDistance/4)
+	clusters := condensedTree(points, index, max(params.MinPoints, 1), max(minClusterSize, 2), maxDistance)
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	// Height of a cluster above the leaves; children are created after their parent
+	height := make([]int, len(clusters))
+	for c := len(clusters) - 1; c >= 0; c-- {
+		height[c] = max(height[c], 1)
+		if parent := clusters[c].parent; parent >= 0 {
+			height[parent] = max(height[parent], height[c]+1)
+		}
+	}
+
+	var layers [][]Cluster
+	for level := 1; params.MaxLayers <= 0 || level <= params.MaxLayers; level++ {
+		var layer []Cluster
+		onlyTops := true
+		for c, cluster := range clusters {
+			if height[c] > level || (cluster.parent >= 0 && height[cluster.parent] <= level) {
+				continue
+			}
+			if cluster.parent >= 0 {
+				onlyTops = false
+			}
+			layer = append(layer, Cluster{ID: c + 1, Points: clusterPoints(clusters, c, points, nil)})
+		}
+		layers = append(layers, layer)
+		if onlyTops {
+			break
+		}
+	}
+	return layers
+}
+
+// clusterPoints appends to dst the points of a cluster and of all its descendants
+func clusterPoints(clusters []condensedCluster, c int, points []Point, dst []Point) []Point {
+	for _, i := range clusters[c].points {
+		dst = append(dst, points[i])
+	}
+	for _, child := range clusters[c].children {
+		dst = clusterPoints(clusters, child, points, dst)
+	}
+	return dst
+}
+
+// condensedTree builds the single linkage tree of the points under the mutual reachability
+// distance and condenses it: a split where both sides have at least minClusterSize points
+// creates two child clusters, while smaller sides leave the cluster as noise. Points with
+// fewer than minPoints neighbors within maxDistance are never linked.
+func condensedTree(points []Point, index *SpatialIndex, minPoints, minClusterSize int, maxDistance float64) []condensedCluster {
+	type neighbor struct {
+		id       int
+		distance float64
+	}
+	type edge struct {
+		a, b   int
+		weight float64
+	}
+
+	// Nearest neighbors and the nearest one in each direction, searching a growing radius
+	// until all are found. The search also stops at enough neighbors to form a cluster,
+	// so that points along a street do not search up to maxDistance for the empty
+	// directions. Neighbors at the same position have no direction.
+	k := max(hdbscanNeighbors, minPoints)
+	enough := max(k, minClusterSize)
+	nearest := make([][]neighbor, len(points))
+	coreDistance := make([]float64, len(points))
+	for i, p := range points {
+		var found []neighbor
+		for radius := maxDistance / 16; ; radius = math.Min(radius*2, maxDistance) {
+			found = found[:0]
+			var sectors [hdbscanSectors]bool
+			covered := 0
+			index.Visit(p.Latitude, p.Longitude, radius, func(id int, distance float64) {
+				if id == i {
+					return
+				}
+				found = append(found, neighbor{id, distance})
+				if distance == 0 {
+					return
+				}
+				if sector := direction(p, points[id]); !sectors[sector] {
+					sectors[sector] = true
+					covered++
+				}
+			})
+			if (len(found) >= k && covered == hdbscanSectors) || len(found) >= enough || radius >= maxDistance {
+				break
+			}
+		}
+		sort.Slice(found, func(a, b int) bool { return found[a].distance < found[b].distance })
+
+		coreDistance[i] = math.Inf(1)
+		if len(found) >= minPoints {
+			coreDistance[i] = found[minPoints-1].distance
+		}
+
+		var sectors [hdbscanSectors]bool
+		links := make([]neighbor, 0, k+hdbscanSectors)
+		for rank, n := range found {
+			if rank < k {
+				links = append(links, n)
+			}
+			if n.distance == 0 {
+				continue
+			}
+			sector := direction(p, points[n.id])
+			if rank >= k && !sectors[sector] {
+				links = append(links, n)
+			}
+			sectors[sector] = true
+		}
+		nearest[i] = links
+	}
+
+	var edges []edge
+	for i, found := range nearest {
+		for _, n := range found {
+			if weight := math.Max(n.distance, math.Max(coreDistance[i], coreDistance[n.id])); !math.IsInf(weight, 1) {
+				edges = append(edges, edge{i, n.id, weight})
+			}
+		}
+	}
+	sort.Slice(edges, func(a, b int) bool { return edges[a].weight < edges[b].weight })
+
+	// Kruskal's algorithm merges the components from the shortest link up. Nodes below
+	// len(points) are the points, the others record a merge of two nodes.
+	type merge struct{ left, right int }
+	var merges []merge
+	size := make([]int, len(points), 2*len(points))
+	for i := range size {
+		size[i] = 1
+	}
+	parent := make([]int, len(points))
+	node := make([]int, len(points)) // Tree node of each component, by root point
+	for i := range parent {
+		parent[i], node[i] = i, i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	hasParent := make([]bool, len(points), 2*len(points))
+	for _, e := range edges {
+		ra, rb := find(e.a), find(e.b)
+		if ra == rb {
+			continue
+		}
+		left, right := node[ra], node[rb]
+		id := len(points) + len(merges)
+		merges = append(merges, merge{left, right})
+		size = append(size, size[left]+size[right])
+		hasParent = append(hasParent, false)
+		hasParent[left], hasParent[right] = true, true
+
+		parent[rb] = ra
+		node[ra] = id
+	}
+
+	// Condense every tree of the forest from its root down
+	var clusters []condensedCluster
+	type task struct{ node, cluster int }
+	var stack []task
+	leaves := func(n int, cluster int) {
+		pending := []int{n}
+		for len(pending) > 0 {
+			n := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if n < len(points) {
+				clusters[cluster].points = append(clusters[cluster].points, n)
+				continue
+			}
+			m := merges[n-len(points)]
+			pending = append(pending, m.left, m.right)
+		}
+	}
+	newCluster := func(parent int) int {
+		clusters = append(clusters, condensedCluster{parent: parent})
+		if parent >= 0 {
+			clusters[parent].children = append(clusters[parent].children, len(clusters)-1)
+		}
+		return len(clusters) - 1
+	}
+
+	for root := range size {
+		if hasParent[root] || size[root] < minClusterSize {
+			continue
+		}
+		stack = append(stack, task{root, newCluster(-1)})
+		for len(stack) > 0 {
+			t := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if t.node < len(points) {
+				clusters[t.cluster].points = append(clusters[t.cluster].points, t.node)
+				continue
+			}
+
+			m := merges[t.node-len(points)]
+			bigLeft, bigRight := size[m.left] >= minClusterSize, size[m.right] >= minClusterSize
+			switch {
+			case bigLeft && bigRight:
+				stack = append(stack, task{m.left, newCluster(t.cluster)})
+				stack = append(stack, task{m.right, newCluster(t.cluster)})
+			case bigLeft:
+				stack = append(stack, task{m.left, t.cluster})
+				leaves(m.right, t.cluster)
+			case bigRight:
+				stack = append(stack, task{m.right, t.cluster})
+				leaves(m.left, t.cluster)
+			default:
+				leaves(m.left, t.cluster)
+				leaves(m.right, t.cluster)
+			}
+		}
+	}
+
+	return clusters
+}
+
+// direction returns the octant of the direction from p to q, from 0 to hdbscanSectors-1
+func direction(p, q Point) int {
+	dx := (q.Longitude - p.Longitude) * math.Cos(p.Latitude*math.Pi/180)
+	dy := q.Latitude - p.Latitude
+
+	sector := 0
+	if dy < 0 {
+		sector, dx, dy = 4, -dx, -dy
+	}
+	if dx <= 0 {
+		sector, dx, dy = sector+2, dy, -dx
+	}
+	if dy > dx {
+		sector++
+	}
+	return sector
+}
@@ -1,37 +1,140 @@
 package algorithms
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/th1enq/go-map/internal/models"
 )
 
+// Clustering algorithms of the hierarchical framework
+const (
+	ClusteringDBSCAN  = "dbscan"  // DBSCAN per layer with the layer's scale of Epsilon
+	ClusteringHDBSCAN = "hdbscan" // Layers cut from the condensed HDBSCAN cluster tree
+)
+
 // HierarchicalClusteringParams holds parameters for the hierarchical clustering algorithm
 type HierarchicalClusteringParams struct {
+	Algorithm   string    // ClusteringDBSCAN (default) or ClusteringHDBSCAN
 	Epsilon     float64   // Maximum distance between points to be considered neighbors
 	MinPoints   int       // Minimum number of points to form a cluster
 	MaxLayers   int       // Maximum number of layers in the hierarchy
 	LayerScales []float64 // Scale factors for each layer (e.g., [1.0, 2.0, 4.0])
+
+	// HDBSCAN only; Epsilon and LayerScales are not used
+	MinClusterSize  int     // Fewest stay points of a cluster, MinPoints when 0
+	MaxLinkDistance float64 // Distance in km beyond which stay points are never linked, DefaultMaxLinkDistance when 0
+}
+
+// ErrInvalidClusteringParams is returned for parameters no framework can be built with
+var ErrInvalidClusteringParams = errors.New("invalid clustering parameters")
+
+// Validate checks that a framework can be built with the parameters. DBSCAN needs a
+// positive Epsilon and a positive scale for each of at least one layer; HDBSCAN cuts as
+// many layers as the cluster tree has when MaxLayers is 0.
+func (p HierarchicalClusteringParams) Validate() error {
+	if p.MinPoints < 1 {
+		return fmt.Errorf("%w: min points must be positive", ErrInvalidClusteringParams)
+	}
+
+	switch p.Algorithm {
+	case "", ClusteringDBSCAN:
+		if p.Epsilon <= 0 {
+			return fmt.Errorf("%w: epsilon must be positive", ErrInvalidClusteringParams)
+		}
+		if p.MaxLayers < 1 {
+			return fmt.Errorf("%w: at least one layer is needed", ErrInvalidClusteringParams)
+		}
+		if len(p.LayerScales) < p.MaxLayers {
+			return fmt.Errorf("%w: %d layer scales for %d layers", ErrInvalidClusteringParams, len(p.LayerScales), p.MaxLayers)
+		}
+		for _, scale := range p.LayerScales[:p.MaxLayers] {
+			if scale <= 0 {
+				return fmt.Errorf("%w: layer scales must be positive", ErrInvalidClusteringParams)
+			}
+		}
+	case ClusteringHDBSCAN:
+		if p.MaxLayers < 0 {
+			return fmt.Errorf("%w: max layers must not be negative", ErrInvalidClusteringParams)
+		}
+	default:
+		return fmt.Errorf("%w: unknown clustering algorithm %q", ErrInvalidClusteringParams, p.Algorithm)
+	}
+	return nil
+}
+
+// DefaultHierarchicalClusteringParams returns the parameters the framework is built with
+// unless others are given
+func DefaultHierarchicalClusteringParams() HierarchicalClusteringParams {
+	return HierarchicalClusteringParams{
+		Algorithm:   ClusteringDBSCAN,
+		Epsilon:     0.1, // 100 meters
+		MinPoints:   2,
+		MaxLayers:   3,
+		LayerScales: []float64{1.0, 2.0, 4.0}, // Each layer has double the scale of the previous
+	}
+}
+
+// FrameworkParams returns the parameters a framework was built with, and false when it
+// did not record them
+func FrameworkParams(framework *models.HierarchicalFramework) (HierarchicalClusteringParams, bool) {
+	if framework.Algorithm == "" {
+		return HierarchicalClusteringParams{}, false
+	}
+	return HierarchicalClusteringParams{
+		Algorithm:       framework.Algorithm,
+		Epsilon:         framework.Epsilon,
+		MinPoints:       framework.MinPoints,
+		MaxLayers:       framework.MaxLayers,
+		LayerScales:     append([]float64(nil), framework.LayerScales...),
+		MinClusterSize:  framework.MinClusterSize,
+		MaxLinkDistance: framework.MaxLinkDistance,
+	}, true
 }
 
 // BuildHierarchicalFramework builds a hierarchical framework F from stay points
 func BuildHierarchicalFramework(stayPoints []models.StayPoint, params HierarchicalClusteringParams) (*models.HierarchicalFramework, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
 	if len(stayPoints) == 0 {
 		return nil, nil
 	}
 
-	// Create the framework
+	// Create the framework, recording how it is built
+	algorithm := params.Algorithm
+	if algorithm == "" {
+		algorithm = ClusteringDBSCAN
+	}
 	framework := &models.HierarchicalFramework{
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+		Algorithm:       algorithm,
+		Epsilon:         params.Epsilon,
+		MinPoints:       params.MinPoints,
+		MaxLayers:       params.MaxLayers,
+		LayerScales:     append([]float64(nil), params.LayerScales...),
+		MinClusterSize:  params.MinClusterSize,
+		MaxLinkDistance: params.MaxLinkDistance,
+		StayPointCount:  len(stayPoints),
 	}
 
-	// Create layers with different scales
-	for i := 0; i < params.MaxLayers; i++ {
-		// Calculate layer-specific parameters
-		layerEpsilon := params.Epsilon * params.LayerScales[i]
-		layerMinPoints := params.MinPoints
+	// Convert stay points to points for clustering
+	points := stayPointsToPoints(stayPoints)
+
+	var layers [][]Cluster
+	switch params.Algorithm {
+	case "", ClusteringDBSCAN:
+		layers = dbscanLayers(points, params)
+	case ClusteringHDBSCAN:
+		layers = hdbscanLayers(points, params)
+	}
 
+	// membership[i][j] is the position of the cluster of stay point j in layer i, -1 for none
+	membership := make([][]int, len(layers))
+	for i, clusters := range layers {
 		// Create a new layer
 		layer := &models.Layer{
 			Level:     i + 1,
@@ -39,43 +142,34 @@ func BuildHierarchicalFramework(stayPoints []models.StayPoint, params Hierarchic
 			UpdatedAt: time.Now(),
 		}
 
-		// Convert stay points to points for clustering
-		points := make([]Point, len(stayPoints))
-		for j, sp := range stayPoints {
-			points[j] = Point{
-				ID:          sp.ID,
-				UserID:      sp.UserID,
-				Latitude:    sp.Latitude,
-				Longitude:   sp.Longitude,
-				ArrivalTime: sp.ArrivalTime,
-				LeaveTime:   sp.DepartureTime,
-			}
+		membership[i] = make([]int, len(stayPoints))
+		for j := range membership[i] {
+			membership[i][j] = -1
 		}
 
-		// Perform DBSCAN clustering for this layer
-		dbscanParams := DBSCANParams{
-			Epsilon:     layerEpsilon,
-			MinPoints:   layerMinPoints,
-			MaxClusters: params.MaxLayers,
-		}
-
-		clusters := dbscan(points, dbscanParams)
-
 		// Convert clusters to database models
 		for _, cluster := range clusters {
 			// Calculate cluster center and radius
 			centerLat, centerLng, radius, visitCount := calculateClusterMetrics(cluster.Points)
 
 			if visitCount > 0 {
+				members := make([]models.StayPoint, len(cluster.Points))
+				for k, point := range cluster.Points {
+					members[k] = stayPoints[point.index]
+					membership[i][point.index] = len(layer.Clusters)
+				}
 
 				// Create cluster in the layer
 				layer.Clusters = append(layer.Clusters, models.Cluster{
-					CenterLat:  centerLat,
-					CenterLng:  centerLng,
-					Radius:     radius,
-					CreatedAt:  time.Now(),
-					UpdatedAt:  time.Now(),
-					VisitCount: visitCount,
+					CenterLat:      centerLat,
+					CenterLng:      centerLng,
+					Radius:         radius,
+					CreatedAt:      time.Now(),
+					UpdatedAt:      time.Now(),
+					VisitCount:     visitCount,
+					StayPointCount: len(members),
+					StayPoints:     members,
+					ParentIndex:    -1,
 				})
 			}
 		}
@@ -83,50 +177,61 @@ func BuildHierarchicalFramework(stayPoints []models.StayPoint, params Hierarchic
 		framework.Layers = append(framework.Layers, *layer)
 	}
 
-	return framework, nil
-}
-
-// GetClustersAtLayer returns clusters at a specific layer in the framework
-func GetClustersAtLayer(framework *models.HierarchicalFramework, layerLevel int) []models.Cluster {
-	for _, layer := range framework.Layers {
-		if layer.Level == layerLevel {
-			return layer.Clusters
+	// The parent of a cluster is the cluster of the next layer holding most of its stay
+	// points. Clusters of both algorithms nest, so that is usually all of them.
+	for i := 0; i+1 < len(framework.Layers); i++ {
+		clusters := framework.Layers[i].Clusters
+		shared := make(map[[2]int]int) // Stay points of a cluster in a cluster of the next layer
+		for j, c := range membership[i] {
+			if parent := membership[i+1][j]; c >= 0 && parent >= 0 {
+				shared[[2]int{c, parent}]++
+			}
 		}
-	}
-	return nil
-}
-
-// GetStayPointsInCluster returns all stay points in a specific cluster
-func GetStayPointsInCluster(cluster models.Cluster, stayPoints []models.StayPoint) []models.StayPoint {
-	var result []models.StayPoint
-	for _, sp := range stayPoints {
-		distance := Distance(cluster.CenterLat, cluster.CenterLng, sp.Latitude, sp.Longitude)
-		if distance <= cluster.Radius {
-			result = append(result, sp)
+		for pair, count := range shared {
+			c, parent := pair[0], pair[1]
+			best := clusters[c].ParentIndex
+			if best < 0 || count > shared[[2]int{c, best}] || (count == shared[[2]int{c, best}] && parent < best) {
+				clusters[c].ParentIndex = parent
+			}
 		}
 	}
-	return result
+
+	return framework, nil
 }
 
-// FindParentCluster finds the parent cluster of a given cluster in the next layer
-func FindParentCluster(cluster models.Cluster, nextLayer []models.Cluster) *models.Cluster {
-	for _, parent := range nextLayer {
-		distance := Distance(cluster.CenterLat, cluster.CenterLng, parent.CenterLat, parent.CenterLng)
-		if distance <= parent.Radius {
-			return &parent
+// dbscanLayers clusters the points once per layer with the layer's scale of Epsilon. The
+// points are indexed once for all layers, with cells the size of the finest neighborhood.
+// The parameters must be valid.
+func dbscanLayers(points []Point, params HierarchicalClusteringParams) [][]Cluster {
+	minScale := params.LayerScales[0]
+	for _, scale := range params.LayerScales[:params.MaxLayers] {
+		minScale = math.Min(minScale, scale)
+	}
+	index := newPointIndex(points, params.Epsilon*minScale)
+
+	layers := make([][]Cluster, params.MaxLayers)
+	for i := range layers {
+		// Every layer clusters all points again
+		for j := range points {
+			points[j].Visited = false
+			points[j].ClusterID = 0
 		}
+
+		layers[i] = dbscanIndexed(points, index, DBSCANParams{
+			Epsilon:     params.Epsilon * params.LayerScales[i],
+			MinPoints:   params.MinPoints,
+			MaxClusters: params.MaxLayers,
+		})
 	}
-	return nil
+	return layers
 }
 
-// FindChildClusters finds all child clusters of a given cluster in the previous layer
-func FindChildClusters(cluster models.Cluster, prevLayer []models.Cluster) []models.Cluster {
-	var children []models.Cluster
-	for _, child := range prevLayer {
-		distance := Distance(cluster.CenterLat, cluster.CenterLng, child.CenterLat, child.CenterLng)
-		if distance <= cluster.Radius {
-			children = append(children, child)
+// GetClustersAtLayer returns clusters at a specific layer in the framework
+func GetClustersAtLayer(framework *models.HierarchicalFramework, layerLevel int) []models.Cluster {
+	for _, layer := range framework.Layers {
+		if layer.Level == layerLevel {
+			return layer.Clusters
 		}
 	}
-	return children
+	return nil
 }
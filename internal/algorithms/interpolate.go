@@ -0,0 +1,115 @@
+package algorithms
+
+import (
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// DefaultMaxInterpolationSpan is the longest gap between two recorded points across which
+// positions are interpolated; inside longer gaps the position is unknown
+const DefaultMaxInterpolationSpan = 5 * time.Minute
+
+// PositionAt returns the position at time at, linearly interpolated between the recorded
+// points around it. It reports false when at lies outside the points or inside a gap longer
+// than maxSpan; a maxSpan of 0 interpolates across any gap.
+func PositionAt(points []models.GPSPoint, at time.Time, maxSpan time.Duration) (models.GPSPoint, bool) {
+	// Index of the first point at or after at
+	i := sort.Search(len(points), func(i int) bool {
+		return !points[i].Timestamp.Before(at)
+	})
+	if i == len(points) {
+		return models.GPSPoint{}, false
+	}
+	if points[i].Timestamp.Equal(at) {
+		return points[i], true
+	}
+	if i == 0 {
+		return models.GPSPoint{}, false
+	}
+
+	prev, next := points[i-1], points[i]
+	if maxSpan > 0 && next.Timestamp.Sub(prev.Timestamp) > maxSpan {
+		return models.GPSPoint{}, false
+	}
+	return interpolatePoint(prev, next, at), true
+}
+
+// Resample returns positions at the multiples of interval (e.g. on the full 10 s of the
+// clock) from the first point to the last, so resampled trajectories line up. Sample times
+// inside gaps longer than maxSpan are skipped, so the result has holes where the trajectory
+// has; a maxSpan of 0 interpolates across any gap.
+func Resample(points []models.GPSPoint, interval, maxSpan time.Duration) []models.GPSPoint {
+	if len(points) == 0 || interval <= 0 {
+		return nil
+	}
+
+	first, end := points[0].Timestamp, points[len(points)-1].Timestamp
+	start := first.Truncate(interval)
+	if start.Before(first) {
+		start = start.Add(interval)
+	}
+	if start.After(end) {
+		return []models.GPSPoint{}
+	}
+	resampled := make([]models.GPSPoint, 0, int(end.Sub(start)/interval)+1)
+
+	// Sample times only increase, so the bracketing points are found by walking forward
+	i := 0
+	for at := start; !at.After(end); at = at.Add(interval) {
+		for i < len(points)-1 && points[i+1].Timestamp.Before(at) {
+			i++
+		}
+
+		if points[i].Timestamp.Equal(at) {
+			resampled = append(resampled, points[i])
+			continue
+		}
+		if i == len(points)-1 {
+			break
+		}
+
+		prev, next := points[i], points[i+1]
+		if next.Timestamp.Equal(at) {
+			resampled = append(resampled, next)
+			continue
+		}
+		if maxSpan > 0 && next.Timestamp.Sub(prev.Timestamp) > maxSpan {
+			continue
+		}
+		resampled = append(resampled, interpolatePoint(prev, next, at))
+	}
+
+	return resampled
+}
+
+// interpolatePoint returns the point at time at on the straight line from a to b, taking the
+// short way across the antimeridian
+func interpolatePoint(a, b models.GPSPoint, at time.Time) models.GPSPoint {
+	span := b.Timestamp.Sub(a.Timestamp)
+	if span <= 0 {
+		return models.GPSPoint{Latitude: a.Latitude, Longitude: a.Longitude, Altitude: a.Altitude, Timestamp: at}
+	}
+	f := float64(at.Sub(a.Timestamp)) / float64(span)
+
+	dLng := b.Longitude - a.Longitude
+	if dLng > 180 {
+		dLng -= 360
+	} else if dLng < -180 {
+		dLng += 360
+	}
+	lng := a.Longitude + f*dLng
+	if lng > 180 {
+		lng -= 360
+	} else if lng < -180 {
+		lng += 360
+	}
+
+	return models.GPSPoint{
+		Latitude:  a.Latitude + f*(b.Latitude-a.Latitude),
+		Longitude: lng,
+		Altitude:  a.Altitude + f*(b.Altitude-a.Altitude),
+		Timestamp: at,
+	}
+}
@@ -0,0 +1,140 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// TestPositionAt checks interpolated positions and the times that have none
+func TestPositionAt(t *testing.T) {
+	// 10 m/s east, then no point for 10 minutes
+	points := testTrack([3]float64{0, 0, 0}, [3]float64{100, 0, 10}, [3]float64{200, 0, 20}, [3]float64{300, 0, 620})
+
+	tests := []struct {
+		name    string
+		at      float64 // Seconds
+		maxSpan time.Duration
+		want    [3]float64
+		wantOK  bool
+	}{
+		{"recorded point", 10, DefaultMaxInterpolationSpan, [3]float64{100, 0, 10}, true},
+		{"between points", 15, DefaultMaxInterpolationSpan, [3]float64{150, 0, 15}, true},
+		{"first point", 0, DefaultMaxInterpolationSpan, [3]float64{0, 0, 0}, true},
+		{"before the first point", -1, DefaultMaxInterpolationSpan, [3]float64{}, false},
+		{"after the last point", 621, DefaultMaxInterpolationSpan, [3]float64{}, false},
+		{"inside a long gap", 320, DefaultMaxInterpolationSpan, [3]float64{}, false},
+		{"inside a long gap without a limit", 320, 0, [3]float64{250, 0, 320}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := PositionAt(points, testStart.Add(time.Duration(tt.at*float64(time.Second))), tt.maxSpan)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				checkPosition(t, got, testTrack(tt.want)[0])
+			}
+		})
+	}
+}
+
+// TestResample checks the sample times and positions, including holes at long gaps
+func TestResample(t *testing.T) {
+	// 10 m/s east from 3 s past a multiple of 10 s
+	var offset [][3]float64
+	for i := 0; i < 4; i++ {
+		offset = append(offset, [3]float64{float64(i) * 100, 0, float64(3 + i*10)})
+	}
+
+	// The same with no point for 15 minutes after 23 s
+	gap := append([][3]float64{}, offset[:3]...)
+	gap = append(gap, [3]float64{300, 0, 923}, [3]float64{400, 0, 933})
+
+	tests := []struct {
+		name     string
+		points   [][3]float64
+		interval time.Duration
+		maxSpan  time.Duration
+		want     [][3]float64
+	}{
+		{
+			name:     "on multiples of the interval",
+			points:   offset,
+			interval: 10 * time.Second,
+			maxSpan:  DefaultMaxInterpolationSpan,
+			want:     [][3]float64{{70, 0, 10}, {170, 0, 20}, {270, 0, 30}},
+		},
+		{
+			name:     "starting at the first point",
+			points:   straightTrack(4, 10, 10),
+			interval: 10 * time.Second,
+			maxSpan:  DefaultMaxInterpolationSpan,
+			want:     straightTrack(4, 10, 10),
+		},
+		{
+			name:     "hole at a long gap",
+			points:   gap,
+			interval: 10 * time.Second,
+			maxSpan:  DefaultMaxInterpolationSpan,
+			want:     [][3]float64{{70, 0, 10}, {170, 0, 20}, {370, 0, 930}},
+		},
+		{
+			name:     "no sample time",
+			points:   [][3]float64{{0, 0, 1}, {10, 0, 9}},
+			interval: 10 * time.Second,
+			want:     [][3]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resample(testTrack(tt.points...), tt.interval, tt.maxSpan)
+			want := testTrack(tt.want...)
+			if len(got) != len(want) {
+				t.Fatalf("got %d points, want %d", len(got), len(want))
+			}
+			for i := range want {
+				checkPosition(t, got[i], want[i])
+			}
+		})
+	}
+
+	if got := Resample(nil, 10*time.Second, 0); got != nil {
+		t.Errorf("resampled no points to %v", got)
+	}
+}
+
+// TestInterpolateAcrossAntimeridian checks that positions take the short way across 180°
+func TestInterpolateAcrossAntimeridian(t *testing.T) {
+	a := models.GPSPoint{Latitude: 10, Longitude: 179.9, Timestamp: testStart}
+	b := models.GPSPoint{Latitude: 10, Longitude: -179.7, Timestamp: testStart.Add(40 * time.Second)}
+
+	for _, tt := range []struct {
+		at   time.Duration
+		want float64
+	}{
+		{10 * time.Second, 180},
+		{30 * time.Second, -179.8},
+	} {
+		got, ok := PositionAt([]models.GPSPoint{a, b}, testStart.Add(tt.at), 0)
+		if !ok {
+			t.Fatalf("no position at %s", tt.at)
+		}
+		// 180 and -180 are the same meridian
+		if math.Abs(math.Remainder(got.Longitude-tt.want, 360)) > 1e-9 || math.Abs(got.Longitude) > 180 {
+			t.Errorf("longitude at %s = %v, want %v", tt.at, got.Longitude, tt.want)
+		}
+	}
+}
+
+// checkPosition fails when got is more than 10 cm or any time away from want
+func checkPosition(t *testing.T, got, want models.GPSPoint) {
+	t.Helper()
+	if d := Distance(got.Latitude, got.Longitude, want.Latitude, want.Longitude) * 1000; d > 0.1 || !got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("point at %s is %.2f m from the one expected at %s", got.Timestamp, d, want.Timestamp)
+	}
+}
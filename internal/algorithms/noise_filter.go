@@ -0,0 +1,330 @@
+package algorithms
+
+import (
+	"math"
+	"sort"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Reasons reported by FilterNoise for dropped and adjusted points
+const (
+	NoiseDuplicateTimestamp = "duplicate_timestamp"
+	NoiseOutOfOrder         = "out_of_order"
+	NoiseSpeedOutlier       = "speed_outlier"
+	NoiseMedian             = "median"
+	NoiseKalman             = "kalman"
+)
+
+// minAdjustment is the displacement in meters from which a point counts as adjusted
+const minAdjustment = 0.1
+
+// NoiseFilterParams configures the filters applied by FilterNoise. The zero value
+// disables every filter.
+type NoiseFilterParams struct {
+	DropDuplicateTimestamps bool    // Drop points whose timestamp does not advance
+	MaxSpeed                float64 // Max plausible speed in m/s for the outlier filter, 0 disables it
+	OutlierLookahead        int     // Points after a too fast one searched for a plausible continuation
+	MedianWindow            int     // Odd number of points in the median filter window, 0 or 1 disables it
+	Kalman                  bool    // Smooth with a constant-velocity Kalman filter and RTS smoother
+	KalmanAcceleration      float64 // Standard deviation of the acceleration in m/s²
+	KalmanMeasurementError  float64 // Standard deviation of a GPS position in meters
+}
+
+// DefaultNoiseFilterParams drops duplicate timestamps and speed spikes. Smoothing changes
+// every stored position, so the median filter and Kalman smoother are opt-in.
+func DefaultNoiseFilterParams() NoiseFilterParams {
+	return NoiseFilterParams{
+		DropDuplicateTimestamps: true,
+		MaxSpeed:                100, // 360 km/h, above trains but below airplanes at cruise
+		OutlierLookahead:        5,
+		MedianWindow:            0,
+		Kalman:                  false,
+		KalmanAcceleration:      1.0,
+		KalmanMeasurementError:  10.0,
+	}
+}
+
+// NoiseFilterReport counts the points FilterNoise dropped or moved, by reason. A point
+// moved by several filters counts once in Adjusted.
+type NoiseFilterReport struct {
+	InputPoints int            `json:"input_points"`
+	Dropped     int            `json:"dropped"`
+	Adjusted    int            `json:"adjusted"`
+	DroppedBy   map[string]int `json:"dropped_by,omitempty"`
+	AdjustedBy  map[string]int `json:"adjusted_by,omitempty"`
+}
+
+func (r *NoiseFilterReport) drop(reason string) {
+	if r.DroppedBy == nil {
+		r.DroppedBy = make(map[string]int)
+	}
+	r.DroppedBy[reason]++
+	r.Dropped++
+}
+
+func (r *NoiseFilterReport) adjust(reason string, count int) {
+	if count == 0 {
+		return
+	}
+	if r.AdjustedBy == nil {
+		r.AdjustedBy = make(map[string]int)
+	}
+	r.AdjustedBy[reason] += count
+}
+
+// FilterNoise cleans chronologically ordered points before they are stored. Filters run
+// in this order: duplicate timestamps, speed outliers, median filter, Kalman smoother.
+// Timestamps and altitudes are never changed.
+func FilterNoise(points []models.GPSPoint, params NoiseFilterParams) ([]models.GPSPoint, NoiseFilterReport) {
+	report := NoiseFilterReport{InputPoints: len(points)}
+	filtered := append([]models.GPSPoint(nil), points...)
+
+	if params.DropDuplicateTimestamps {
+		filtered = dropDuplicateTimestamps(filtered, &report)
+	}
+	if params.MaxSpeed > 0 {
+		filtered = dropSpeedOutliers(filtered, params.MaxSpeed, params.OutlierLookahead, &report)
+	}
+
+	original := append([]models.GPSPoint(nil), filtered...)
+	if params.MedianWindow > 1 {
+		before := append([]models.GPSPoint(nil), filtered...)
+		medianFilter(filtered, params.MedianWindow)
+		report.adjust(NoiseMedian, countMoved(before, filtered))
+	}
+	if params.Kalman && len(filtered) > 1 {
+		before := append([]models.GPSPoint(nil), filtered...)
+		kalmanSmooth(filtered, params.KalmanAcceleration, params.KalmanMeasurementError)
+		report.adjust(NoiseKalman, countMoved(before, filtered))
+	}
+	report.Adjusted = countMoved(original, filtered)
+
+	return filtered, report
+}
+
+// dropDuplicateTimestamps keeps the first point of each timestamp and drops points that go back in time
+func dropDuplicateTimestamps(points []models.GPSPoint, report *NoiseFilterReport) []models.GPSPoint {
+	if len(points) == 0 {
+		return points
+	}
+
+	kept := points[:1]
+	for _, p := range points[1:] {
+		last := kept[len(kept)-1]
+		switch {
+		case p.Timestamp.Equal(last.Timestamp):
+			report.drop(NoiseDuplicateTimestamp)
+		case p.Timestamp.Before(last.Timestamp):
+			report.drop(NoiseOutOfOrder)
+		default:
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// dropSpeedOutliers drops points that can only be reached from the last kept point faster
+// than maxSpeed when a point shortly after them can be reached at a plausible speed. Sustained
+// fast movement and jumps the track continues from are kept.
+func dropSpeedOutliers(points []models.GPSPoint, maxSpeed float64, lookahead int, report *NoiseFilterReport) []models.GPSPoint {
+	if len(points) < 3 {
+		return points
+	}
+	if lookahead < 1 {
+		lookahead = 1
+	}
+
+	kept := []models.GPSPoint{points[0]}
+	for i := 1; i < len(points); i++ {
+		last := kept[len(kept)-1]
+		if pointSpeed(last, points[i]) <= maxSpeed {
+			kept = append(kept, points[i])
+			continue
+		}
+
+		spike := false
+		for j := i + 1; j < len(points) && j <= i+lookahead; j++ {
+			if pointSpeed(last, points[j]) <= maxSpeed {
+				spike = true
+				break
+			}
+		}
+
+		if spike {
+			report.drop(NoiseSpeedOutlier)
+		} else {
+			kept = append(kept, points[i])
+		}
+	}
+	return kept
+}
+
+// pointSpeed returns the speed in m/s needed to move from a to b
+func pointSpeed(a, b models.GPSPoint) float64 {
+	meters := Distance(a.Latitude, a.Longitude, b.Latitude, b.Longitude) * 1000
+	seconds := b.Timestamp.Sub(a.Timestamp).Seconds()
+	if seconds <= 0 {
+		if meters == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return meters / seconds
+}
+
+// medianFilter replaces each coordinate with the median of a centred window. Points closer
+// than half a window to either end are left unchanged.
+func medianFilter(points []models.GPSPoint, window int) {
+	half := window / 2
+	if half == 0 || len(points) < 2*half+1 {
+		return
+	}
+
+	lats := make([]float64, len(points))
+	lngs := make([]float64, len(points))
+	for i, p := range points {
+		lats[i], lngs[i] = p.Latitude, p.Longitude
+	}
+
+	buf := make([]float64, 2*half+1)
+	for i := half; i < len(points)-half; i++ {
+		points[i].Latitude = median(buf, lats[i-half:i+half+1])
+		points[i].Longitude = median(buf, lngs[i-half:i+half+1])
+	}
+}
+
+func median(buf, values []float64) float64 {
+	buf = append(buf[:0], values...)
+	sort.Float64s(buf)
+	return buf[len(buf)/2]
+}
+
+// kalmanSmooth runs a constant-velocity Kalman filter forward and a Rauch-Tung-Striebel
+// smoother backward on each axis of a local metric projection
+func kalmanSmooth(points []models.GPSPoint, acceleration, measurementError float64) {
+	xy := projectPoints(points)
+	dts := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		dts[i] = points[i].Timestamp.Sub(points[i-1].Timestamp).Seconds()
+	}
+
+	xs := make([]float64, len(points))
+	ys := make([]float64, len(points))
+	for i, p := range xy {
+		xs[i], ys[i] = p.x, p.y
+	}
+
+	xs = smoothAxis(xs, dts, acceleration, measurementError)
+	ys = smoothAxis(ys, dts, acceleration, measurementError)
+	for i := range xy {
+		xy[i] = planarPoint{x: xs[i], y: ys[i]}
+	}
+
+	unprojectPoints(points, xy)
+}
+
+// kalmanState is a position/velocity estimate with its covariance [p00 p01; p10 p11]
+type kalmanState struct {
+	pos, vel           float64
+	p00, p01, p10, p11 float64
+}
+
+// smoothAxis returns the smoothed positions of one axis
+func smoothAxis(z, dts []float64, acceleration, measurementError float64) []float64 {
+	n := len(z)
+	r := measurementError * measurementError
+	q := acceleration * acceleration
+
+	filtered := make([]kalmanState, n)
+	predicted := make([]kalmanState, n)
+	// The initial velocity is unknown, so its variance is large
+	filtered[0] = kalmanState{pos: z[0], p00: r, p11: 100}
+
+	for k := 1; k < n; k++ {
+		prev := filtered[k-1]
+		dt := dts[k]
+
+		// Predict with x = F x and P = F P Fᵀ + Q for F = [1 dt; 0 1]
+		pred := kalmanState{
+			pos: prev.pos + dt*prev.vel,
+			vel: prev.vel,
+			p00: prev.p00 + dt*(prev.p10+prev.p01) + dt*dt*prev.p11 + q*dt*dt*dt*dt/4,
+			p01: prev.p01 + dt*prev.p11 + q*dt*dt*dt/2,
+			p10: prev.p10 + dt*prev.p11 + q*dt*dt*dt/2,
+			p11: prev.p11 + q*dt*dt,
+		}
+		predicted[k] = pred
+
+		// Update with the measured position
+		s := pred.p00 + r
+		k0, k1 := pred.p00/s, pred.p10/s
+		innovation := z[k] - pred.pos
+		filtered[k] = kalmanState{
+			pos: pred.pos + k0*innovation,
+			vel: pred.vel + k1*innovation,
+			p00: (1 - k0) * pred.p00,
+			p01: (1 - k0) * pred.p01,
+			p10: pred.p10 - k1*pred.p00,
+			p11: pred.p11 - k1*pred.p01,
+		}
+	}
+
+	smoothedPos := make([]float64, n)
+	smoothedPos[n-1] = filtered[n-1].pos
+	smoothedVel := filtered[n-1].vel
+	for k := n - 2; k >= 0; k-- {
+		f, pred := filtered[k], predicted[k+1]
+		dt := dts[k+1]
+
+		// C = P_k Fᵀ (P⁻_{k+1})⁻¹
+		a00 := f.p00 + dt*f.p01
+		a01 := f.p01
+		a10 := f.p10 + dt*f.p11
+		a11 := f.p11
+		det := pred.p00*pred.p11 - pred.p01*pred.p10
+		if det == 0 {
+			smoothedPos[k] = f.pos
+			smoothedVel = f.vel
+			continue
+		}
+		i00, i01 := pred.p11/det, -pred.p01/det
+		i10, i11 := -pred.p10/det, pred.p00/det
+		c00 := a00*i00 + a01*i10
+		c01 := a00*i01 + a01*i11
+		c10 := a10*i00 + a11*i10
+		c11 := a10*i01 + a11*i11
+
+		dPos := smoothedPos[k+1] - pred.pos
+		dVel := smoothedVel - pred.vel
+		smoothedPos[k] = f.pos + c00*dPos + c01*dVel
+		smoothedVel = f.vel + c10*dPos + c11*dVel
+	}
+
+	return smoothedPos
+}
+
+// unprojectPoints writes positions of the local projection made by projectPoints back to
+// the coordinates of points
+func unprojectPoints(points []models.GPSPoint, xy []planarPoint) {
+	lat0 := points[0].Latitude * math.Pi / 180
+	lng0 := points[0].Longitude * math.Pi / 180
+	cosLat := math.Cos(lat0)
+	radius := EarthRadiusKm * 1000
+
+	for i := range points {
+		points[i].Latitude = (lat0 + xy[i].y/radius) * 180 / math.Pi
+		points[i].Longitude = (lng0 + xy[i].x/(cosLat*radius)) * 180 / math.Pi
+	}
+}
+
+// countMoved counts the points displaced by at least minAdjustment
+func countMoved(before, after []models.GPSPoint) int {
+	moved := 0
+	for i := range before {
+		if Distance(before[i].Latitude, before[i].Longitude, after[i].Latitude, after[i].Longitude)*1000 >= minAdjustment {
+			moved++
+		}
+	}
+	return moved
+}
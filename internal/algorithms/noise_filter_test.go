@@ -0,0 +1,183 @@
+package algorithms
+
+import (
+	"maps"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// testStart is the time of the first point of test tracks
+var testStart = time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC)
+
+// testTrack returns GPS points given as {meters east, meters north, seconds} of
+// benchCenterLat, benchCenterLng and testStart
+func testTrack(points ...[3]float64) []models.GPSPoint {
+	cosLat := math.Cos(benchCenterLat * math.Pi / 180)
+	track := make([]models.GPSPoint, len(points))
+	for i, p := range points {
+		track[i] = models.GPSPoint{
+			Latitude:  benchCenterLat + p[1]/1000/kmPerDegree,
+			Longitude: benchCenterLng + p[0]/1000/(kmPerDegree*cosLat),
+			Timestamp: testStart.Add(time.Duration(p[2] * float64(time.Second))),
+		}
+	}
+	return track
+}
+
+// straightTrack returns n points heading east at speed m/s, one every interval seconds
+func straightTrack(n int, speed, interval float64) [][3]float64 {
+	points := make([][3]float64, n)
+	for i := range points {
+		t := float64(i) * interval
+		points[i] = [3]float64{speed * t, 0, t}
+	}
+	return points
+}
+
+// TestFilterNoise checks which points each filter drops or moves
+func TestFilterNoise(t *testing.T) {
+	defaults := DefaultNoiseFilterParams()
+	medianOnly := NoiseFilterParams{MedianWindow: 3}
+	kalmanOnly := NoiseFilterParams{Kalman: true, KalmanAcceleration: 1, KalmanMeasurementError: 10}
+
+	// A walk at 1 m/s with one point 5 km off, which would need 5 km/s
+	spike := straightTrack(10, 1, 1)
+	spike[4] = [3]float64{5000, 0, 4}
+
+	// A walk that continues from a position 5 km off, e.g. after the GPS was switched off
+	jump := straightTrack(10, 1, 1)
+	for i := 5; i < len(jump); i++ {
+		jump[i][0] += 5000
+	}
+
+	// A walk with a point 20 m to the side, too slow to be a speed outlier
+	zigzag := straightTrack(10, 1, 10)
+	zigzag[5][1] = 20
+
+	tests := []struct {
+		name         string
+		points       [][3]float64
+		params       NoiseFilterParams
+		wantPoints   int
+		wantDropped  map[string]int
+		wantAdjusted []string // Filters that moved points
+	}{
+		{
+			name:       "clean track",
+			points:     straightTrack(10, 1, 1),
+			params:     defaults,
+			wantPoints: 10,
+		},
+		{
+			name:        "duplicate timestamps",
+			points:      [][3]float64{{0, 0, 0}, {1, 0, 1}, {2, 0, 1}, {3, 0, 2}},
+			params:      defaults,
+			wantPoints:  3,
+			wantDropped: map[string]int{NoiseDuplicateTimestamp: 1},
+		},
+		{
+			name:        "timestamps going back",
+			points:      [][3]float64{{0, 0, 0}, {1, 0, 2}, {2, 0, 1}, {3, 0, 3}},
+			params:      defaults,
+			wantPoints:  3,
+			wantDropped: map[string]int{NoiseOutOfOrder: 1},
+		},
+		{
+			name:        "speed spike",
+			points:      spike,
+			params:      defaults,
+			wantPoints:  9,
+			wantDropped: map[string]int{NoiseSpeedOutlier: 1},
+		},
+		{
+			name:       "jump the track continues from",
+			points:     jump,
+			params:     defaults,
+			wantPoints: 10,
+		},
+		{
+			name:       "filters disabled",
+			points:     spike,
+			params:     NoiseFilterParams{},
+			wantPoints: 10,
+		},
+		{
+			name:         "median filter",
+			points:       zigzag,
+			params:       medianOnly,
+			wantPoints:   10,
+			wantAdjusted: []string{NoiseMedian},
+		},
+		{
+			name:         "Kalman smoother",
+			points:       zigzag,
+			params:       kalmanOnly,
+			wantPoints:   10,
+			wantAdjusted: []string{NoiseKalman},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := testTrack(tt.points...)
+			filtered, report := FilterNoise(input, tt.params)
+
+			if len(filtered) != tt.wantPoints {
+				t.Errorf("kept %d points, want %d", len(filtered), tt.wantPoints)
+			}
+			if report.InputPoints != len(input) || report.Dropped != len(input)-len(filtered) {
+				t.Errorf("report counts %d input and %d dropped points for %d in and %d out",
+					report.InputPoints, report.Dropped, len(input), len(filtered))
+			}
+			if !maps.Equal(report.DroppedBy, tt.wantDropped) {
+				t.Errorf("dropped by %v, want %v", report.DroppedBy, tt.wantDropped)
+			}
+
+			if len(report.AdjustedBy) != len(tt.wantAdjusted) {
+				t.Errorf("adjusted by %v, want %v", report.AdjustedBy, tt.wantAdjusted)
+			}
+			for _, reason := range tt.wantAdjusted {
+				if report.AdjustedBy[reason] == 0 {
+					t.Errorf("adjusted by %v, want points moved by %s", report.AdjustedBy, reason)
+				}
+			}
+			if len(tt.wantAdjusted) == 0 && report.Adjusted != 0 {
+				t.Errorf("%d points adjusted, want none", report.Adjusted)
+			}
+
+			for i, p := range filtered {
+				if i > 0 && !p.Timestamp.After(filtered[i-1].Timestamp) {
+					t.Fatalf("point %d at %s does not follow %s", i, p.Timestamp, filtered[i-1].Timestamp)
+				}
+			}
+		})
+	}
+}
+
+// TestFilterNoiseSmoothsTowardTheTrack checks that smoothing moves a point off to the side
+// back toward the line it was recorded on, without changing the input
+func TestFilterNoiseSmoothsTowardTheTrack(t *testing.T) {
+	points := straightTrack(10, 1, 10)
+	points[5][1] = 20
+	input := testTrack(points...)
+	original := testTrack(points...)
+	line := testTrack(straightTrack(10, 1, 10)...)
+
+	for _, params := range []NoiseFilterParams{
+		{MedianWindow: 3},
+		{Kalman: true, KalmanAcceleration: 1, KalmanMeasurementError: 10},
+	} {
+		filtered, _ := FilterNoise(input, params)
+		before := Distance(input[5].Latitude, input[5].Longitude, line[5].Latitude, line[5].Longitude)
+		after := Distance(filtered[5].Latitude, filtered[5].Longitude, line[5].Latitude, line[5].Longitude)
+		if after >= before {
+			t.Errorf("%+v: point 5 is %.1f m off the line after smoothing, %.1f m before", params, after*1000, before*1000)
+		}
+		if input[5] != original[5] {
+			t.Fatalf("%+v: the input was changed", params)
+		}
+	}
+}
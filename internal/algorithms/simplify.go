@@ -0,0 +1,230 @@
+package algorithms
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Simplification methods accepted by Simplify
+const (
+	SimplifyDouglasPeucker = "dp" // Tolerance is the maximum deviation in meters
+	SimplifyVisvalingam    = "vw" // Tolerance is the minimum triangle area in square meters
+)
+
+const (
+	DefaultDouglasPeuckerTolerance = 10.0  // meters
+	DefaultVisvalingamTolerance    = 500.0 // square meters
+)
+
+// IsSimplifyMethod reports whether method names a supported simplification algorithm
+func IsSimplifyMethod(method string) bool {
+	return method == SimplifyDouglasPeucker || method == SimplifyVisvalingam
+}
+
+// DefaultSimplifyTolerance returns the tolerance used when none is given for method
+func DefaultSimplifyTolerance(method string) float64 {
+	if method == SimplifyVisvalingam {
+		return DefaultVisvalingamTolerance
+	}
+	return DefaultDouglasPeuckerTolerance
+}
+
+// Simplify reduces points with the given method. The result is a subsequence of the
+// input, so every kept point keeps its timestamp and altitude, and the first and last
+// points are always kept.
+func Simplify(points []models.GPSPoint, method string, tolerance float64) ([]models.GPSPoint, error) {
+	if tolerance < 0 {
+		return nil, fmt.Errorf("tolerance must not be negative")
+	}
+
+	switch method {
+	case SimplifyDouglasPeucker:
+		return DouglasPeucker(points, tolerance), nil
+	case SimplifyVisvalingam:
+		return VisvalingamWhyatt(points, tolerance), nil
+	default:
+		return nil, fmt.Errorf("unknown simplification method %q", method)
+	}
+}
+
+// DouglasPeucker keeps the points needed so that no removed point lies further than
+// toleranceMeters from the simplified line
+func DouglasPeucker(points []models.GPSPoint, toleranceMeters float64) []models.GPSPoint {
+	if len(points) < 3 {
+		return append([]models.GPSPoint(nil), points...)
+	}
+
+	xy := projectPoints(points)
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+
+	// An explicit stack avoids deep recursion on tracks with tens of thousands of points
+	type span struct{ first, last int }
+	stack := []span{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		maxDist, index := -1.0, -1
+		for i := s.first + 1; i < s.last; i++ {
+			d := segmentDistance(xy[i], xy[s.first], xy[s.last])
+			if d > maxDist {
+				maxDist, index = d, i
+			}
+		}
+
+		if index >= 0 && maxDist > toleranceMeters {
+			keep[index] = true
+			stack = append(stack, span{s.first, index}, span{index, s.last})
+		}
+	}
+
+	simplified := make([]models.GPSPoint, 0, len(points)/4+2)
+	for i, k := range keep {
+		if k {
+			simplified = append(simplified, points[i])
+		}
+	}
+	return simplified
+}
+
+// VisvalingamWhyatt repeatedly removes the point forming the smallest triangle with its
+// neighbours until every remaining triangle covers at least minAreaSquareMeters
+func VisvalingamWhyatt(points []models.GPSPoint, minAreaSquareMeters float64) []models.GPSPoint {
+	if len(points) < 3 {
+		return append([]models.GPSPoint(nil), points...)
+	}
+
+	xy := projectPoints(points)
+	n := len(points)
+	prev := make([]int, n)
+	next := make([]int, n)
+	for i := range points {
+		prev[i], next[i] = i-1, i+1
+	}
+
+	h := make(areaHeap, 0, n-2)
+	entries := make([]*areaEntry, n)
+	for i := 1; i < n-1; i++ {
+		entries[i] = &areaEntry{index: i, area: triangleArea(xy[i-1], xy[i], xy[i+1]), heapIndex: len(h)}
+		h = append(h, entries[i])
+	}
+	heap.Init(&h)
+
+	removed := make([]bool, n)
+	// Neighbours of a removed point never get a smaller effective area than it had, so a
+	// point is never removed before a more significant one
+	lastArea := 0.0
+	for h.Len() > 0 {
+		e := heap.Pop(&h).(*areaEntry)
+		if e.area >= minAreaSquareMeters {
+			break
+		}
+		lastArea = math.Max(lastArea, e.area)
+
+		i := e.index
+		removed[i] = true
+		p, q := prev[i], next[i]
+		next[p], prev[q] = q, p
+
+		for _, j := range []int{p, q} {
+			if j == 0 || j == n-1 {
+				continue
+			}
+			entries[j].area = math.Max(lastArea, triangleArea(xy[prev[j]], xy[j], xy[next[j]]))
+			heap.Fix(&h, entries[j].heapIndex)
+		}
+	}
+
+	simplified := make([]models.GPSPoint, 0, n-len(h))
+	for i := range points {
+		if !removed[i] {
+			simplified = append(simplified, points[i])
+		}
+	}
+	return simplified
+}
+
+// planarPoint is a point in meters on a local equirectangular projection
+type planarPoint struct{ x, y float64 }
+
+// projectPoints maps coordinates to meters around the first point, which is accurate
+// enough for the extent of a single trajectory
+func projectPoints(points []models.GPSPoint) []planarPoint {
+	return projectAround(points, points[0])
+}
+
+// projectAround maps coordinates to meters around origin, so that several trajectories
+// can share one projection
+func projectAround(points []models.GPSPoint, origin models.GPSPoint) []planarPoint {
+	lat0 := origin.Latitude * math.Pi / 180
+	lng0 := origin.Longitude * math.Pi / 180
+	cosLat := math.Cos(lat0)
+	radius := EarthRadiusKm * 1000
+
+	xy := make([]planarPoint, len(points))
+	for i, p := range points {
+		xy[i] = planarPoint{
+			x: (p.Longitude*math.Pi/180 - lng0) * cosLat * radius,
+			y: (p.Latitude*math.Pi/180 - lat0) * radius,
+		}
+	}
+	return xy
+}
+
+// segmentDistance returns the distance from p to the segment ab
+func segmentDistance(p, a, b planarPoint) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	lengthSq := dx*dx + dy*dy
+	if lengthSq == 0 {
+		return math.Hypot(p.x-a.x, p.y-a.y)
+	}
+
+	t := ((p.x-a.x)*dx + (p.y-a.y)*dy) / lengthSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+func triangleArea(a, b, c planarPoint) float64 {
+	return math.Abs((b.x-a.x)*(c.y-a.y)-(c.x-a.x)*(b.y-a.y)) / 2
+}
+
+type areaEntry struct {
+	index     int
+	area      float64
+	heapIndex int
+}
+
+// areaHeap is a min-heap of points by effective area
+type areaHeap []*areaEntry
+
+func (h areaHeap) Len() int { return len(h) }
+
+func (h areaHeap) Less(i, j int) bool {
+	if h[i].area == h[j].area {
+		return h[i].index < h[j].index
+	}
+	return h[i].area < h[j].area
+}
+
+func (h areaHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *areaHeap) Push(x any) {
+	e := x.(*areaEntry)
+	e.heapIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *areaHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,86 @@
+package algorithms
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSimplify checks the points kept by both simplification methods
+func TestSimplify(t *testing.T) {
+	// 100 m east then 100 m north, a point every 10 m
+	var corner [][3]float64
+	for i := 0; i <= 10; i++ {
+		corner = append(corner, [3]float64{float64(i) * 10, 0, float64(i)})
+	}
+	for i := 1; i <= 10; i++ {
+		corner = append(corner, [3]float64{100, float64(i) * 10, float64(10 + i)})
+	}
+
+	// 100 m east, 3 m to either side every 10 m
+	var wiggle [][3]float64
+	for i := 0; i <= 10; i++ {
+		wiggle = append(wiggle, [3]float64{float64(i) * 10, float64(3 * (i % 2)), float64(i)})
+	}
+	wiggle[10][1] = 0
+
+	tests := []struct {
+		name      string
+		points    [][3]float64
+		method    string
+		tolerance float64
+		want      []float64 // Seconds of the kept points
+	}{
+		{"dp straight line", straightTrack(10, 10, 1), SimplifyDouglasPeucker, 10, []float64{0, 9}},
+		{"vw straight line", straightTrack(10, 10, 1), SimplifyVisvalingam, 500, []float64{0, 9}},
+		{"dp corner", corner, SimplifyDouglasPeucker, 10, []float64{0, 10, 20}},
+		{"vw corner", corner, SimplifyVisvalingam, 500, []float64{0, 10, 20}},
+		{"dp wiggle within tolerance", wiggle, SimplifyDouglasPeucker, 10, []float64{0, 10}},
+		{"vw wiggle within tolerance", wiggle, SimplifyVisvalingam, 500, []float64{0, 10}},
+		{"dp wiggle above tolerance", wiggle, SimplifyDouglasPeucker, 1, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"vw wiggle above tolerance", wiggle, SimplifyVisvalingam, 1, []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"dp two points", straightTrack(2, 10, 1), SimplifyDouglasPeucker, 10, []float64{0, 1}},
+		{"vw two points", straightTrack(2, 10, 1), SimplifyVisvalingam, 500, []float64{0, 1}},
+		{"dp no points", nil, SimplifyDouglasPeucker, 10, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := testTrack(tt.points...)
+			simplified, err := Simplify(points, tt.method, tt.tolerance)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []float64
+			for _, p := range simplified {
+				got = append(got, p.Timestamp.Sub(testStart).Seconds())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("kept the points at %v s, want %v s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSimplifyInvalid checks the rejected methods and tolerances
+func TestSimplifyInvalid(t *testing.T) {
+	points := testTrack(straightTrack(10, 10, 1)...)
+
+	tests := []struct {
+		name      string
+		method    string
+		tolerance float64
+	}{
+		{"negative tolerance", SimplifyDouglasPeucker, -1},
+		{"unknown method", "rdp", 10},
+		{"no method", "", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Simplify(points, tt.method, tt.tolerance); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
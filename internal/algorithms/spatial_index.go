@@ -0,0 +1,140 @@
+package algorithms
+
+import (
+	"math"
+)
+
+// kmPerDegree is the length of one degree of latitude
+const kmPerDegree = EarthRadiusKm * math.Pi / 180
+
+// SpatialIndex buckets coordinates into a grid of cells of equal size in degrees, so that
+// a region query only measures the distance to the coordinates in the cells the region
+// overlaps instead of to all of them. Queries of any radius work; the index is fastest
+// when the cell size is close to the query radius.
+type SpatialIndex struct {
+	cellSize   float64 // Cell side in degrees
+	columns    int     // Cells around a parallel, for wrapping at the antimeridian
+	cells      map[gridCell][]int
+	lats, lngs []float64
+}
+
+type gridCell struct{ row, column int }
+
+// NewSpatialIndex returns an empty index whose cells are cellSizeKm high
+func NewSpatialIndex(cellSizeKm float64) *SpatialIndex {
+	cellSize := cellSizeKm / kmPerDegree
+	if !(cellSize > 0) || cellSize > 90 {
+		cellSize = 90
+	}
+	return &SpatialIndex{
+		cellSize: cellSize,
+		columns:  int(math.Ceil(360 / cellSize)),
+		cells:    make(map[gridCell][]int),
+	}
+}
+
+// Insert adds a coordinate and returns its ID, which counts the insertions from 0
+func (x *SpatialIndex) Insert(lat, lng float64) int {
+	id := len(x.lats)
+	x.lats = append(x.lats, lat)
+	x.lngs = append(x.lngs, lng)
+
+	cell := gridCell{x.row(lat), x.column(lng)}
+	x.cells[cell] = append(x.cells[cell], id)
+	return id
+}
+
+// Len returns the number of coordinates in the index
+func (x *SpatialIndex) Len() int {
+	return len(x.lats)
+}
+
+// Within appends to dst the IDs of the coordinates within radiusKm of lat, lng, in no
+// particular order
+func (x *SpatialIndex) Within(lat, lng, radiusKm float64, dst []int) []int {
+	x.Visit(lat, lng, radiusKm, func(id int, _ float64) {
+		dst = append(dst, id)
+	})
+	return dst
+}
+
+// Visit calls fn with the ID and the distance in km of every coordinate within radiusKm
+// of lat, lng, in no particular order
+func (x *SpatialIndex) Visit(lat, lng, radiusKm float64, fn func(id int, distanceKm float64)) {
+	dLat := radiusKm / kmPerDegree
+	minRow, maxRow := max(x.row(lat-dLat), 0), min(x.row(lat+dLat), x.row(90))
+
+	// Meridians converge, so the longitude span grows toward the pole side of the region.
+	// A region across the antimeridian covers columns at both ends of the grid.
+	var spans [2][2]int
+	count := 1
+	maxLat := math.Min(math.Abs(lat)+dLat, 90)
+	if cos := math.Cos(maxLat * math.Pi / 180); maxLat >= 89.9 || dLat/cos >= 180 {
+		spans[0] = [2]int{0, x.columns - 1}
+	} else {
+		west, east := lng-dLat/cos, lng+dLat/cos
+		switch {
+		case west < -180:
+			spans[0], spans[1] = [2]int{x.column(west + 360), x.columns - 1}, [2]int{0, x.column(east)}
+			count = 2
+		case east >= 180:
+			spans[0], spans[1] = [2]int{x.column(west), x.columns - 1}, [2]int{0, x.column(east - 360)}
+			count = 2
+		default:
+			spans[0] = [2]int{x.column(west), x.column(east)}
+		}
+	}
+
+	visitCell := func(ids []int) {
+		for _, id := range ids {
+			if distance := Distance(lat, lng, x.lats[id], x.lngs[id]); distance <= radiusKm {
+				fn(id, distance)
+			}
+		}
+	}
+
+	// Near the poles a region can overlap more cells than the index holds
+	cells := 0
+	for _, span := range spans[:count] {
+		cells += (maxRow - minRow + 1) * (span[1] - span[0] + 1)
+	}
+	if cells > len(x.cells) {
+		for cell, ids := range x.cells {
+			if cell.row < minRow || cell.row > maxRow {
+				continue
+			}
+			for _, span := range spans[:count] {
+				if cell.column >= span[0] && cell.column <= span[1] {
+					visitCell(ids)
+					break
+				}
+			}
+		}
+		return
+	}
+
+	for row := minRow; row <= maxRow; row++ {
+		for _, span := range spans[:count] {
+			for col := span[0]; col <= span[1]; col++ {
+				visitCell(x.cells[gridCell{row, col}])
+			}
+		}
+	}
+}
+
+func (x *SpatialIndex) row(lat float64) int {
+	return int(math.Floor((lat + 90) / x.cellSize))
+}
+
+func (x *SpatialIndex) column(lng float64) int {
+	return x.wrap(int(math.Floor((lng + 180) / x.cellSize)))
+}
+
+// wrap maps a column west of -180° or east of 180° onto the grid
+func (x *SpatialIndex) wrap(column int) int {
+	column %= x.columns
+	if column < 0 {
+		column += x.columns
+	}
+	return column
+}
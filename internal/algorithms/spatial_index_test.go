@@ -0,0 +1,97 @@
+package algorithms
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// TestSpatialIndexWithinMatchesLinearScan checks region queries against the distance to
+// every coordinate, including regions across the antimeridian and around the poles
+func TestSpatialIndexWithinMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	regions := []struct {
+		name     string
+		lat, lng float64
+		extent   float64 // Degrees around lat, lng the coordinates are spread over
+	}{
+		{"beijing", 39.95, 116.35, 0.5},
+		{"antimeridian", -16.5, 179.9, 1},
+		{"north pole", 89.5, 0, 2},
+		{"south pole", -89.5, 45, 2},
+	}
+
+	for _, region := range regions {
+		t.Run(region.name, func(t *testing.T) {
+			lats, lngs := make([]float64, 5000), make([]float64, 5000)
+			for i := range lats {
+				lats[i] = min(max(region.lat+(r.Float64()-0.5)*region.extent, -90), 90)
+				lngs[i] = region.lng + (r.Float64()-0.5)*region.extent
+				if lngs[i] > 180 {
+					lngs[i] -= 360
+				}
+			}
+
+			for _, cellSize := range []float64{0.05, 0.1, 1, 0} {
+				index := NewSpatialIndex(cellSize)
+				for i := range lats {
+					index.Insert(lats[i], lngs[i])
+				}
+
+				for q := 0; q < 100; q++ {
+					target := r.Intn(len(lats))
+					radius := []float64{0.01, 0.1, 0.5, 5}[q%4]
+
+					got := slices.Sorted(slices.Values(index.Within(lats[target], lngs[target], radius, nil)))
+					var want []int
+					for i := range lats {
+						if Distance(lats[target], lngs[target], lats[i], lngs[i]) <= radius {
+							want = append(want, i)
+						}
+					}
+
+					if !slices.Equal(got, want) {
+						t.Fatalf("cell %.2f km, %.2f km around (%f, %f): index found %d neighbors, linear scan %d",
+							cellSize, radius, lats[target], lngs[target], len(got), len(want))
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestSpatialIndexUnits checks that cell sizes and radii are taken in km, so that a
+// caller passing meters finds everything instead of the few coordinates it asked for
+func TestSpatialIndexUnits(t *testing.T) {
+	// Coordinates due north of the first one, at the given distances in km
+	const lat, lng = 39.95, 116.35
+	offsets := []float64{0, 0.05, 0.15, 0.8, 5}
+
+	tests := []struct {
+		name       string
+		cellSizeKm float64
+		radiusKm   float64
+		want       []int
+	}{
+		{"100 m", 0.1, 0.1, []int{0, 1}},
+		{"200 m", 0.1, 0.2, []int{0, 1, 2}},
+		{"1 km", 1, 1, []int{0, 1, 2, 3}},
+		{"1 km in small cells", 0.1, 1, []int{0, 1, 2, 3}},
+		{"10 km", 10, 10, []int{0, 1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index := NewSpatialIndex(tt.cellSizeKm)
+			for _, offset := range offsets {
+				index.Insert(lat+offset/kmPerDegree, lng)
+			}
+
+			got := slices.Sorted(slices.Values(index.Within(lat, lng, tt.radiusKm, nil)))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Within %.2f km = %v, want %v", tt.radiusKm, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,60 +2,94 @@ package algorithms
 
 import (
 	"encoding/json"
-	"sort"
 	"time"
 
 	"github.com/th1enq/go-map/internal/models"
 )
 
-func StayPointDetection(trajectory models.Trajectory, distThreshold float64, timeThreshold time.Duration) []models.StayPoint {
-	var stayPoints []models.StayPoint
+const (
+	DefaultStayDistanceThreshold = 200.0            // Maximum distance in meters covered during a stay
+	DefaultStayTimeThreshold     = 30 * time.Minute // Minimum duration of a stay
+)
+
+// StayPointParams are the thresholds of stay point detection and the detector applying them
+type StayPointParams struct {
+	Algorithm         string        // Detector name, empty for StayAlgorithmSequential
+	DistanceThreshold float64       // Maximum distance in meters covered during a stay
+	TimeThreshold     time.Duration // Minimum duration of a stay
+}
+
+// DefaultStayPointParams returns the thresholds used when none are configured
+func DefaultStayPointParams() StayPointParams {
+	return StayPointParams{
+		Algorithm:         StayAlgorithmSequential,
+		DistanceThreshold: DefaultStayDistanceThreshold,
+		TimeThreshold:     DefaultStayTimeThreshold,
+	}
+}
 
+// DetectStayPoints finds the stay points of a trajectory with the detector and thresholds
+// of params. An unknown detector name falls back to the sequential detector.
+func DetectStayPoints(trajectory models.Trajectory, params StayPointParams) []models.StayPoint {
 	var points []models.GPSPoint
 	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
-		return stayPoints
+		return nil
 	}
 
-	if len(points) < 2 {
-		return stayPoints
+	detector, err := NewStayPointDetector(params)
+	if err != nil {
+		detector = sequentialDetector{params: params}
 	}
 
-	// Sort by timestamp to ensure chronological order
-	sort.Slice(points, func(i, j int) bool {
-		return points[i].Timestamp.Before(points[j].Timestamp)
+	stayPoints := detector.Detect(points)
+	for i := range stayPoints {
+		stayPoints[i].UserID = trajectory.UserID
+		stayPoints[i].TrajectoryID = trajectory.ID
+	}
+	return stayPoints
+}
+
+// StayPointDetection runs the sequential detector with the given thresholds
+func StayPointDetection(trajectory models.Trajectory, distThreshold float64, timeThreshold time.Duration) []models.StayPoint {
+	return DetectStayPoints(trajectory, StayPointParams{
+		Algorithm:         StayAlgorithmSequential,
+		DistanceThreshold: distThreshold,
+		TimeThreshold:     timeThreshold,
 	})
+}
+
+// sequentialDetector scans the points in order and reports a stay whenever the points
+// following an anchor remain within the distance threshold for longer than the time
+// threshold
+type sequentialDetector struct {
+	params StayPointParams
+}
+
+func (d sequentialDetector) Name() string {
+	return StayAlgorithmSequential
+}
+
+func (d sequentialDetector) Detect(points []models.GPSPoint) []models.StayPoint {
+	var stayPoints []models.StayPoint
+	if len(points) < 2 {
+		return stayPoints
+	}
+	points = chronological(points)
+	distThreshold, timeThreshold := d.params.DistanceThreshold, d.params.TimeThreshold
 
 	i := 0
 	for i < len(points)-1 { // Ensure i never reaches the last point
 		j := i + 1
 		foundStay := false
 
-		// Set a maximum for j to prevent excessive loop iterations
-		jMax := len(points)
-		if i+1000 < len(points) {
-			// Limit processing window to 1000 points to improve performance
-			jMax = i + 1000
-		}
-
-		for j < jMax {
+		// The scan stops at the first point outside the distance threshold, so it stays
+		// short while moving and only grows with the points recorded in one place
+		for j < len(points) {
 			dist := Distance(points[i].Latitude, points[i].Longitude, points[j].Latitude, points[j].Longitude) * 1000
 			if dist <= distThreshold {
 				deltaT := points[j].Timestamp.Sub(points[i].Timestamp)
 				if deltaT > timeThreshold {
-					var sumLat, sumLng float64
-					for k := i; k <= j; k++ {
-						sumLat += points[k].Latitude
-						sumLng += points[k].Longitude
-					}
-					count := float64(j - i + 1)
-					stayPoints = append(stayPoints, models.StayPoint{
-						UserID:        trajectory.UserID,
-						TrajectoryID:  trajectory.ID,
-						Latitude:      sumLat / count,
-						Longitude:     sumLng / count,
-						ArrivalTime:   points[i].Timestamp,
-						DepartureTime: points[j].Timestamp,
-					})
+					stayPoints = append(stayPoints, newStayPoint(points[i:j+1]))
 
 					// Ensure i advances to avoid infinite loop
 					i = j + 1 // Move i past j instead of setting i = j
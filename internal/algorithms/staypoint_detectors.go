@@ -0,0 +1,272 @@
+package algorithms
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Stay point detectors, selected by StayPointParams.Algorithm
+const (
+	StayAlgorithmSequential = "sequential" // Anchor-based scan, the default
+	StayAlgorithmSTDBSCAN   = "st-dbscan"  // Density-based clustering in space and time
+	StayAlgorithmCBSMoT     = "cb-smot"    // Clustering of the slow parts of the trajectory
+)
+
+// StayPointAlgorithms lists the names of the stay point detectors
+var StayPointAlgorithms = []string{StayAlgorithmSequential, StayAlgorithmSTDBSCAN, StayAlgorithmCBSMoT}
+
+// stDBSCANMinPoints is the number of neighbors, the point included, that a core point of
+// ST-DBSCAN needs
+const stDBSCANMinPoints = 5
+
+// StayPointDetector finds the places where a trajectory stays. The returned stay points
+// carry no user or trajectory IDs.
+type StayPointDetector interface {
+	// Name returns the name the detector is selected by
+	Name() string
+	// Detect returns the stays of the points, in chronological order
+	Detect(points []models.GPSPoint) []models.StayPoint
+}
+
+// IsStayPointAlgorithm reports whether name selects a stay point detector
+func IsStayPointAlgorithm(name string) bool {
+	for _, algorithm := range StayPointAlgorithms {
+		if name == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// NewStayPointDetector returns the detector named by params.Algorithm, applying the
+// thresholds of params. An empty name selects the sequential detector.
+func NewStayPointDetector(params StayPointParams) (StayPointDetector, error) {
+	switch params.Algorithm {
+	case "", StayAlgorithmSequential:
+		return sequentialDetector{params: params}, nil
+	case StayAlgorithmSTDBSCAN:
+		return stDBSCANDetector{params: params}, nil
+	case StayAlgorithmCBSMoT:
+		return cbSMoTDetector{params: params}, nil
+	}
+	return nil, fmt.Errorf("unknown stay point algorithm %q", params.Algorithm)
+}
+
+// stDBSCANDetector clusters the points with ST-DBSCAN: two points are neighbors when they
+// lie within half the distance threshold of each other and within the time threshold of
+// each other. Clusters are split where the user left the place in between, and the parts
+// lasting at least the time threshold are stays. GPS drift only moves points around inside
+// the cluster, so it does not cut a stay short as it does for the sequential detector.
+type stDBSCANDetector struct {
+	params StayPointParams
+}
+
+func (d stDBSCANDetector) Name() string {
+	return StayAlgorithmSTDBSCAN
+}
+
+func (d stDBSCANDetector) Detect(points []models.GPSPoint) []models.StayPoint {
+	if len(points) < 2 {
+		return nil
+	}
+	points = chronological(points)
+	xy := projectPoints(points)
+	spatialEps, temporalEps := d.params.DistanceThreshold/2, d.params.TimeThreshold
+
+	// neighbors returns the points near i in space and time. Sampling rates differ a lot
+	// between loggers, so a core point also needs its neighbors to cover half the time
+	// threshold; by count alone every point of a densely sampled walk would be one.
+	neighbors := func(i int) ([]int, bool) {
+		var found []int
+		first, last := points[i].Timestamp, points[i].Timestamp
+		for j := i; j >= 0 && points[i].Timestamp.Sub(points[j].Timestamp) <= temporalEps; j-- {
+			if planarDistance(xy[i], xy[j]) <= spatialEps {
+				found = append(found, j)
+				first = points[j].Timestamp
+			}
+		}
+		for j := i + 1; j < len(points) && points[j].Timestamp.Sub(points[i].Timestamp) <= temporalEps; j++ {
+			if planarDistance(xy[i], xy[j]) <= spatialEps {
+				found = append(found, j)
+				last = points[j].Timestamp
+			}
+		}
+		return found, len(found) >= stDBSCANMinPoints && last.Sub(first) >= temporalEps/2
+	}
+
+	const unvisited, noise = 0, -1
+	labels := make([]int, len(points))
+	cluster := 0
+	for i := range points {
+		if labels[i] != unvisited {
+			continue
+		}
+		seeds, core := neighbors(i)
+		if !core {
+			labels[i] = noise
+			continue
+		}
+
+		cluster++
+		labels[i] = cluster
+		for len(seeds) > 0 {
+			j := seeds[len(seeds)-1]
+			seeds = seeds[:len(seeds)-1]
+			if labels[j] == noise {
+				labels[j] = cluster // Border point
+			}
+			if labels[j] != unvisited {
+				continue
+			}
+			labels[j] = cluster
+			if more, core := neighbors(j); core {
+				seeds = append(seeds, more...)
+			}
+		}
+	}
+
+	members := make(map[int][]int, cluster)
+	for i, label := range labels {
+		if label > 0 {
+			members[label] = append(members[label], i)
+		}
+	}
+
+	var stayPoints []models.StayPoint
+	for label := 1; label <= cluster; label++ {
+		indices := members[label]
+		start := 0
+		for k := 1; k <= len(indices); k++ {
+			if k < len(indices) && !d.leftBetween(xy, indices[k-1], indices[k]) {
+				continue
+			}
+			if run := indices[start:k]; points[run[len(run)-1]].Timestamp.Sub(points[run[0]].Timestamp) >= d.params.TimeThreshold {
+				stayPoints = append(stayPoints, newStayPoint(pick(points, run)))
+			}
+			start = k
+		}
+	}
+
+	sort.Slice(stayPoints, func(i, j int) bool {
+		return stayPoints[i].ArrivalTime.Before(stayPoints[j].ArrivalTime)
+	})
+	return stayPoints
+}
+
+// leftBetween reports whether a point recorded between members a and b of a cluster lies
+// farther than the distance threshold from a, i.e. the user went away and came back
+func (d stDBSCANDetector) leftBetween(xy []planarPoint, a, b int) bool {
+	for k := a + 1; k < b; k++ {
+		if planarDistance(xy[a], xy[k]) > d.params.DistanceThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// cbSMoTDetector implements CB-SMoT, which clusters the parts of a trajectory where it
+// moves slowly. The neighborhood of a point is the run of consecutive points around it
+// within half the distance threshold; the point is a core point when leaving that
+// neighborhood took long enough to mean moving slower than StopSpeed. Overlapping
+// neighborhoods of core points form a cluster, and clusters lasting at least the time
+// threshold are stays. A gap in the recording at the same place, e.g. indoors, makes the
+// points around it core points, so signal loss does not break a stay. Strolling slowly
+// around a place, such as through a market, also counts as a stay.
+type cbSMoTDetector struct {
+	params StayPointParams
+}
+
+func (d cbSMoTDetector) Name() string {
+	return StayAlgorithmCBSMoT
+}
+
+func (d cbSMoTDetector) Detect(points []models.GPSPoint) []models.StayPoint {
+	if len(points) < 2 {
+		return nil
+	}
+	points = chronological(points)
+	xy := projectPoints(points)
+	eps := d.params.DistanceThreshold / 2
+	minTime := time.Duration(2 * eps / StopSpeed * float64(time.Second))
+
+	var stayPoints []models.StayPoint
+	clusterStart, clusterEnd, lastEnd := -1, -1, -1
+	flush := func() {
+		if clusterStart >= 0 && points[clusterEnd].Timestamp.Sub(points[clusterStart].Timestamp) >= d.params.TimeThreshold {
+			stayPoints = append(stayPoints, newStayPoint(points[clusterStart:clusterEnd+1]))
+		}
+		lastEnd = clusterEnd
+		clusterStart, clusterEnd = -1, -1
+	}
+
+	for i := range points {
+		l, r := i, i
+		for l > 0 && planarDistance(xy[i], xy[l-1]) <= eps {
+			l--
+		}
+		for r < len(points)-1 && planarDistance(xy[i], xy[r+1]) <= eps {
+			r++
+		}
+		if points[r].Timestamp.Sub(points[l].Timestamp) < minTime {
+			continue
+		}
+
+		// A core neighborhood overlapping the current cluster extends it, one beyond it
+		// starts a new cluster. Stays never share points.
+		if clusterStart >= 0 && l > clusterEnd {
+			flush()
+		}
+		l = max(l, lastEnd+1)
+		if clusterStart < 0 {
+			clusterStart = l
+		}
+		clusterStart, clusterEnd = min(clusterStart, l), max(clusterEnd, r)
+	}
+	flush()
+
+	return stayPoints
+}
+
+// newStayPoint returns a stay at the mean position of chronologically ordered points
+func newStayPoint(points []models.GPSPoint) models.StayPoint {
+	var sumLat, sumLng float64
+	for _, p := range points {
+		sumLat += p.Latitude
+		sumLng += p.Longitude
+	}
+	count := float64(len(points))
+	return models.StayPoint{
+		Latitude:      sumLat / count,
+		Longitude:     sumLng / count,
+		ArrivalTime:   points[0].Timestamp,
+		DepartureTime: points[len(points)-1].Timestamp,
+	}
+}
+
+// chronological returns the points ordered by timestamp, sorting a copy when they are not
+func chronological(points []models.GPSPoint) []models.GPSPoint {
+	less := func(i, j int) bool {
+		return points[i].Timestamp.Before(points[j].Timestamp)
+	}
+	if sort.SliceIsSorted(points, less) {
+		return points
+	}
+
+	sorted := append([]models.GPSPoint(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+	return sorted
+}
+
+// pick returns the points at the given indices
+func pick(points []models.GPSPoint, indices []int) []models.GPSPoint {
+	picked := make([]models.GPSPoint, len(indices))
+	for i, index := range indices {
+		picked[i] = points[index]
+	}
+	return picked
+}
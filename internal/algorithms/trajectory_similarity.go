@@ -0,0 +1,216 @@
+package algorithms
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Trajectory distance measures
+const (
+	SimilarityDTW       = "dtw"       // Mean point distance along the best time warping
+	SimilarityFrechet   = "frechet"   // Discrete Fréchet distance, the shortest "dog leash"
+	SimilarityHausdorff = "hausdorff" // Largest distance from a point to the other trajectory
+	SimilarityLCSS      = "lcss"      // 1 - share of points matched by the longest common subsequence
+)
+
+// Default LCSS thresholds
+const (
+	DefaultLCSSEpsilon = 100.0 // meters
+	DefaultLCSSDelta   = 15 * time.Minute
+)
+
+// LCSSParams are the thresholds under which two points match in LCSS. Times are compared
+// relative to the start of each trajectory, so trips on different days can match; Delta 0
+// or a trajectory without timestamps disables the temporal threshold.
+type LCSSParams struct {
+	Epsilon float64 // Max distance in meters
+	Delta   time.Duration
+}
+
+// DefaultLCSSParams returns the thresholds used when none are configured
+func DefaultLCSSParams() LCSSParams {
+	return LCSSParams{Epsilon: DefaultLCSSEpsilon, Delta: DefaultLCSSDelta}
+}
+
+// IsSimilarityMeasure reports whether measure names a trajectory distance measure
+func IsSimilarityMeasure(measure string) bool {
+	switch measure {
+	case SimilarityDTW, SimilarityFrechet, SimilarityHausdorff, SimilarityLCSS:
+		return true
+	}
+	return false
+}
+
+// TrajectoryDistance compares two trajectories with the given measure. Lower is more
+// similar: DTW, Fréchet and Hausdorff return meters, LCSS a value between 0 and 1.
+func TrajectoryDistance(a, b []models.GPSPoint, measure string, lcss LCSSParams) (float64, error) {
+	if len(a) == 0 || len(b) == 0 {
+		return 0, fmt.Errorf("cannot compare empty trajectories")
+	}
+
+	switch measure {
+	case SimilarityDTW:
+		return DTW(a, b), nil
+	case SimilarityFrechet:
+		return DiscreteFrechet(a, b), nil
+	case SimilarityHausdorff:
+		return Hausdorff(a, b), nil
+	case SimilarityLCSS:
+		return 1 - LCSS(a, b, lcss), nil
+	}
+	return 0, fmt.Errorf("unknown similarity measure %q", measure)
+}
+
+// DTW returns the mean distance in meters between the points paired by dynamic time
+// warping. Averaging over the warping path keeps long and short trajectories comparable.
+func DTW(a, b []models.GPSPoint) float64 {
+	pa, pb := projectPair(a, b)
+	n, m := len(pa), len(pb)
+
+	// Two rows of the cost matrix with the length of the path leading to each cell
+	prevCost, curCost := make([]float64, m), make([]float64, m)
+	prevSteps, curSteps := make([]int, m), make([]int, m)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			d := planarDistance(pa[i], pb[j])
+			switch {
+			case i == 0 && j == 0:
+				curCost[j], curSteps[j] = d, 1
+			case i == 0:
+				curCost[j], curSteps[j] = curCost[j-1]+d, curSteps[j-1]+1
+			case j == 0:
+				curCost[j], curSteps[j] = prevCost[j]+d, prevSteps[j]+1
+			default:
+				cost, steps := prevCost[j-1], prevSteps[j-1]
+				if prevCost[j] < cost {
+					cost, steps = prevCost[j], prevSteps[j]
+				}
+				if curCost[j-1] < cost {
+					cost, steps = curCost[j-1], curSteps[j-1]
+				}
+				curCost[j], curSteps[j] = cost+d, steps+1
+			}
+		}
+		prevCost, curCost = curCost, prevCost
+		prevSteps, curSteps = curSteps, prevSteps
+	}
+
+	return prevCost[m-1] / float64(prevSteps[m-1])
+}
+
+// DiscreteFrechet returns the discrete Fréchet distance in meters
+func DiscreteFrechet(a, b []models.GPSPoint) float64 {
+	pa, pb := projectPair(a, b)
+	n, m := len(pa), len(pb)
+
+	prev, cur := make([]float64, m), make([]float64, m)
+	for i := 0; i < n; i++ {
+		for j := 0; j < m; j++ {
+			d := planarDistance(pa[i], pb[j])
+			switch {
+			case i == 0 && j == 0:
+				cur[j] = d
+			case i == 0:
+				cur[j] = math.Max(cur[j-1], d)
+			case j == 0:
+				cur[j] = math.Max(prev[j], d)
+			default:
+				cur[j] = math.Max(math.Min(prev[j-1], math.Min(prev[j], cur[j-1])), d)
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[m-1]
+}
+
+// Hausdorff returns the symmetric Hausdorff distance in meters between the points of two
+// trajectories, ignoring their order
+func Hausdorff(a, b []models.GPSPoint) float64 {
+	pa, pb := projectPair(a, b)
+	return math.Max(directedHausdorff(pa, pb), directedHausdorff(pb, pa))
+}
+
+// directedHausdorff returns the largest distance from a point of a to its nearest point of b
+func directedHausdorff(a, b []planarPoint) float64 {
+	maxDist := 0.0
+	for _, p := range a {
+		nearest := math.Inf(1)
+		for _, q := range b {
+			d := planarDistance(p, q)
+			if d < nearest {
+				nearest = d
+			}
+			// p cannot raise the maximum any more
+			if nearest <= maxDist {
+				break
+			}
+		}
+		if nearest > maxDist {
+			maxDist = nearest
+		}
+	}
+	return maxDist
+}
+
+// LCSS returns the length of the longest common subsequence of matching points divided by
+// the length of the shorter trajectory, between 0 (nothing in common) and 1
+func LCSS(a, b []models.GPSPoint, params LCSSParams) float64 {
+	pa, pb := projectPair(a, b)
+	n, m := len(pa), len(pb)
+
+	useTime := params.Delta > 0 && hasTimestamps(a) && hasTimestamps(b)
+	startA, startB := a[0].Timestamp, b[0].Timestamp
+
+	prev, cur := make([]int, m+1), make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		for j := 1; j <= m; j++ {
+			match := planarDistance(pa[i-1], pb[j-1]) <= params.Epsilon
+			if match && useTime {
+				offset := a[i-1].Timestamp.Sub(startA) - b[j-1].Timestamp.Sub(startB)
+				match = offset.Abs() <= params.Delta
+			}
+
+			if match {
+				cur[j] = prev[j-1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	return float64(prev[m]) / float64(min(n, m))
+}
+
+// Downsample keeps at most maxPoints evenly spaced points including the first and last,
+// bounding the quadratic cost of the distance measures
+func Downsample(points []models.GPSPoint, maxPoints int) []models.GPSPoint {
+	if maxPoints < 2 || len(points) <= maxPoints {
+		return points
+	}
+
+	sampled := make([]models.GPSPoint, maxPoints)
+	step := float64(len(points)-1) / float64(maxPoints-1)
+	for i := range sampled {
+		sampled[i] = points[int(math.Round(float64(i)*step))]
+	}
+	return sampled
+}
+
+// projectPair projects two trajectories on one local projection around the first point of a
+func projectPair(a, b []models.GPSPoint) ([]planarPoint, []planarPoint) {
+	return projectAround(a, a[0]), projectAround(b, a[0])
+}
+
+func planarDistance(p, q planarPoint) float64 {
+	return math.Hypot(p.x-q.x, p.y-q.y)
+}
+
+// hasTimestamps reports whether the points carry times, which drawn polylines do not
+func hasTimestamps(points []models.GPSPoint) bool {
+	return !points[0].Timestamp.IsZero() || !points[len(points)-1].Timestamp.IsZero()
+}
@@ -0,0 +1,124 @@
+package algorithms
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// TestTrajectoryDistance checks every measure on trajectories with known distances
+func TestTrajectoryDistance(t *testing.T) {
+	// 900 m east, a point every 100 m and 10 s
+	line := straightTrack(10, 10, 10)
+
+	shift := func(points [][3]float64, north float64) [][3]float64 {
+		shifted := make([][3]float64, len(points))
+		for i, p := range points {
+			shifted[i] = [3]float64{p[0], p[1] + north, p[2]}
+		}
+		return shifted
+	}
+
+	// The same line the other way
+	reversed := make([][3]float64, len(line))
+	for i, p := range line {
+		reversed[len(line)-1-i] = [3]float64{p[0], 0, 90 - p[2]}
+	}
+
+	// The same line with a point every 50 m
+	dense := straightTrack(19, 10, 5)
+
+	// The same line at half the speed
+	slow := straightTrack(10, 5, 20)
+
+	loose := LCSSParams{Epsilon: 100}
+	strict := LCSSParams{Epsilon: 50, Delta: 30 * time.Second}
+
+	tests := []struct {
+		name    string
+		a, b    [][3]float64
+		measure string
+		lcss    LCSSParams
+		want    float64
+	}{
+		{"dtw identical", line, line, SimilarityDTW, loose, 0},
+		{"frechet identical", line, line, SimilarityFrechet, loose, 0},
+		{"hausdorff identical", line, line, SimilarityHausdorff, loose, 0},
+		{"lcss identical", line, line, SimilarityLCSS, loose, 0},
+
+		{"dtw shifted 50 m", line, shift(line, 50), SimilarityDTW, loose, 50},
+		{"frechet shifted 50 m", line, shift(line, 50), SimilarityFrechet, loose, 50},
+		{"hausdorff shifted 50 m", line, shift(line, 50), SimilarityHausdorff, loose, 50},
+		{"lcss shifted within epsilon", line, shift(line, 50), SimilarityLCSS, loose, 0},
+		{"lcss shifted beyond epsilon", line, shift(line, 200), SimilarityLCSS, loose, 1},
+
+		{"frechet reversed", line, reversed, SimilarityFrechet, loose, 900},
+		{"hausdorff reversed", line, reversed, SimilarityHausdorff, loose, 0},
+
+		{"frechet denser sampling", line, dense, SimilarityFrechet, loose, 50},
+		{"hausdorff denser sampling", line, dense, SimilarityHausdorff, loose, 50},
+		{"dtw denser sampling", line, dense, SimilarityDTW, loose, 50.0 * 9 / 19},
+
+		{"lcss half speed", line, slow, SimilarityLCSS, LCSSParams{Epsilon: 50}, 0},
+		{"lcss half speed within delta", line, slow, SimilarityLCSS, strict, 0.6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TrajectoryDistance(testTrack(tt.a...), testTrack(tt.b...), tt.measure, tt.lcss)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Meters are compared to 0.5 m for the projection, LCSS shares exactly
+			tolerance := 0.5
+			if tt.measure == SimilarityLCSS {
+				tolerance = 1e-9
+			}
+			if math.Abs(got-tt.want) > tolerance {
+				t.Errorf("distance = %.2f, want %.2f", got, tt.want)
+			}
+
+			back, err := TrajectoryDistance(testTrack(tt.b...), testTrack(tt.a...), tt.measure, tt.lcss)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if math.Abs(back-got) > tolerance {
+				t.Errorf("distance = %.2f one way and %.2f the other", got, back)
+			}
+		})
+	}
+}
+
+// TestTrajectoryDistanceInvalid checks the rejected inputs
+func TestTrajectoryDistanceInvalid(t *testing.T) {
+	line := testTrack(straightTrack(10, 10, 10)...)
+
+	if _, err := TrajectoryDistance(line, nil, SimilarityDTW, DefaultLCSSParams()); err == nil {
+		t.Error("expected an error for an empty trajectory")
+	}
+	if _, err := TrajectoryDistance(line, line, "euclidean", DefaultLCSSParams()); err == nil {
+		t.Error("expected an error for an unknown measure")
+	}
+}
+
+// TestDownsample checks that downsampling keeps the ends and spaces the points evenly
+func TestDownsample(t *testing.T) {
+	points := testTrack(straightTrack(100, 10, 1)...)
+
+	sampled := Downsample(points, 10)
+	if len(sampled) != 10 {
+		t.Fatalf("kept %d points, want 10", len(sampled))
+	}
+	if sampled[0] != points[0] || sampled[9] != points[99] {
+		t.Error("the first and last points were not kept")
+	}
+	for i := 1; i < len(sampled); i++ {
+		if step := sampled[i].Timestamp.Sub(sampled[i-1].Timestamp); step < 10*time.Second || step > 12*time.Second {
+			t.Errorf("points %d and %d are %s apart", i-1, i, step)
+		}
+	}
+
+	if got := Downsample(points[:5], 10); len(got) != 5 {
+		t.Errorf("kept %d of 5 points, want all", len(got))
+	}
+}
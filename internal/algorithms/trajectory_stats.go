@@ -0,0 +1,80 @@
+package algorithms
+
+import (
+	"math"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+const (
+	// StopSpeed is the speed in m/s below which the time between two points counts as stopped
+	StopSpeed = 0.5
+	// ElevationNoise is the altitude change in meters ignored when summing elevation gain and
+	// loss, so that GPS altitude jitter on flat ground does not add up
+	ElevationNoise = 3.0
+	// minValidAltitude rejects sentinels such as GeoLife's -777 for unknown altitudes
+	minValidAltitude = -500.0
+)
+
+// TrajectoryStatistics summarizes chronologically ordered points. Time between two points
+// moving slower than StopSpeed counts as stopped, and MaxSpeed is the fastest speed between
+// two consecutive points.
+func TrajectoryStatistics(points []models.GPSPoint) models.TrajectoryStats {
+	stats := models.TrajectoryStats{PointCount: len(points)}
+	if len(points) == 0 {
+		return stats
+	}
+
+	stats.MinLatitude, stats.MaxLatitude = points[0].Latitude, points[0].Latitude
+	stats.MinLongitude, stats.MaxLongitude = points[0].Longitude, points[0].Longitude
+
+	elevationRef := math.NaN()
+	for i, p := range points {
+		stats.MinLatitude = math.Min(stats.MinLatitude, p.Latitude)
+		stats.MaxLatitude = math.Max(stats.MaxLatitude, p.Latitude)
+		stats.MinLongitude = math.Min(stats.MinLongitude, p.Longitude)
+		stats.MaxLongitude = math.Max(stats.MaxLongitude, p.Longitude)
+
+		if p.Altitude > minValidAltitude {
+			switch {
+			case math.IsNaN(elevationRef):
+				elevationRef = p.Altitude
+			case p.Altitude-elevationRef >= ElevationNoise:
+				stats.ElevationGain += p.Altitude - elevationRef
+				elevationRef = p.Altitude
+			case elevationRef-p.Altitude >= ElevationNoise:
+				stats.ElevationLoss += elevationRef - p.Altitude
+				elevationRef = p.Altitude
+			}
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		prev := points[i-1]
+		meters := Distance(prev.Latitude, prev.Longitude, p.Latitude, p.Longitude) * 1000
+		seconds := p.Timestamp.Sub(prev.Timestamp).Seconds()
+		stats.Length += meters
+		if seconds <= 0 {
+			continue
+		}
+
+		speed := meters / seconds
+		if speed >= StopSpeed {
+			stats.MovingTime += seconds
+		} else {
+			stats.StoppedTime += seconds
+		}
+		stats.MaxSpeed = math.Max(stats.MaxSpeed, speed)
+	}
+
+	if duration := stats.MovingTime + stats.StoppedTime; duration > 0 {
+		stats.AvgSpeed = stats.Length / duration
+	}
+	if stats.MovingTime > 0 {
+		stats.AvgMovingSpeed = stats.Length / stats.MovingTime
+	}
+
+	return stats
+}
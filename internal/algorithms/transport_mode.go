@@ -0,0 +1,333 @@
+package algorithms
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// ModeClassifierParams holds the thresholds of the transportation mode classifier.
+// Speeds are in m/s, accelerations in m/s², distances in meters and rates per kilometer.
+type ModeClassifierParams struct {
+	// Segmentation into walk and non-walk segments
+	WalkSpeed          float64       // Maximum speed of a walk point
+	WalkAcceleration   float64       // Maximum acceleration of a walk point
+	MinSegmentDistance float64       // Shorter segments are merged into their neighbours
+	MinSegmentDuration time.Duration // Briefer segments are merged into their neighbours
+	MaxGap             time.Duration // A larger gap between two points always starts a new segment
+
+	// Per-point events counted by the rate features
+	StopSpeed           float64 // Points slower than this are stops
+	HeadingChangeAngle  float64 // Heading changes above this angle (degrees) are counted
+	VelocityChangeRatio float64 // Relative speed changes above this ratio are counted
+	MinHeadingMoveSpeed float64 // Heading is ignored below this speed since it is mostly noise
+	MaxPlausibleSpeed   float64 // Faster point speeds are treated as GPS errors
+	SpeedPercentile     float64 // Percentile used as the representative segment speed
+
+	// Decision rules on segment features
+	WalkSegmentSpeed      float64 // Representative speed up to which a segment is a walk
+	BikeSegmentSpeed      float64 // Representative speed up to which a segment is a bike ride
+	CarSegmentSpeed       float64 // Representative speed from which road segments are cars
+	TrainSegmentSpeed     float64 // Representative speed from which rail segments are trains
+	AirplaneSpeed         float64 // Maximum speed from which a segment is a flight
+	RailHeadingChangeRate float64 // Maximum heading change rate of a rail segment
+	RailStopRate          float64 // Maximum stop rate of a rail segment
+	BusStopRate           float64 // Minimum stop rate of a bus segment
+}
+
+// DefaultModeClassifierParams returns thresholds following the walk-based segmentation
+// used on GeoLife; cmd/evaluate_modes reports how they perform on the labelled users
+func DefaultModeClassifierParams() ModeClassifierParams {
+	return ModeClassifierParams{
+		WalkSpeed:          2.0,
+		WalkAcceleration:   1.0,
+		MinSegmentDistance: 200,
+		MinSegmentDuration: 90 * time.Second,
+		MaxGap:             20 * time.Minute,
+
+		StopSpeed:           0.6,
+		HeadingChangeAngle:  19,
+		VelocityChangeRatio: 0.26,
+		MinHeadingMoveSpeed: 1.0,
+		MaxPlausibleSpeed:   300,
+		SpeedPercentile:     0.85,
+
+		WalkSegmentSpeed:      2.5,
+		BikeSegmentSpeed:      6.5,
+		CarSegmentSpeed:       16,
+		TrainSegmentSpeed:     25,
+		AirplaneSpeed:         70,
+		RailHeadingChangeRate: 8,
+		RailStopRate:          4,
+		BusStopRate:           10,
+	}
+}
+
+// ModeFeatures describes the motion of a trajectory segment
+type ModeFeatures struct {
+	Points             int           `json:"points"`
+	Distance           float64       `json:"distance"`             // meters
+	Duration           time.Duration `json:"duration"`             // total time
+	MeanSpeed          float64       `json:"mean_speed"`           // m/s
+	PercentileSpeed    float64       `json:"percentile_speed"`     // m/s, see SpeedPercentile
+	MaxSpeed           float64       `json:"max_speed"`            // m/s
+	MaxAcceleration    float64       `json:"max_acceleration"`     // m/s²
+	HeadingChangeRate  float64       `json:"heading_change_rate"`  // heading changes per km
+	StopRate           float64       `json:"stop_rate"`            // stops per km
+	VelocityChangeRate float64       `json:"velocity_change_rate"` // large speed changes per km
+}
+
+// ModeSegment is a part of a trajectory travelled with a single inferred mode
+type ModeSegment struct {
+	StartIndex int
+	EndIndex   int
+	StartTime  time.Time
+	EndTime    time.Time
+	Mode       models.TransportMode
+	Features   ModeFeatures
+}
+
+// pointMotion holds the motion of a point relative to its predecessor
+type pointMotion struct {
+	distance     float64 // meters
+	speed        float64 // m/s
+	acceleration float64 // m/s²
+	heading      float64 // degrees, NaN when unknown
+	gap          time.Duration
+}
+
+// ClassifyTransportModes splits chronologically ordered points into walk and non-walk
+// segments and infers the transportation mode of each segment from its speed,
+// acceleration, heading change rate and stop rate.
+func ClassifyTransportModes(points []models.GPSPoint, params ModeClassifierParams) []ModeSegment {
+	if len(points) < 2 {
+		return nil
+	}
+
+	motions := computeMotions(points, params)
+
+	// Label each point as walk or non-walk and split on changes and gaps
+	var bounds [][2]int
+	start := 0
+	walk := isWalkMotion(motions[1], params)
+	for i := 1; i < len(points); i++ {
+		w := isWalkMotion(motions[i], params)
+		if motions[i].gap > params.MaxGap {
+			bounds = append(bounds, [2]int{start, i - 1})
+			start = i
+			walk = w
+			continue
+		}
+		if w != walk {
+			// The motion into point i belongs to the new segment, which starts at i-1
+			bounds = append(bounds, [2]int{start, i - 1})
+			start = i - 1
+			walk = w
+		}
+	}
+	bounds = append(bounds, [2]int{start, len(points) - 1})
+
+	bounds = mergeShortSegments(points, motions, bounds, params)
+
+	segments := make([]ModeSegment, 0, len(bounds))
+	for _, b := range bounds {
+		if b[0] == b[1] {
+			// An isolated point between two gaps has no motion to classify
+			continue
+		}
+		features := segmentFeatures(points, motions, b[0], b[1], params)
+		segments = append(segments, ModeSegment{
+			StartIndex: b[0],
+			EndIndex:   b[1],
+			StartTime:  points[b[0]].Timestamp,
+			EndTime:    points[b[1]].Timestamp,
+			Mode:       ClassifyModeFeatures(features, params),
+			Features:   features,
+		})
+	}
+
+	if len(segments) == 0 {
+		return nil
+	}
+
+	// Adjacent segments that ended up with the same mode form one segment
+	merged := segments[:1]
+	for _, segment := range segments[1:] {
+		last := &merged[len(merged)-1]
+		if segment.Mode == last.Mode && segment.StartIndex <= last.EndIndex+1 &&
+			motions[segment.StartIndex].gap <= params.MaxGap {
+			last.EndIndex = segment.EndIndex
+			last.EndTime = segment.EndTime
+			last.Features = segmentFeatures(points, motions, last.StartIndex, last.EndIndex, params)
+			continue
+		}
+		merged = append(merged, segment)
+	}
+
+	return merged
+}
+
+// ModeFeaturesOf computes the features of a whole point sequence
+func ModeFeaturesOf(points []models.GPSPoint, params ModeClassifierParams) ModeFeatures {
+	if len(points) == 0 {
+		return ModeFeatures{}
+	}
+	motions := computeMotions(points, params)
+	return segmentFeatures(points, motions, 0, len(points)-1, params)
+}
+
+// ClassifyModeFeatures infers the transportation mode of a segment from its features
+func ClassifyModeFeatures(f ModeFeatures, params ModeClassifierParams) models.TransportMode {
+	switch {
+	case f.PercentileSpeed <= params.WalkSegmentSpeed:
+		return models.ModeWalk
+	case f.MaxSpeed >= params.AirplaneSpeed:
+		return models.ModeAirplane
+	case f.PercentileSpeed <= params.BikeSegmentSpeed && f.StopRate < params.BusStopRate:
+		return models.ModeBike
+	case f.HeadingChangeRate <= params.RailHeadingChangeRate && f.StopRate <= params.RailStopRate:
+		// Rail vehicles rarely turn or stop between stations
+		if f.PercentileSpeed >= params.TrainSegmentSpeed {
+			return models.ModeTrain
+		}
+		return models.ModeSubway
+	case f.PercentileSpeed >= params.CarSegmentSpeed || f.StopRate < params.BusStopRate:
+		return models.ModeCar
+	default:
+		return models.ModeBus
+	}
+}
+
+// computeMotions calculates the speed, acceleration and heading of each point
+func computeMotions(points []models.GPSPoint, params ModeClassifierParams) []pointMotion {
+	motions := make([]pointMotion, len(points))
+	motions[0].heading = math.NaN()
+
+	for i := 1; i < len(points); i++ {
+		m := &motions[i]
+		m.distance = Distance(points[i-1].Latitude, points[i-1].Longitude, points[i].Latitude, points[i].Longitude) * 1000
+		m.gap = points[i].Timestamp.Sub(points[i-1].Timestamp)
+		m.heading = math.NaN()
+
+		seconds := m.gap.Seconds()
+		if seconds <= 0 {
+			// Duplicate timestamps carry no speed information
+			m.speed = motions[i-1].speed
+		} else {
+			m.speed = m.distance / seconds
+			if m.speed > params.MaxPlausibleSpeed {
+				m.speed = motions[i-1].speed
+			}
+			m.acceleration = math.Abs(m.speed-motions[i-1].speed) / seconds
+		}
+
+		if m.speed >= params.MinHeadingMoveSpeed {
+			m.heading = bearing(points[i-1], points[i])
+		}
+	}
+
+	return motions
+}
+
+// isWalkMotion reports whether a point moves like a pedestrian
+func isWalkMotion(m pointMotion, params ModeClassifierParams) bool {
+	return m.speed <= params.WalkSpeed && m.acceleration <= params.WalkAcceleration
+}
+
+// mergeShortSegments merges segments that are too short or too brief into the preceding
+// segment, or into the following one for a leading segment
+func mergeShortSegments(points []models.GPSPoint, motions []pointMotion, bounds [][2]int, params ModeClassifierParams) [][2]int {
+	isShort := func(b [2]int) bool {
+		distance := 0.0
+		for i := b[0] + 1; i <= b[1]; i++ {
+			distance += motions[i].distance
+		}
+		duration := points[b[1]].Timestamp.Sub(points[b[0]].Timestamp)
+		return distance < params.MinSegmentDistance || duration < params.MinSegmentDuration
+	}
+	contiguous := func(a, b [2]int) bool {
+		return b[0] <= a[1] || motions[b[0]].gap <= params.MaxGap
+	}
+
+	var merged [][2]int
+	for _, b := range bounds {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if (isShort(b) || isShort(*last)) && contiguous(*last, b) {
+				last[1] = b[1]
+				continue
+			}
+		}
+		merged = append(merged, b)
+	}
+	return merged
+}
+
+// segmentFeatures computes the features of points[start..end]
+func segmentFeatures(points []models.GPSPoint, motions []pointMotion, start, end int, params ModeClassifierParams) ModeFeatures {
+	f := ModeFeatures{
+		Points:   end - start + 1,
+		Duration: points[end].Timestamp.Sub(points[start].Timestamp),
+	}
+
+	var speeds []float64
+	var stops, headingChanges, velocityChanges int
+	lastHeading := math.NaN()
+	for i := start + 1; i <= end; i++ {
+		m := motions[i]
+		f.Distance += m.distance
+		speeds = append(speeds, m.speed)
+		f.MaxSpeed = math.Max(f.MaxSpeed, m.speed)
+		f.MaxAcceleration = math.Max(f.MaxAcceleration, m.acceleration)
+
+		if m.speed < params.StopSpeed {
+			stops++
+		}
+		if prev := motions[i-1].speed; i > start+1 && prev > 0 && math.Abs(m.speed-prev)/prev > params.VelocityChangeRatio {
+			velocityChanges++
+		}
+		if !math.IsNaN(m.heading) {
+			if !math.IsNaN(lastHeading) && headingDifference(lastHeading, m.heading) > params.HeadingChangeAngle {
+				headingChanges++
+			}
+			lastHeading = m.heading
+		}
+	}
+
+	if f.Duration > 0 {
+		f.MeanSpeed = f.Distance / f.Duration.Seconds()
+	}
+	if len(speeds) > 0 {
+		sort.Float64s(speeds)
+		f.PercentileSpeed = speeds[int(params.SpeedPercentile*float64(len(speeds)-1))]
+	}
+	if km := f.Distance / 1000; km > 0 {
+		f.HeadingChangeRate = float64(headingChanges) / km
+		f.StopRate = float64(stops) / km
+		f.VelocityChangeRate = float64(velocityChanges) / km
+	}
+
+	return f
+}
+
+// bearing returns the initial bearing from a to b in degrees
+func bearing(a, b models.GPSPoint) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	y := math.Sin(dLon) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// headingDifference returns the absolute angle between two headings in degrees
+func headingDifference(a, b float64) float64 {
+	d := math.Abs(a - b)
+	if d > 180 {
+		d = 360 - d
+	}
+	return d
+}
@@ -0,0 +1,134 @@
+package algorithms
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// ClassifierModes lists the modes ClassifyModeFeatures can predict
+var ClassifierModes = []models.TransportMode{
+	models.ModeWalk,
+	models.ModeBike,
+	models.ModeBus,
+	models.ModeCar,
+	models.ModeSubway,
+	models.ModeTrain,
+	models.ModeAirplane,
+}
+
+// EvaluationMode maps a ground-truth label onto the modes the classifier can predict.
+// It returns false for labels that have no counterpart, such as boat.
+func EvaluationMode(label models.TransportMode) (models.TransportMode, bool) {
+	switch label {
+	case models.ModeTaxi:
+		return models.ModeCar, true
+	case models.ModeRun:
+		return models.ModeWalk, true
+	}
+	for _, mode := range ClassifierModes {
+		if mode == label {
+			return mode, true
+		}
+	}
+	return "", false
+}
+
+// ModeConfusionMatrix counts predicted modes against ground-truth modes
+type ModeConfusionMatrix struct {
+	Modes  []models.TransportMode
+	Counts map[models.TransportMode]map[models.TransportMode]int
+}
+
+// NewModeConfusionMatrix creates an empty confusion matrix over the given modes
+func NewModeConfusionMatrix(modes []models.TransportMode) *ModeConfusionMatrix {
+	counts := make(map[models.TransportMode]map[models.TransportMode]int, len(modes))
+	for _, mode := range modes {
+		counts[mode] = make(map[models.TransportMode]int, len(modes))
+	}
+	return &ModeConfusionMatrix{Modes: modes, Counts: counts}
+}
+
+// Add records a prediction
+func (m *ModeConfusionMatrix) Add(truth, predicted models.TransportMode, count int) {
+	row, ok := m.Counts[truth]
+	if !ok {
+		return
+	}
+	row[predicted] += count
+}
+
+// Total returns the number of recorded predictions
+func (m *ModeConfusionMatrix) Total() int {
+	total := 0
+	for _, row := range m.Counts {
+		for _, count := range row {
+			total += count
+		}
+	}
+	return total
+}
+
+// Accuracy returns the share of correct predictions
+func (m *ModeConfusionMatrix) Accuracy() float64 {
+	total := m.Total()
+	if total == 0 {
+		return 0
+	}
+	correct := 0
+	for _, mode := range m.Modes {
+		correct += m.Counts[mode][mode]
+	}
+	return float64(correct) / float64(total)
+}
+
+// Precision returns the share of predictions of a mode that were correct
+func (m *ModeConfusionMatrix) Precision(mode models.TransportMode) float64 {
+	predicted := 0
+	for _, truth := range m.Modes {
+		predicted += m.Counts[truth][mode]
+	}
+	if predicted == 0 {
+		return 0
+	}
+	return float64(m.Counts[mode][mode]) / float64(predicted)
+}
+
+// Recall returns the share of a ground-truth mode that was predicted correctly
+func (m *ModeConfusionMatrix) Recall(mode models.TransportMode) float64 {
+	actual := 0
+	for _, count := range m.Counts[mode] {
+		actual += count
+	}
+	if actual == 0 {
+		return 0
+	}
+	return float64(m.Counts[mode][mode]) / float64(actual)
+}
+
+// Write prints the matrix with ground truth as rows and predictions as columns,
+// followed by per-mode precision and recall
+func (m *ModeConfusionMatrix) Write(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%-10s", "truth\\pred")
+	for _, mode := range m.Modes {
+		fmt.Fprintf(&b, "%10s", mode)
+	}
+	fmt.Fprintf(&b, "%10s%10s\n", "precision", "recall")
+
+	for _, truth := range m.Modes {
+		fmt.Fprintf(&b, "%-10s", truth)
+		for _, predicted := range m.Modes {
+			fmt.Fprintf(&b, "%10d", m.Counts[truth][predicted])
+		}
+		fmt.Fprintf(&b, "%10.3f%10.3f\n", m.Precision(truth), m.Recall(truth))
+	}
+
+	fmt.Fprintf(&b, "\nTotal: %d  Accuracy: %.3f\n", m.Total(), m.Accuracy())
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,155 @@
+package algorithms
+
+import (
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Reasons a trip starts or ends
+const (
+	TripBoundaryStreamStart = "stream_start" // First point of the point stream
+	TripBoundaryStreamEnd   = "stream_end"   // Last point of the point stream
+	TripBoundaryStay        = "stay"         // Departure from or arrival at a stay point
+	TripBoundaryTimeGap     = "time_gap"     // No points for longer than MaxGap
+	TripBoundarySignalLoss  = "signal_loss"  // A shorter gap over which the position jumped
+)
+
+// TripParams configures SegmentTrips
+type TripParams struct {
+	MaxGap             time.Duration // Gaps longer than this always end a trip
+	SignalLossGap      time.Duration // Gaps longer than this end a trip when the position jumps
+	SignalLossDistance float64       // Jump in meters over a SignalLossGap that counts as signal loss
+	MinTripPoints      int           // Shorter pieces, e.g. jitter between two stays, are dropped
+	MinTripDuration    time.Duration
+}
+
+// DefaultTripParams returns the parameters used when none are configured
+func DefaultTripParams() TripParams {
+	return TripParams{
+		MaxGap:             20 * time.Minute,
+		SignalLossGap:      2 * time.Minute,
+		SignalLossDistance: 500,
+		MinTripPoints:      5,
+		MinTripDuration:    time.Minute,
+	}
+}
+
+// Trip is a contiguous range of points between two trip boundaries
+type Trip struct {
+	StartIndex  int // Index of the first point, inclusive
+	EndIndex    int // Index of the last point, inclusive
+	StartTime   time.Time
+	EndTime     time.Time
+	StartReason string
+	EndReason   string
+	StartStay   int // Index of the stay point the trip departs from, -1 if none
+	EndStay     int // Index of the stay point the trip arrives at, -1 if none
+}
+
+// SegmentTrips splits chronologically ordered points into trips. A trip ends when the
+// points enter a stay, when no point was recorded for longer than MaxGap, or on signal
+// loss. Points recorded during a stay belong to no trip, except that the trip before a
+// stay ends at its arrival point and the trip after it starts at its departure point.
+func SegmentTrips(points []models.GPSPoint, stayPoints []models.StayPoint, params TripParams) []Trip {
+	stayOf := assignPointsToStays(points, stayPoints)
+
+	var trips []Trip
+	closeTrip := func(start, end int, startReason, endReason string, startStay, endStay int) {
+		if end-start+1 < params.MinTripPoints {
+			return
+		}
+		if points[end].Timestamp.Sub(points[start].Timestamp) < params.MinTripDuration {
+			return
+		}
+		trips = append(trips, Trip{
+			StartIndex:  start,
+			EndIndex:    end,
+			StartTime:   points[start].Timestamp,
+			EndTime:     points[end].Timestamp,
+			StartReason: startReason,
+			EndReason:   endReason,
+			StartStay:   startStay,
+			EndStay:     endStay,
+		})
+	}
+
+	start := -1
+	startReason, startStay := TripBoundaryStreamStart, -1
+	for i := range points {
+		if s := stayOf[i]; s >= 0 {
+			// The first point of a stay is the arrival point of the open trip
+			if start >= 0 {
+				closeTrip(start, i, startReason, TripBoundaryStay, startStay, s)
+				start = -1
+			}
+			startReason, startStay = TripBoundaryStay, s
+			continue
+		}
+
+		if start < 0 {
+			start = i
+			if i > 0 {
+				// Leaving a stay, the trip starts at the stay's departure point unless the
+				// points were lost in between
+				if reason := tripGap(points[i-1], points[i], params); reason != "" {
+					startReason, startStay = reason, -1
+				} else {
+					start = i - 1
+				}
+			}
+			continue
+		}
+
+		if reason := tripGap(points[i-1], points[i], params); reason != "" {
+			closeTrip(start, i-1, startReason, reason, startStay, -1)
+			start = i
+			startReason, startStay = reason, -1
+		}
+	}
+
+	if start >= 0 {
+		closeTrip(start, len(points)-1, startReason, TripBoundaryStreamEnd, startStay, -1)
+	}
+
+	return trips
+}
+
+// tripGap returns the boundary reason between two consecutive points, or "" if the trip continues
+func tripGap(prev, next models.GPSPoint, params TripParams) string {
+	gap := next.Timestamp.Sub(prev.Timestamp)
+	if params.MaxGap > 0 && gap > params.MaxGap {
+		return TripBoundaryTimeGap
+	}
+	if params.SignalLossGap > 0 && gap > params.SignalLossGap &&
+		Distance(prev.Latitude, prev.Longitude, next.Latitude, next.Longitude)*1000 > params.SignalLossDistance {
+		return TripBoundarySignalLoss
+	}
+	return ""
+}
+
+// assignPointsToStays returns for each point the index of the stay point whose time range
+// contains it, or -1
+func assignPointsToStays(points []models.GPSPoint, stayPoints []models.StayPoint) []int {
+	order := make([]int, len(stayPoints))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return stayPoints[order[a]].ArrivalTime.Before(stayPoints[order[b]].ArrivalTime)
+	})
+
+	stayOf := make([]int, len(points))
+	k := 0
+	for i, p := range points {
+		for k < len(order) && stayPoints[order[k]].DepartureTime.Before(p.Timestamp) {
+			k++
+		}
+		stayOf[i] = -1
+		if k < len(order) && !p.Timestamp.Before(stayPoints[order[k]].ArrivalTime) {
+			stayOf[i] = order[k]
+		}
+	}
+	return stayOf
+}
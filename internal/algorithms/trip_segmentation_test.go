@@ -0,0 +1,130 @@
+package algorithms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// TestSegmentTrips checks the trips and their boundaries found with the default parameters
+func TestSegmentTrips(t *testing.T) {
+	// 30 points at 10 m/s, one every 10 s
+	drive := straightTrack(30, 10, 10)
+
+	// The same with no point for 30 minutes after point 14
+	gap := straightTrack(30, 10, 10)
+	for i := 15; i < len(gap); i++ {
+		gap[i][2] += 30 * 60
+	}
+
+	// The same with no point for 5 minutes after point 14, over which the position jumps 3 km
+	signalLoss := straightTrack(30, 10, 10)
+	for i := 15; i < len(signalLoss); i++ {
+		signalLoss[i][0] += 3000
+		signalLoss[i][2] += 5 * 60
+	}
+
+	// The same with no point for 5 minutes after point 14, at about the same position
+	pause := straightTrack(30, 10, 10)
+	for i := 15; i < len(pause); i++ {
+		pause[i][2] += 5 * 60
+	}
+
+	// The same standing still at 1 km from point 10 to 19, e.g. during a stay
+	stop := straightTrack(30, 10, 10)
+	for i := 10; i < len(stop); i++ {
+		stop[i][0] = 1000 + 100*float64(max(i-19, 0))
+	}
+	stay := func(points [][3]float64, arrival, departure int) []models.StayPoint {
+		return []models.StayPoint{{
+			ArrivalTime:   testStart.Add(time.Duration(points[arrival][2]) * time.Second),
+			DepartureTime: testStart.Add(time.Duration(points[departure][2]) * time.Second),
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		points [][3]float64
+		stays  []models.StayPoint
+		want   []Trip // Only indices, reasons and stays are compared
+	}{
+		{
+			name:   "one drive",
+			points: drive,
+			want:   []Trip{{0, 29, time.Time{}, time.Time{}, TripBoundaryStreamStart, TripBoundaryStreamEnd, -1, -1}},
+		},
+		{
+			name:   "time gap",
+			points: gap,
+			want: []Trip{
+				{0, 14, time.Time{}, time.Time{}, TripBoundaryStreamStart, TripBoundaryTimeGap, -1, -1},
+				{15, 29, time.Time{}, time.Time{}, TripBoundaryTimeGap, TripBoundaryStreamEnd, -1, -1},
+			},
+		},
+		{
+			name:   "signal loss",
+			points: signalLoss,
+			want: []Trip{
+				{0, 14, time.Time{}, time.Time{}, TripBoundaryStreamStart, TripBoundarySignalLoss, -1, -1},
+				{15, 29, time.Time{}, time.Time{}, TripBoundarySignalLoss, TripBoundaryStreamEnd, -1, -1},
+			},
+		},
+		{
+			name:   "short gap without a jump",
+			points: pause,
+			want:   []Trip{{0, 29, time.Time{}, time.Time{}, TripBoundaryStreamStart, TripBoundaryStreamEnd, -1, -1}},
+		},
+		{
+			name:   "stay",
+			points: stop,
+			stays:  stay(stop, 10, 19),
+			want: []Trip{
+				{0, 10, time.Time{}, time.Time{}, TripBoundaryStreamStart, TripBoundaryStay, -1, 0},
+				{19, 29, time.Time{}, time.Time{}, TripBoundaryStay, TripBoundaryStreamEnd, 0, -1},
+			},
+		},
+		{
+			name:   "too few points before a stay",
+			points: stop,
+			stays:  stay(stop, 3, 19),
+			want:   []Trip{{19, 29, time.Time{}, time.Time{}, TripBoundaryStay, TripBoundaryStreamEnd, 0, -1}},
+		},
+		{
+			name:   "too short before a stay",
+			points: stop,
+			stays:  stay(stop, 5, 19),
+			want:   []Trip{{19, 29, time.Time{}, time.Time{}, TripBoundaryStay, TripBoundaryStreamEnd, 0, -1}},
+		},
+		{
+			name:   "stay over the whole stream",
+			points: stop,
+			stays:  stay(stop, 0, 29),
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := testTrack(tt.points...)
+			trips := SegmentTrips(points, tt.stays, DefaultTripParams())
+
+			if len(trips) != len(tt.want) {
+				t.Fatalf("got %d trips %+v, want %d", len(trips), trips, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := trips[i]
+				if got.StartIndex != want.StartIndex || got.EndIndex != want.EndIndex ||
+					got.StartReason != want.StartReason || got.EndReason != want.EndReason ||
+					got.StartStay != want.StartStay || got.EndStay != want.EndStay {
+					t.Errorf("trip %d = points %d-%d (%s to %s, stays %d to %d), want points %d-%d (%s to %s, stays %d to %d)",
+						i, got.StartIndex, got.EndIndex, got.StartReason, got.EndReason, got.StartStay, got.EndStay,
+						want.StartIndex, want.EndIndex, want.StartReason, want.EndReason, want.StartStay, want.EndStay)
+				}
+				if !got.StartTime.Equal(points[got.StartIndex].Timestamp) || !got.EndTime.Equal(points[got.EndIndex].Timestamp) {
+					t.Errorf("trip %d runs from %s to %s, not the times of its points", i, got.StartTime, got.EndTime)
+				}
+			}
+		})
+	}
+}
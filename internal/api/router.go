@@ -22,6 +22,7 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 	trajectoryService := services.NewTrajectoryServices(db)
 	stayPointServices := services.NewStayPointServices(db)
 	locationService := services.NewLocationServices(db.DB)
+	segmentService := services.NewTrajectorySegmentServices(db)
 
 	// Create new service instance for user profile management
 	userProfileService := services.NewUserServices(db)
@@ -32,13 +33,38 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 
 	findHandler := handlers.NewFindHandler(findServices)
 	recommendationService := services.NewRecommendationService(db, similarityService, frameworkService, stayPointServices, locationService)
-	recommendationHandler := handlers.NewRecommendHandler(recommendationService)
+	recommendationHandler := handlers.NewRecommendHandler(recommendationService, frameworkService)
 	authHandler := handlers.NewAuthHandler(authService)
 
 	// Create handlers for user settings functionality
 	userHandler := handlers.NewUserHandler(authService, userProfileService)
 	locationHandler := handlers.NewLocationHandler(locationService)
-	trajectoryHandler := handlers.NewTrajectoryHandler(trajectoryService)
+	trajectoryHandler := handlers.NewTrajectoryHandler(trajectoryService, segmentService)
+
+	// Trajectory file import
+	importService := services.NewImportServices(trajectoryService, stayPointServices, locationService, segmentService)
+	importHandler := handlers.NewImportHandler(importService)
+
+	// Trajectory file export
+	exportHandler := handlers.NewExportHandler(trajectoryService, stayPointServices)
+
+	// Live tracking sessions
+	trackingService := services.NewTrackingServices(db)
+	trackingHandler := handlers.NewTrackingHandler(trackingService, segmentService)
+
+	// Tracking devices and OwnTracks ingestion
+	deviceService := services.NewDeviceServices(db)
+	deviceHandler := handlers.NewDeviceHandler(deviceService)
+	ownTracksHandler := handlers.NewOwnTracksHandler(deviceService, trackingService)
+
+	// Radius searches over stay points
+	stayPointHandler := handlers.NewStayPointHandler(stayPointServices, userService)
+
+	// Transportation-mode segments
+	segmentHandler := handlers.NewSegmentHandler(trajectoryService, segmentService)
+
+	// Hierarchical framework navigation
+	frameworkHandler := handlers.NewHierarchicalFrameworkHandler(frameworkService, stayPointServices)
 
 	// JWT middleware
 	jwtMiddleware := middleware.JWTAuth(authService)
@@ -76,6 +102,16 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 		{
 			locations.GET("", locationHandler.GetUserLocations)
 			locations.POST("", locationHandler.CreateLocation)
+			locations.GET("/nearby", locationHandler.FindNearbyLocations)
+			locations.GET("/most-visited", locationHandler.FindMostVisitedLocations)
+		}
+
+		// Stay point search endpoints
+		staypoints := api.Group("/staypoints")
+		staypoints.Use(jwtMiddleware)
+		{
+			staypoints.GET("/nearby", stayPointHandler.FindNearbyStayPoints)
+			staypoints.GET("/popular", stayPointHandler.FindPopularPlaces)
 		}
 
 		// Trajectory management endpoints
@@ -84,8 +120,32 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 		{
 			trajectories.GET("", trajectoryHandler.GetUserTrajectories)
 			trajectories.POST("", trajectoryHandler.CreateTrajectory)
+			trajectories.GET("/search", trajectoryHandler.SearchTrajectories)
+			trajectories.POST("/similar", trajectoryHandler.FindSimilarTrajectories)
+			trajectories.POST("/import", importHandler.ImportTrajectories)
+			trajectories.POST("/import/takeout", importHandler.ImportTakeout)
+			trajectories.GET("/:id/export", exportHandler.ExportTrajectory)
+			trajectories.GET("/:id/segments", segmentHandler.GetTrajectorySegments)
+			trajectories.POST("/:id/split", trajectoryHandler.SplitTrajectory)
+			trajectories.GET("/:id/position", trajectoryHandler.GetTrajectoryPosition)
+			trajectories.GET("/:id/similar", trajectoryHandler.GetSimilarTrajectories)
+			trajectories.POST("/sessions", trackingHandler.StartSession)
+			trajectories.POST("/:id/points", trackingHandler.AppendPoints)
+			trajectories.POST("/:id/close", trackingHandler.CloseSession)
 		}
 
+		// Tracking device management endpoints
+		devices := api.Group("/devices")
+		devices.Use(jwtMiddleware)
+		{
+			devices.GET("", deviceHandler.GetDevices)
+			devices.POST("", deviceHandler.CreateDevice)
+			devices.DELETE("/:id", deviceHandler.DeleteDevice)
+		}
+
+		// OwnTracks HTTP mode endpoint, authenticated by device token or Basic auth
+		api.POST("/owntracks", middleware.DeviceAuth(authService, deviceService), ownTracksHandler.Publish)
+
 		// Protected routes that require authentication
 		protectedLocation := api.Group("/location")
 		protectedLocation.Use(jwtMiddleware)
@@ -99,11 +159,11 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 	adminHandler := handlers.NewAdminHandler(userService, locationService, trajectoryService)
 
 	// Admin page
-	router.GET("/admin", middleware.JWTAuth(authService), adminHandler.AdminPage)
+	router.GET("/admin", middleware.JWTAuth(authService), middleware.AdminAuthMiddleware(authService), adminHandler.AdminPage)
 
-	// Admin API routes
+	// Admin API routes, for users with the admin role only
 	adminGroup := router.Group("/api/admin")
-	adminGroup.Use(middleware.JWTAuth(authService))
+	adminGroup.Use(middleware.JWTAuth(authService), middleware.AdminAuthMiddleware(authService))
 	{
 		// User management
 		adminGroup.GET("/users/count", adminHandler.GetUserCount)
@@ -112,6 +172,27 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 		adminGroup.POST("/users", adminHandler.CreateUser)
 		adminGroup.PUT("/users/:id", adminHandler.UpdateUser)
 		adminGroup.DELETE("/users/:id", adminHandler.DeleteUser)
+		adminGroup.GET("/users/:id/staypoint-settings", stayPointHandler.AdminGetUserStayPointSettings)
+		adminGroup.PUT("/users/:id/staypoint-settings", stayPointHandler.AdminUpdateUserStayPointSettings)
+		adminGroup.DELETE("/users/:id/staypoint-settings", stayPointHandler.AdminDeleteUserStayPointSettings)
+
+		// Stay point detection
+		adminGroup.GET("/staypoints/settings", stayPointHandler.AdminGetStayPointSettings)
+		adminGroup.PUT("/staypoints/settings", stayPointHandler.AdminUpdateStayPointSettings)
+		adminGroup.DELETE("/staypoints/settings", stayPointHandler.AdminDeleteStayPointSettings)
+		adminGroup.POST("/staypoints/regenerate", stayPointHandler.AdminRegenerateStayPoints)
+
+		// Hierarchical framework
+		adminGroup.GET("/frameworks", frameworkHandler.GetFrameworks)
+		adminGroup.POST("/frameworks/import", frameworkHandler.AdminImportFramework)
+		adminGroup.POST("/frameworks/:frameworkID/activate", frameworkHandler.AdminActivateFramework)
+		adminGroup.GET("/frameworks/:frameworkID/export", frameworkHandler.AdminExportFramework)
+		adminGroup.GET("/frameworks/:frameworkID/layers/:layerLevel/clusters", frameworkHandler.GetClustersAtLayer)
+		adminGroup.POST("/frameworks/:frameworkID/update", frameworkHandler.AdminUpdateFramework)
+		adminGroup.GET("/frameworks/:frameworkID/changes", frameworkHandler.GetClusterChanges)
+		adminGroup.GET("/clusters/:clusterID/parent", frameworkHandler.GetParentCluster)
+		adminGroup.GET("/clusters/:clusterID/children", frameworkHandler.GetChildClusters)
+		adminGroup.GET("/clusters/:clusterID/staypoints", frameworkHandler.GetStayPointsInCluster)
 
 		// Location management
 		adminGroup.GET("/locations/count", adminHandler.GetLocationCount)
@@ -126,6 +207,11 @@ func SetupNewRouter(db *db.DB, JwtSescret string) *gin.Engine {
 		adminGroup.GET("/trajectories", adminHandler.GetTrajectories)
 		adminGroup.GET("/trajectories/:id", adminHandler.GetTrajectory)
 		adminGroup.GET("/trajectories/:id/points", adminHandler.GetTrajectoryPoints)
+		adminGroup.POST("/trajectories/:id/simplify", adminHandler.SimplifyTrajectory)
+		adminGroup.DELETE("/trajectories/:id/simplify", adminHandler.ClearSimplifiedTrajectory)
+		adminGroup.GET("/trajectories/:id/export", exportHandler.AdminExportTrajectory)
+		adminGroup.GET("/trajectories/:id/segments", segmentHandler.AdminGetTrajectorySegments)
+		adminGroup.POST("/trajectories/:id/classify", segmentHandler.AdminClassifyTrajectory)
 		adminGroup.POST("/trajectories", adminHandler.CreateTrajectory)
 		adminGroup.PUT("/trajectories/:id", adminHandler.UpdateTrajectory)
 		adminGroup.DELETE("/trajectories/:id", adminHandler.DeleteTrajectory)
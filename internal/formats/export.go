@@ -0,0 +1,252 @@
+package formats
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Supported export formats
+const (
+	FormatGPX     = "gpx"
+	FormatKML     = "kml"
+	FormatGeoJSON = "geojson"
+)
+
+// exportFormats maps each export format to its content type and file extension
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	FormatGPX:     {"application/gpx+xml", ".gpx"},
+	FormatKML:     {"application/vnd.google-earth.kml+xml", ".kml"},
+	FormatGeoJSON: {"application/geo+json", ".geojson"},
+}
+
+// IsExportFormat reports whether a format can be exported
+func IsExportFormat(format string) bool {
+	_, ok := exportFormats[format]
+	return ok
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	return exportFormats[format].contentType
+}
+
+// FileExtension returns the file extension of an export format
+func FileExtension(format string) string {
+	return exportFormats[format].extension
+}
+
+// Export writes a trajectory and its stay points to w in the given format
+func Export(w io.Writer, format string, trajectory models.Trajectory, points []models.GPSPoint, stayPoints []models.StayPoint) error {
+	name := trajectory.Name
+	if name == "" {
+		name = fmt.Sprintf("Trajectory %d", trajectory.ID)
+	}
+
+	switch format {
+	case FormatGPX:
+		return writeGPX(w, name, points, stayPoints)
+	case FormatKML:
+		return writeKML(w, name, points, stayPoints)
+	case FormatGeoJSON:
+		return writeGeoJSON(w, name, trajectory, points, stayPoints)
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// writeGPX writes the points as a single-segment GPX track and stay points as waypoints
+func writeGPX(w io.Writer, name string, points []models.GPSPoint, stayPoints []models.StayPoint) error {
+	doc := gpxFile{
+		Version: "1.1",
+		Creator: "go-map",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+	}
+
+	for i, sp := range stayPoints {
+		doc.Waypoints = append(doc.Waypoints, gpxPoint{
+			Lat:  formatCoordinate(sp.Latitude),
+			Lon:  formatCoordinate(sp.Longitude),
+			Time: sp.ArrivalTime.UTC().Format(time.RFC3339),
+			Name: fmt.Sprintf("Stay point %d", i+1),
+			Desc: stayPointDescription(sp),
+		})
+	}
+
+	segment := gpxSegment{Points: make([]gpxPoint, len(points))}
+	for i, p := range points {
+		segment.Points[i] = gpxPoint{
+			Lat:  formatCoordinate(p.Latitude),
+			Lon:  formatCoordinate(p.Longitude),
+			Ele:  strconv.FormatFloat(p.Altitude, 'f', -1, 64),
+			Time: p.Timestamp.UTC().Format(time.RFC3339),
+		}
+	}
+	doc.Tracks = []gpxTrack{{Name: name, Segments: []gpxSegment{segment}}}
+
+	return encodeXML(w, doc)
+}
+
+type kmlOutput struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsGx  string      `xml:"xmlns:gx,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string               `xml:"name"`
+	Placemarks []kmlOutputPlacemark `xml:"Placemark"`
+}
+
+type kmlOutputPlacemark struct {
+	Name        string          `xml:"name"`
+	Description string          `xml:"description,omitempty"`
+	TimeSpan    *kmlTimeSpan    `xml:"TimeSpan,omitempty"`
+	Point       *kmlOutputPoint `xml:"Point,omitempty"`
+	Track       *kmlOutputTrack `xml:"gx:Track,omitempty"`
+}
+
+type kmlOutputPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlOutputTrack struct {
+	AltitudeMode string   `xml:"altitudeMode"`
+	When         []string `xml:"when"`
+	Coords       []string `xml:"gx:coord"`
+}
+
+// writeKML writes the points as a gx:Track placemark and stay points as point placemarks
+func writeKML(w io.Writer, name string, points []models.GPSPoint, stayPoints []models.StayPoint) error {
+	track := &kmlOutputTrack{
+		AltitudeMode: "absolute",
+		When:         make([]string, len(points)),
+		Coords:       make([]string, len(points)),
+	}
+	for i, p := range points {
+		track.When[i] = p.Timestamp.UTC().Format(time.RFC3339)
+		track.Coords[i] = fmt.Sprintf("%s %s %s",
+			formatCoordinate(p.Longitude),
+			formatCoordinate(p.Latitude),
+			strconv.FormatFloat(p.Altitude, 'f', -1, 64),
+		)
+	}
+
+	doc := kmlOutput{
+		Xmlns:   "http://www.opengis.net/kml/2.2",
+		XmlnsGx: "http://www.google.com/kml/ext/2.2",
+		Document: kmlDocument{
+			Name:       name,
+			Placemarks: []kmlOutputPlacemark{{Name: name, Track: track}},
+		},
+	}
+
+	for i, sp := range stayPoints {
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlOutputPlacemark{
+			Name:        fmt.Sprintf("Stay point %d", i+1),
+			Description: stayPointDescription(sp),
+			TimeSpan: &kmlTimeSpan{
+				Begin: sp.ArrivalTime.UTC().Format(time.RFC3339),
+				End:   sp.DepartureTime.UTC().Format(time.RFC3339),
+			},
+			Point: &kmlOutputPoint{
+				Coordinates: formatCoordinate(sp.Longitude) + "," + formatCoordinate(sp.Latitude),
+			},
+		})
+	}
+
+	return encodeXML(w, doc)
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"`
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties map[string]any  `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// writeGeoJSON writes the points as a LineString feature with per-point timestamps
+// in its "coordTimes" property, followed by one Point feature per stay point
+func writeGeoJSON(w io.Writer, name string, trajectory models.Trajectory, points []models.GPSPoint, stayPoints []models.StayPoint) error {
+	coordinates := make([][]float64, len(points))
+	coordTimes := make([]string, len(points))
+	for i, p := range points {
+		coordinates[i] = []float64{p.Longitude, p.Latitude, p.Altitude}
+		coordTimes[i] = p.Timestamp.UTC().Format(time.RFC3339)
+	}
+
+	collection := geoJSONFeatureCollection{
+		Type: "FeatureCollection",
+		Features: []geoJSONFeature{{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]any{
+				"id":         trajectory.ID,
+				"user_id":    trajectory.UserID,
+				"name":       name,
+				"start_time": trajectory.StartTime.UTC().Format(time.RFC3339),
+				"end_time":   trajectory.EndTime.UTC().Format(time.RFC3339),
+				"coordTimes": coordTimes,
+			},
+		}},
+	}
+
+	for _, sp := range stayPoints {
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: []float64{sp.Longitude, sp.Latitude}},
+			Properties: map[string]any{
+				"stay_point_id":  sp.ID,
+				"arrival_time":   sp.ArrivalTime.UTC().Format(time.RFC3339),
+				"departure_time": sp.DepartureTime.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+
+	return json.NewEncoder(w).Encode(collection)
+}
+
+// encodeXML writes an XML declaration followed by the indented document
+func encodeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// stayPointDescription summarises the time span of a stay point
+func stayPointDescription(sp models.StayPoint) string {
+	return fmt.Sprintf("From %s to %s",
+		sp.ArrivalTime.UTC().Format(time.RFC3339),
+		sp.DepartureTime.UTC().Format(time.RFC3339),
+	)
+}
+
+// formatCoordinate formats a coordinate without trailing zeros
+func formatCoordinate(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
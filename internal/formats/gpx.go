@@ -0,0 +1,157 @@
+package formats
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// gpxFile mirrors the parts of a GPX 1.1 document used by the importer and exporter
+type gpxFile struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr,omitempty"`
+	Creator   string     `xml:"creator,attr,omitempty"`
+	Xmlns     string     `xml:"xmlns,attr,omitempty"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Tracks    []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name,omitempty"`
+	Segments []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// gpxPoint keeps raw strings so that a malformed value only invalidates its own track
+type gpxPoint struct {
+	Lat  string `xml:"lat,attr"`
+	Lon  string `xml:"lon,attr"`
+	Ele  string `xml:"ele,omitempty"`
+	Time string `xml:"time,omitempty"`
+	Name string `xml:"name,omitempty"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+// Waypoint is a <wpt> element of a GPX document. Time is zero when the waypoint has none.
+type Waypoint struct {
+	Name        string
+	Description string
+	Latitude    float64
+	Longitude   float64
+	Altitude    float64
+	Time        time.Time
+}
+
+// ParseGPX reads a GPX 1.1 document and returns one track per <trk> element and
+// its waypoints. Segments of a track are merged into a single point stream.
+// Waypoints are never turned into a track: they usually have no time and no order.
+// Malformed tracks are returned with Err set and malformed waypoints are
+// skipped; only a document that is not valid XML makes the whole call fail.
+func ParseGPX(r io.Reader) ([]Track, []Waypoint, error) {
+	var doc gpxFile
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("invalid GPX document: %w", err)
+	}
+
+	var waypoints []Waypoint
+	for _, pt := range doc.Waypoints {
+		if waypoint, err := pt.toWaypoint(); err == nil {
+			waypoints = append(waypoints, waypoint)
+		}
+	}
+
+	tracks := make([]Track, 0, len(doc.Tracks))
+	for i, trk := range doc.Tracks {
+		track := Track{Name: strings.TrimSpace(trk.Name)}
+		if track.Name == "" {
+			track.Name = fmt.Sprintf("Track %d", i+1)
+		}
+
+		for s, seg := range trk.Segments {
+			for p, pt := range seg.Points {
+				point, err := pt.toGPSPoint()
+				if err != nil {
+					track.Err = fmt.Errorf("segment %d point %d: %w", s+1, p+1, err)
+					break
+				}
+				track.Points = append(track.Points, point)
+			}
+			if track.Err != nil {
+				break
+			}
+		}
+
+		finishTrack(&track)
+		tracks = append(tracks, track)
+	}
+
+	return tracks, waypoints, nil
+}
+
+// toWaypoint converts a raw GPX waypoint, whose timestamp is optional
+func (p gpxPoint) toWaypoint() (Waypoint, error) {
+	if strings.TrimSpace(p.Time) == "" {
+		p.Time = time.Time{}.Format(time.RFC3339)
+	}
+	point, err := p.toGPSPoint()
+	if err != nil {
+		return Waypoint{}, err
+	}
+	return Waypoint{
+		Name:        strings.TrimSpace(p.Name),
+		Description: strings.TrimSpace(p.Desc),
+		Latitude:    point.Latitude,
+		Longitude:   point.Longitude,
+		Altitude:    point.Altitude,
+		Time:        point.Timestamp,
+	}, nil
+}
+
+// toGPSPoint converts a raw GPX point into a GPSPoint
+func (p gpxPoint) toGPSPoint() (models.GPSPoint, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(p.Lat), 64)
+	if err != nil {
+		return models.GPSPoint{}, fmt.Errorf("invalid latitude %q", p.Lat)
+	}
+
+	lng, err := strconv.ParseFloat(strings.TrimSpace(p.Lon), 64)
+	if err != nil {
+		return models.GPSPoint{}, fmt.Errorf("invalid longitude %q", p.Lon)
+	}
+
+	if !validCoordinates(lat, lng) {
+		return models.GPSPoint{}, fmt.Errorf("coordinates out of range (%f, %f)", lat, lng)
+	}
+
+	var altitude float64
+	if ele := strings.TrimSpace(p.Ele); ele != "" {
+		altitude, err = strconv.ParseFloat(ele, 64)
+		if err != nil {
+			return models.GPSPoint{}, fmt.Errorf("invalid elevation %q", p.Ele)
+		}
+	}
+
+	timeStr := strings.TrimSpace(p.Time)
+	if timeStr == "" {
+		return models.GPSPoint{}, fmt.Errorf("missing timestamp")
+	}
+	timestamp, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		return models.GPSPoint{}, fmt.Errorf("invalid timestamp %q", p.Time)
+	}
+
+	return models.GPSPoint{
+		Latitude:  lat,
+		Longitude: lng,
+		Altitude:  altitude,
+		Timestamp: timestamp,
+	}, nil
+}
@@ -0,0 +1,157 @@
+package formats
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// gpxDocument wraps elements in a GPX 1.1 root element
+func gpxDocument(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">` + body + `</gpx>`
+}
+
+// TestParseGPX checks the tracks and waypoints read from GPX documents, including
+// malformed points that only invalidate their own track
+func TestParseGPX(t *testing.T) {
+	type wantTrack struct {
+		name   string
+		points int
+		err    bool
+	}
+
+	tests := []struct {
+		name      string
+		doc       string
+		tracks    []wantTrack
+		waypoints []string // Names of the waypoints
+		wantErr   bool
+	}{
+		{
+			name: "track with two segments",
+			doc: gpxDocument(`<trk><name> Morning walk </name>
+				<trkseg>
+					<trkpt lat="39.90" lon="116.30"><ele>50</ele><time>2008-10-23T02:53:04Z</time></trkpt>
+					<trkpt lat="39.91" lon="116.31"><time>2008-10-23T02:53:10Z</time></trkpt>
+				</trkseg>
+				<trkseg>
+					<trkpt lat="39.92" lon="116.32"><time>2008-10-23T02:53:15Z</time></trkpt>
+				</trkseg></trk>`),
+			tracks: []wantTrack{{"Morning walk", 3, false}},
+		},
+		{
+			name: "unnamed tracks are numbered",
+			doc: gpxDocument(`<trk><trkseg>
+					<trkpt lat="1" lon="2"><time>2020-01-01T00:00:00Z</time></trkpt>
+					<trkpt lat="1" lon="2.001"><time>2020-01-01T00:00:05Z</time></trkpt>
+				</trkseg></trk>
+				<trk><trkseg>
+					<trkpt lat="1" lon="2"><time>2020-01-01T01:00:00Z</time></trkpt>
+					<trkpt lat="1" lon="2.001"><time>2020-01-01T01:00:05Z</time></trkpt>
+				</trkseg></trk>`),
+			tracks: []wantTrack{{"Track 1", 2, false}, {"Track 2", 2, false}},
+		},
+		{
+			name: "point without time fails its track only",
+			doc: gpxDocument(`<trk><name>broken</name><trkseg>
+					<trkpt lat="1" lon="2"><time>2020-01-01T00:00:00Z</time></trkpt>
+					<trkpt lat="1" lon="2.001"></trkpt>
+				</trkseg></trk>
+				<trk><name>fine</name><trkseg>
+					<trkpt lat="1" lon="2"><time>2020-01-01T01:00:00Z</time></trkpt>
+					<trkpt lat="1" lon="2.001"><time>2020-01-01T01:00:05Z</time></trkpt>
+				</trkseg></trk>`),
+			tracks: []wantTrack{{"broken", 1, true}, {"fine", 2, false}},
+		},
+		{
+			name: "coordinates out of range",
+			doc: gpxDocument(`<trk><trkseg>
+					<trkpt lat="91" lon="2"><time>2020-01-01T00:00:00Z</time></trkpt>
+					<trkpt lat="1" lon="2"><time>2020-01-01T00:00:05Z</time></trkpt>
+				</trkseg></trk>`),
+			tracks: []wantTrack{{"Track 1", 0, true}},
+		},
+		{
+			name: "single point is too few",
+			doc: gpxDocument(`<trk><trkseg>
+					<trkpt lat="1" lon="2"><time>2020-01-01T00:00:00Z</time></trkpt>
+				</trkseg></trk>`),
+			tracks: []wantTrack{{"Track 1", 1, true}},
+		},
+		{
+			name: "waypoints are not a track",
+			doc: gpxDocument(`<wpt lat="39.9" lon="116.3"><name>Home</name></wpt>
+				<wpt lat="39.8" lon="116.4"><name>Office</name><time>2020-01-01T00:00:00Z</time></wpt>
+				<wpt lat="bad" lon="116.4"><name>Broken</name></wpt>`),
+			tracks:    []wantTrack{},
+			waypoints: []string{"Home", "Office"},
+		},
+		{
+			name:    "not XML",
+			doc:     "GPX?",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks, waypoints, err := ParseGPX(strings.NewReader(tt.doc))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(tracks) != len(tt.tracks) {
+				t.Fatalf("got %d tracks, want %d", len(tracks), len(tt.tracks))
+			}
+			for i, want := range tt.tracks {
+				got := tracks[i]
+				if got.Name != want.name || len(got.Points) != want.points || (got.Err != nil) != want.err {
+					t.Errorf("track %d = %q with %d points, error %v; want %q with %d points, error %v",
+						i, got.Name, len(got.Points), got.Err, want.name, want.points, want.err)
+				}
+			}
+
+			if len(waypoints) != len(tt.waypoints) {
+				t.Fatalf("got %d waypoints, want %d", len(waypoints), len(tt.waypoints))
+			}
+			for i, name := range tt.waypoints {
+				if waypoints[i].Name != name {
+					t.Errorf("waypoint %d = %q, want %q", i, waypoints[i].Name, name)
+				}
+			}
+		})
+	}
+}
+
+// TestParseGPXPoints checks the values and the chronological order of parsed points
+func TestParseGPXPoints(t *testing.T) {
+	doc := gpxDocument(`<trk><trkseg>
+			<trkpt lat="39.91" lon="116.31"><time>2008-10-23T02:53:10Z</time></trkpt>
+			<trkpt lat="39.90" lon="116.30"><ele>50.5</ele><time>2008-10-23T02:53:04Z</time></trkpt>
+		</trkseg></trk>`)
+
+	tracks, _, err := ParseGPX(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := tracks[0].Points
+	if len(points) != 2 {
+		t.Fatalf("got %d points, want 2", len(points))
+	}
+
+	first := points[0]
+	if first.Latitude != 39.90 || first.Longitude != 116.30 || first.Altitude != 50.5 ||
+		!first.Timestamp.Equal(time.Date(2008, 10, 23, 2, 53, 4, 0, time.UTC)) {
+		t.Errorf("first point = %+v, want the earlier one at 39.90, 116.30, 50.5 m", first)
+	}
+	if tracks[0].Err != nil {
+		t.Errorf("unexpected track error %v", tracks[0].Err)
+	}
+}
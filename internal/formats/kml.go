@@ -0,0 +1,253 @@
+package formats
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// ErrMissingTimestamps is returned for LineStrings imported without synthetic timestamps
+var ErrMissingTimestamps = errors.New("LineString has no timestamps; enable synthetic timestamps to import it")
+
+// KMLOptions controls how KML geometries without time information are handled
+type KMLOptions struct {
+	SyntheticTimestamps bool          // Accept LineStrings by generating timestamps
+	SyntheticStart      time.Time     // First timestamp when the placemark has no TimeSpan
+	SyntheticInterval   time.Duration // Spacing between generated timestamps
+}
+
+type kmlPlacemark struct {
+	Name        string          `xml:"name"`
+	TimeSpan    kmlTimeSpan     `xml:"TimeSpan"`
+	LineStrings []kmlLineString `xml:"LineString"`
+	MultiLines  []kmlLineString `xml:"MultiGeometry>LineString"`
+	Tracks      []kmlTrack      `xml:"Track"`
+	MultiTracks []kmlTrack      `xml:"MultiTrack>Track"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlLineString struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlTrack mirrors a gx:Track element, where each <when> pairs with a <gx:coord>
+type kmlTrack struct {
+	When   []string `xml:"when"`
+	Coords []string `xml:"coord"`
+}
+
+// ParseKML reads a KML document and returns one track per LineString or gx:Track
+// found in its placemarks, including placemarks nested in folders.
+func ParseKML(r io.Reader, opts KMLOptions) ([]Track, error) {
+	if opts.SyntheticInterval <= 0 {
+		opts.SyntheticInterval = time.Second
+	}
+	if opts.SyntheticStart.IsZero() {
+		opts.SyntheticStart = time.Now().UTC().Truncate(time.Second)
+	}
+
+	decoder := xml.NewDecoder(r)
+	var tracks []Track
+	placemarkCount := 0
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid KML document: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+
+		var placemark kmlPlacemark
+		if err := decoder.DecodeElement(&placemark, &start); err != nil {
+			return nil, fmt.Errorf("invalid KML document: %w", err)
+		}
+		placemarkCount++
+		tracks = append(tracks, placemark.toTracks(placemarkCount, opts)...)
+	}
+
+	return tracks, nil
+}
+
+// ParseKMZ reads a zipped KML archive and parses its main document
+func ParseKMZ(r io.ReaderAt, size int64, opts KMLOptions) ([]Track, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMZ archive: %w", err)
+	}
+
+	// The main document is doc.kml by convention, otherwise the first .kml file
+	var document *zip.File
+	for _, file := range archive.File {
+		if strings.ToLower(path.Ext(file.Name)) != ".kml" {
+			continue
+		}
+		if document == nil || path.Base(file.Name) == "doc.kml" {
+			document = file
+		}
+	}
+	if document == nil {
+		return nil, errors.New("KMZ archive does not contain a KML document")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMZ archive: %w", err)
+	}
+	defer rc.Close()
+
+	return ParseKML(rc, opts)
+}
+
+// toTracks converts every geometry of a placemark into a track
+func (p kmlPlacemark) toTracks(index int, opts KMLOptions) []Track {
+	baseName := strings.TrimSpace(p.Name)
+	if baseName == "" {
+		baseName = fmt.Sprintf("Placemark %d", index)
+	}
+
+	var tracks []Track
+	nameFor := func() string {
+		if len(tracks) == 0 {
+			return baseName
+		}
+		return fmt.Sprintf("%s (%d)", baseName, len(tracks)+1)
+	}
+
+	for _, gxTrack := range append(p.Tracks, p.MultiTracks...) {
+		track := Track{Name: nameFor()}
+		track.Points, track.Err = gxTrack.toGPSPoints()
+		finishTrack(&track)
+		tracks = append(tracks, track)
+	}
+
+	for _, line := range append(p.LineStrings, p.MultiLines...) {
+		track := Track{Name: nameFor()}
+		track.Points, track.Err = line.toGPSPoints(p.TimeSpan, opts)
+		finishTrack(&track)
+		tracks = append(tracks, track)
+	}
+
+	return tracks
+}
+
+// toGPSPoints pairs the timestamps and coordinates of a gx:Track
+func (t kmlTrack) toGPSPoints() ([]models.GPSPoint, error) {
+	if len(t.When) != len(t.Coords) {
+		return nil, fmt.Errorf("gx:Track has %d timestamps but %d coordinates", len(t.When), len(t.Coords))
+	}
+
+	points := make([]models.GPSPoint, 0, len(t.Coords))
+	for i := range t.Coords {
+		// gx:coord values are space separated: longitude latitude [altitude]
+		point, err := parseKMLCoordinate(strings.Fields(t.Coords[i]))
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", i+1, err)
+		}
+
+		point.Timestamp, err = parseKMLTime(t.When[i])
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", i+1, err)
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// toGPSPoints parses LineString coordinates, generating timestamps when allowed
+func (l kmlLineString) toGPSPoints(span kmlTimeSpan, opts KMLOptions) ([]models.GPSPoint, error) {
+	if !opts.SyntheticTimestamps {
+		return nil, ErrMissingTimestamps
+	}
+
+	// LineString tuples are whitespace separated, each tuple is longitude,latitude[,altitude]
+	tuples := strings.Fields(l.Coordinates)
+	points := make([]models.GPSPoint, 0, len(tuples))
+	for i, tuple := range tuples {
+		point, err := parseKMLCoordinate(strings.Split(tuple, ","))
+		if err != nil {
+			return nil, fmt.Errorf("point %d: %w", i+1, err)
+		}
+		points = append(points, point)
+	}
+
+	start, interval := opts.SyntheticStart, opts.SyntheticInterval
+	if begin, err := parseKMLTime(span.Begin); err == nil {
+		start = begin
+		// Spread the points evenly over the placemark's time span when it is known
+		if end, err := parseKMLTime(span.End); err == nil && end.After(begin) && len(points) > 1 {
+			interval = end.Sub(begin) / time.Duration(len(points)-1)
+		}
+	}
+
+	for i := range points {
+		points[i].Timestamp = start.Add(time.Duration(i) * interval)
+	}
+
+	return points, nil
+}
+
+// parseKMLCoordinate parses a longitude, latitude and optional altitude
+func parseKMLCoordinate(fields []string) (models.GPSPoint, error) {
+	if len(fields) < 2 {
+		return models.GPSPoint{}, fmt.Errorf("invalid coordinate %q", strings.Join(fields, ","))
+	}
+
+	lng, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+	if err != nil {
+		return models.GPSPoint{}, fmt.Errorf("invalid longitude %q", fields[0])
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(fields[1]), 64)
+	if err != nil {
+		return models.GPSPoint{}, fmt.Errorf("invalid latitude %q", fields[1])
+	}
+
+	if !validCoordinates(lat, lng) {
+		return models.GPSPoint{}, fmt.Errorf("coordinates out of range (%f, %f)", lat, lng)
+	}
+
+	var altitude float64
+	if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+		altitude, err = strconv.ParseFloat(strings.TrimSpace(fields[2]), 64)
+		if err != nil {
+			return models.GPSPoint{}, fmt.Errorf("invalid altitude %q", fields[2])
+		}
+	}
+
+	return models.GPSPoint{
+		Latitude:  lat,
+		Longitude: lng,
+		Altitude:  altitude,
+	}, nil
+}
+
+// parseKMLTime parses the dateTime forms allowed in KML <when>, <begin> and <end> elements
+func parseKMLTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", value)
+}
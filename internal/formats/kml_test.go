@@ -0,0 +1,251 @@
+package formats
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// kmlTestDocument wraps elements in a KML 2.2 root element with the gx extension namespace
+func kmlTestDocument(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2"><Document>` + body + `</Document></kml>`
+}
+
+const kmlGxTrack = `<Placemark><name>Ride</name><gx:Track>
+	<when>2020-01-01T00:00:00Z</when><when>2020-01-01T00:00:05Z</when><when>2020-01-01T00:00:10Z</when>
+	<gx:coord>116.30 39.90 50</gx:coord><gx:coord>116.31 39.91 51</gx:coord><gx:coord>116.32 39.92 52</gx:coord>
+</gx:Track></Placemark>`
+
+// TestParseKML checks the tracks read from KML documents for every supported geometry
+func TestParseKML(t *testing.T) {
+	start := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	synthetic := KMLOptions{SyntheticTimestamps: true, SyntheticStart: start, SyntheticInterval: 10 * time.Second}
+
+	tests := []struct {
+		name    string
+		doc     string
+		opts    KMLOptions
+		tracks  []wantTrack
+		wantErr bool
+	}{
+		{
+			name:   "gx:Track",
+			doc:    kmlTestDocument(kmlGxTrack),
+			tracks: []wantTrack{{"Ride", 3, nil}},
+		},
+		{
+			name:   "placemark in a folder",
+			doc:    kmlTestDocument(`<Folder><Folder>` + kmlGxTrack + `</Folder></Folder>`),
+			tracks: []wantTrack{{"Ride", 3, nil}},
+		},
+		{
+			name: "gx:Track with more timestamps than coordinates",
+			doc: kmlTestDocument(`<Placemark><gx:Track>
+				<when>2020-01-01T00:00:00Z</when><when>2020-01-01T00:00:05Z</when>
+				<gx:coord>116.30 39.90</gx:coord>
+			</gx:Track></Placemark>`),
+			tracks: []wantTrack{{"Placemark 1", 0, errAny}},
+		},
+		{
+			name:   "LineString without synthetic timestamps",
+			doc:    kmlTestDocument(`<Placemark><name>Line</name><LineString><coordinates>116.30,39.90 116.31,39.91</coordinates></LineString></Placemark>`),
+			tracks: []wantTrack{{"Line", 0, ErrMissingTimestamps}},
+		},
+		{
+			name:   "LineString with synthetic timestamps",
+			doc:    kmlTestDocument(`<Placemark><name>Line</name><LineString><coordinates>116.30,39.90,10 116.31,39.91 116.32,39.92</coordinates></LineString></Placemark>`),
+			opts:   synthetic,
+			tracks: []wantTrack{{"Line", 3, nil}},
+		},
+		{
+			name: "geometries of one placemark are numbered",
+			doc: kmlTestDocument(`<Placemark><name>Day</name><MultiGeometry>
+				<LineString><coordinates>116.30,39.90 116.31,39.91</coordinates></LineString>
+				<LineString><coordinates>116.40,39.90 116.41,39.91</coordinates></LineString>
+			</MultiGeometry></Placemark>`),
+			opts:   synthetic,
+			tracks: []wantTrack{{"Day", 2, nil}, {"Day (2)", 2, nil}},
+		},
+		{
+			name:   "coordinates out of range",
+			doc:    kmlTestDocument(`<Placemark><LineString><coordinates>190,39.90 116.31,39.91</coordinates></LineString></Placemark>`),
+			opts:   synthetic,
+			tracks: []wantTrack{{"Placemark 1", 0, errAny}},
+		},
+		{
+			name:    "not XML",
+			doc:     "<kml><Placemark>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks, err := ParseKML(strings.NewReader(tt.doc), tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTracks(t, tracks, tt.tracks)
+		})
+	}
+}
+
+// TestParseKMLSyntheticTimestamps checks the timestamps generated for LineStrings
+func TestParseKMLSyntheticTimestamps(t *testing.T) {
+	start := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	line := `<LineString><coordinates>116.30,39.90 116.31,39.91 116.32,39.92</coordinates></LineString>`
+
+	tests := []struct {
+		name     string
+		timeSpan string
+		want     []time.Time
+	}{
+		{
+			name: "start and interval",
+			want: []time.Time{start, start.Add(10 * time.Second), start.Add(20 * time.Second)},
+		},
+		{
+			name:     "begin of the time span",
+			timeSpan: `<TimeSpan><begin>2022-03-01T12:00:00Z</begin></TimeSpan>`,
+			want: []time.Time{
+				time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+				time.Date(2022, 3, 1, 12, 0, 10, 0, time.UTC),
+				time.Date(2022, 3, 1, 12, 0, 20, 0, time.UTC),
+			},
+		},
+		{
+			name:     "spread over the time span",
+			timeSpan: `<TimeSpan><begin>2022-03-01T12:00:00Z</begin><end>2022-03-01T13:00:00Z</end></TimeSpan>`,
+			want: []time.Time{
+				time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+				time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+				time.Date(2022, 3, 1, 13, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := kmlTestDocument(`<Placemark>` + tt.timeSpan + line + `</Placemark>`)
+			tracks, err := ParseKML(strings.NewReader(doc), KMLOptions{
+				SyntheticTimestamps: true,
+				SyntheticStart:      start,
+				SyntheticInterval:   10 * time.Second,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tracks) != 1 || tracks[0].Err != nil {
+				t.Fatalf("got %d tracks, want one valid track", len(tracks))
+			}
+
+			for i, point := range tracks[0].Points {
+				if !point.Timestamp.Equal(tt.want[i]) {
+					t.Errorf("point %d at %s, want %s", i, point.Timestamp, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestParseKMZ checks that the main document of a KMZ archive is found
+func TestParseKMZ(t *testing.T) {
+	other := kmlTestDocument(`<Placemark><name>Other</name><gx:Track>
+		<when>2020-01-01T00:00:00Z</when><when>2020-01-01T00:00:05Z</when>
+		<gx:coord>116.30 39.90</gx:coord><gx:coord>116.31 39.91</gx:coord>
+	</gx:Track></Placemark>`)
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		track   string // Name of the only track, empty when parsing fails
+		wantErr bool
+	}{
+		{
+			name:  "doc.kml",
+			files: map[string]string{"a.kml": other, "files/doc.kml": kmlTestDocument(kmlGxTrack), "icon.png": "png"},
+			track: "Ride",
+		},
+		{
+			name:  "any KML document",
+			files: map[string]string{"track.KML": kmlTestDocument(kmlGxTrack)},
+			track: "Ride",
+		},
+		{
+			name:    "no KML document",
+			files:   map[string]string{"icon.png": "png"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			archive := zip.NewWriter(&buf)
+			for name, content := range tt.files {
+				w, err := archive.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write([]byte(content)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := archive.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			tracks, err := ParseKMZ(bytes.NewReader(buf.Bytes()), int64(buf.Len()), KMLOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTracks(t, tracks, []wantTrack{{tt.track, 3, nil}})
+		})
+	}
+
+	if _, err := ParseKMZ(strings.NewReader("not a zip"), 9, KMLOptions{}); err == nil {
+		t.Error("expected an error for a file that is not a zip archive")
+	}
+}
+
+// errAny stands for any track error in the expected tracks
+var errAny = errors.New("any error")
+
+type wantTrack struct {
+	name   string
+	points int
+	err    error // nil for a valid track, errAny for any error
+}
+
+func checkTracks(t *testing.T, tracks []Track, want []wantTrack) {
+	t.Helper()
+	if len(tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(tracks), len(want))
+	}
+	for i, w := range want {
+		got := tracks[i]
+		errOK := (w.err == nil && got.Err == nil) ||
+			(w.err == errAny && got.Err != nil) ||
+			(w.err != nil && errors.Is(got.Err, w.err))
+		if got.Name != w.name || len(got.Points) != w.points || !errOK {
+			t.Errorf("track %d = %q with %d points, error %v; want %q with %d points, error %v",
+				i, got.Name, len(got.Points), got.Err, w.name, w.points, w.err)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package formats
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// TakeoutVisit is a placeVisit entry from the Semantic Location History
+type TakeoutVisit struct {
+	Latitude  float64
+	Longitude float64
+	Name      string
+	Address   string
+	Start     time.Time
+	End       time.Time
+}
+
+// TakeoutData holds everything read from a Google Takeout location history export
+type TakeoutData struct {
+	Points []models.GPSPoint // Raw records from Records.json
+	Visits []TakeoutVisit    // Place visits from the monthly semantic files
+}
+
+type takeoutRecord struct {
+	LatitudeE7  *int64  `json:"latitudeE7"`
+	LongitudeE7 *int64  `json:"longitudeE7"`
+	Altitude    float64 `json:"altitude"`
+	Timestamp   string  `json:"timestamp"`
+	TimestampMs string  `json:"timestampMs"`
+}
+
+type takeoutTimelineObject struct {
+	PlaceVisit *struct {
+		Location struct {
+			LatitudeE7  *int64 `json:"latitudeE7"`
+			LongitudeE7 *int64 `json:"longitudeE7"`
+			Name        string `json:"name"`
+			Address     string `json:"address"`
+		} `json:"location"`
+		Duration struct {
+			StartTimestamp   string `json:"startTimestamp"`
+			StartTimestampMs string `json:"startTimestampMs"`
+			EndTimestamp     string `json:"endTimestamp"`
+			EndTimestampMs   string `json:"endTimestampMs"`
+		} `json:"duration"`
+	} `json:"placeVisit"`
+}
+
+// ParseTakeoutJSON reads either a Records.json file or a monthly Semantic Location
+// History file and adds its content to data. Records are streamed, so multi-gigabyte
+// exports do not have to be loaded in memory as a whole. Malformed entries are skipped.
+func ParseTakeoutJSON(r io.Reader, data *TakeoutData) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+
+	for decoder.More() {
+		keyToken, err := decoder.Token()
+		if err != nil {
+			return fmt.Errorf("invalid Takeout JSON: %w", err)
+		}
+
+		switch keyToken {
+		case "locations":
+			if err := decodeArray(decoder, func() error {
+				var record takeoutRecord
+				if err := decoder.Decode(&record); err != nil {
+					return err
+				}
+				if point, ok := record.toGPSPoint(); ok {
+					data.Points = append(data.Points, point)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		case "timelineObjects":
+			if err := decodeArray(decoder, func() error {
+				var object takeoutTimelineObject
+				if err := decoder.Decode(&object); err != nil {
+					return err
+				}
+				if visit, ok := object.toVisit(); ok {
+					data.Visits = append(data.Visits, visit)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		default:
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return fmt.Errorf("invalid Takeout JSON: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseTakeoutZip reads Records.json and the Semantic Location History files from a Takeout archive
+func ParseTakeoutZip(r io.ReaderAt, size int64) (*TakeoutData, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Takeout archive: %w", err)
+	}
+
+	data := &TakeoutData{}
+	found := false
+	for _, file := range archive.File {
+		if !IsTakeoutFile(file.Name) {
+			continue
+		}
+		found = true
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Takeout archive: %w", err)
+		}
+		err = ParseTakeoutJSON(rc, data)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Name, err)
+		}
+	}
+
+	if !found {
+		return nil, errors.New("archive does not contain Records.json or Semantic Location History files")
+	}
+	return data, nil
+}
+
+// IsTakeoutFile reports whether a path inside a Takeout export holds location history
+func IsTakeoutFile(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.Base(name) == "Records.json" {
+		return true
+	}
+	return strings.Contains(name, "Semantic Location History/") && strings.HasSuffix(strings.ToLower(name), ".json")
+}
+
+// SplitByDay groups points into one chronologically ordered track per UTC day
+func SplitByDay(points []models.GPSPoint, namePrefix string) []Track {
+	byDay := make(map[string][]models.GPSPoint)
+	for _, p := range points {
+		day := p.Timestamp.UTC().Format("2006-01-02")
+		byDay[day] = append(byDay[day], p)
+	}
+
+	days := make([]string, 0, len(byDay))
+	for day := range byDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	tracks := make([]Track, 0, len(days))
+	for _, day := range days {
+		track := Track{Name: namePrefix + " " + day, Points: byDay[day]}
+		finishTrack(&track)
+		tracks = append(tracks, track)
+	}
+	return tracks
+}
+
+// toGPSPoint converts a Records.json entry; entries without position or time are rejected
+func (r takeoutRecord) toGPSPoint() (models.GPSPoint, bool) {
+	if r.LatitudeE7 == nil || r.LongitudeE7 == nil {
+		return models.GPSPoint{}, false
+	}
+
+	timestamp, err := parseTakeoutTime(r.Timestamp, r.TimestampMs)
+	if err != nil {
+		return models.GPSPoint{}, false
+	}
+
+	lat, lng := fromE7(*r.LatitudeE7), fromE7(*r.LongitudeE7)
+	if !validCoordinates(lat, lng) {
+		return models.GPSPoint{}, false
+	}
+
+	return models.GPSPoint{
+		Latitude:  lat,
+		Longitude: lng,
+		Altitude:  r.Altitude,
+		Timestamp: timestamp,
+	}, true
+}
+
+// toVisit converts a timeline object when it is a complete placeVisit
+func (o takeoutTimelineObject) toVisit() (TakeoutVisit, bool) {
+	visit := o.PlaceVisit
+	if visit == nil || visit.Location.LatitudeE7 == nil || visit.Location.LongitudeE7 == nil {
+		return TakeoutVisit{}, false
+	}
+
+	start, err := parseTakeoutTime(visit.Duration.StartTimestamp, visit.Duration.StartTimestampMs)
+	if err != nil {
+		return TakeoutVisit{}, false
+	}
+	end, err := parseTakeoutTime(visit.Duration.EndTimestamp, visit.Duration.EndTimestampMs)
+	if err != nil || end.Before(start) {
+		return TakeoutVisit{}, false
+	}
+
+	lat, lng := fromE7(*visit.Location.LatitudeE7), fromE7(*visit.Location.LongitudeE7)
+	if !validCoordinates(lat, lng) {
+		return TakeoutVisit{}, false
+	}
+
+	return TakeoutVisit{
+		Latitude:  lat,
+		Longitude: lng,
+		Name:      strings.TrimSpace(visit.Location.Name),
+		Address:   strings.TrimSpace(visit.Location.Address),
+		Start:     start,
+		End:       end,
+	}, true
+}
+
+// parseTakeoutTime accepts both the RFC3339 and the older epoch-milliseconds timestamp fields
+func parseTakeoutTime(timestamp, timestampMs string) (time.Time, error) {
+	if timestamp != "" {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.UTC(), nil
+	}
+
+	ms, err := strconv.ParseInt(timestampMs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// fromE7 converts an E7 fixed-point coordinate to degrees
+func fromE7(value int64) float64 {
+	return float64(value) / 1e7
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("invalid Takeout JSON: %w", err)
+	}
+	if token != delim {
+		return fmt.Errorf("invalid Takeout JSON: expected %q", delim)
+	}
+	return nil
+}
+
+// decodeArray calls decodeItem for every element of the array at the decoder's position
+func decodeArray(decoder *json.Decoder, decodeItem func() error) error {
+	if err := expectDelim(decoder, '['); err != nil {
+		return err
+	}
+	for decoder.More() {
+		if err := decodeItem(); err != nil {
+			return fmt.Errorf("invalid Takeout JSON: %w", err)
+		}
+	}
+	return expectDelim(decoder, ']')
+}
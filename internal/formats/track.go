@@ -0,0 +1,39 @@
+// Package formats provides readers and writers for standard GPS track file formats
+package formats
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// ErrTooFewPoints is returned for tracks that cannot form a trajectory
+var ErrTooFewPoints = errors.New("track must contain at least 2 points")
+
+// Track represents a single track parsed from a file
+type Track struct {
+	Name   string
+	Points []models.GPSPoint
+	Err    error // Set when the track could not be parsed
+}
+
+// finishTrack sorts the points of a track chronologically and validates its length
+func finishTrack(track *Track) {
+	if track.Err != nil {
+		return
+	}
+
+	sort.SliceStable(track.Points, func(i, j int) bool {
+		return track.Points[i].Timestamp.Before(track.Points[j].Timestamp)
+	})
+
+	if len(track.Points) < 2 {
+		track.Err = ErrTooFewPoints
+	}
+}
+
+// validCoordinates checks that latitude and longitude are within WGS84 bounds
+func validCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/models"
 	"github.com/th1enq/go-map/internal/services"
 )
@@ -274,9 +275,10 @@ func (h *AdminHandler) CreateLocation(c *gin.Context) {
 	}
 
 	location := models.Location{
-		Name:      locationData.Name,
-		Latitude:  locationData.Latitude,
-		Longitude: locationData.Longitude,
+		Name:       locationData.Name,
+		Latitude:   locationData.Latitude,
+		Longitude:  locationData.Longitude,
+		Activities: locationData.Activities,
 	}
 
 	id, err := h.locationService.Create(location)
@@ -327,6 +329,16 @@ func (h *AdminHandler) UpdateLocation(c *gin.Context) {
 		return
 	}
 
+	// Activities are only replaced when the request sends them
+	if locationData.Activities != nil {
+		activities, err := h.locationService.SetActivities(location.ID, locationData.Activities)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update location activities"})
+			return
+		}
+		location.Activities = activities
+	}
+
 	c.JSON(http.StatusOK, location)
 }
 
@@ -449,7 +461,13 @@ func (h *AdminHandler) GetTrajectoryPoints(c *gin.Context) {
 		return
 	}
 
-	points, err := h.trajectoryService.GetTrajectoryPoints(id)
+	simplify, err := parseSimplifyOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	points, err := h.trajectoryService.GetTrajectoryPoints(id, simplify)
 	if err != nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory points not found"})
 		return
@@ -458,6 +476,83 @@ func (h *AdminHandler) GetTrajectoryPoints(c *gin.Context) {
 	c.JSON(http.StatusOK, points)
 }
 
+// SimplifyTrajectoryRequest represents the request body for storing a simplified copy
+type SimplifyTrajectoryRequest struct {
+	Method    string   `json:"method" binding:"required"`
+	Tolerance *float64 `json:"tolerance"`
+}
+
+// SimplifyTrajectory stores a simplified copy of a trajectory for display, keeping the raw points
+func (h *AdminHandler) SimplifyTrajectory(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	var req SimplifyTrajectoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !algorithms.IsSimplifyMethod(req.Method) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid method, expected dp or vw"})
+		return
+	}
+
+	tolerance := algorithms.DefaultSimplifyTolerance(req.Method)
+	if req.Tolerance != nil {
+		if *req.Tolerance < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid tolerance, expected a non-negative number"})
+			return
+		}
+		tolerance = *req.Tolerance
+	}
+
+	trajectory, err := h.trajectoryService.StoreSimplified(id, req.Method, tolerance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to simplify trajectory: " + err.Error()})
+		return
+	}
+
+	rawCount, err := h.trajectoryService.GetTrajectoryPointsCount(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to count trajectory points"})
+		return
+	}
+
+	simplified, err := services.SimplifiedPoints(*trajectory, services.SimplifyOptions{Method: services.SimplifyStored})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read simplified points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trajectory_id":    id,
+		"method":           req.Method,
+		"tolerance":        tolerance,
+		"points_count":     rawCount,
+		"simplified_count": len(simplified),
+	})
+}
+
+// ClearSimplifiedTrajectory removes the stored simplified copy of a trajectory
+func (h *AdminHandler) ClearSimplifiedTrajectory(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	if err := h.trajectoryService.ClearSimplified(id); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to clear simplified points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Simplified points removed"})
+}
+
 // CreateTrajectory creates a new trajectory
 func (h *AdminHandler) CreateTrajectory(c *gin.Context) {
 	var trajectoryData TrajectoryRequest
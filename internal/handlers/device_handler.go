@@ -0,0 +1,106 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// DeviceHandler manages the tracking devices of the current user
+type DeviceHandler struct {
+	deviceService *services.DeviceServices
+}
+
+// CreateDeviceRequest is the input for registering a tracking device
+type CreateDeviceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// NewDeviceHandler creates a new instance of DeviceHandler
+func NewDeviceHandler(deviceService *services.DeviceServices) *DeviceHandler {
+	return &DeviceHandler{
+		deviceService: deviceService,
+	}
+}
+
+// CreateDevice registers a device and returns its personal token
+func (h *DeviceHandler) CreateDevice(c *gin.Context) {
+	var req CreateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	device, token, err := h.deviceService.CreateDevice(userID.(uint), req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to create device, the name may already be in use"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Device created successfully. Store the token now, it will not be shown again",
+		"device":  device,
+		"token":   token,
+	})
+}
+
+// GetDevices lists the current user's devices
+func (h *DeviceHandler) GetDevices(c *gin.Context) {
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	devices, err := h.deviceService.GetByUser(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// DeleteDevice removes one of the current user's devices
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid device ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	device, err := h.deviceService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Device not found"})
+		return
+	}
+
+	if device.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this device"})
+		return
+	}
+
+	if err := h.deviceService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete device"})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: "Device deleted successfully"})
+}
@@ -0,0 +1,141 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/formats"
+	"github.com/th1enq/go-map/internal/models"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// ExportHandler handles trajectory downloads in standard file formats
+type ExportHandler struct {
+	trajectoryService *services.TrajectoryServices
+	stayPointService  *services.StayPointServices
+}
+
+// NewExportHandler creates a new instance of ExportHandler
+func NewExportHandler(
+	trajectoryService *services.TrajectoryServices,
+	stayPointService *services.StayPointServices,
+) *ExportHandler {
+	return &ExportHandler{
+		trajectoryService: trajectoryService,
+		stayPointService:  stayPointService,
+	}
+}
+
+// ExportTrajectory exports a trajectory owned by the current user
+func (h *ExportHandler) ExportTrajectory(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	// Verify that the trajectory belongs to the user
+	if trajectory.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+		return
+	}
+
+	h.export(c, *trajectory)
+}
+
+// AdminExportTrajectory exports any trajectory
+func (h *ExportHandler) AdminExportTrajectory(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	h.export(c, *trajectory)
+}
+
+// export streams the trajectory as an attachment in the requested format
+func (h *ExportHandler) export(c *gin.Context, trajectory models.Trajectory) {
+	format := strings.ToLower(c.DefaultQuery("format", formats.FormatGPX))
+	if !formats.IsExportFormat(format) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid format, expected gpx, kml or geojson"})
+		return
+	}
+
+	simplify, err := parseSimplifyOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	points, err := services.SimplifiedPoints(trajectory, simplify)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to read trajectory points"})
+		return
+	}
+
+	stayPoints, err := h.stayPointService.GetByTrajectoryID(trajectory.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get stay points"})
+		return
+	}
+
+	filename := fmt.Sprintf("trajectory-%d%s", trajectory.ID, formats.FileExtension(format))
+	c.Header("Content-Type", formats.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent at this point, so a write error can only be logged
+	if err := formats.Export(c.Writer, format, trajectory, points, stayPoints); err != nil {
+		log.Printf("failed to export trajectory %d: %v", trajectory.ID, err)
+	}
+}
+
+// parseSimplifyOptions reads the optional simplify (dp, vw or stored) and tolerance query
+// parameters. Tolerance is in meters for dp and square meters for vw.
+func parseSimplifyOptions(c *gin.Context) (services.SimplifyOptions, error) {
+	opts := services.SimplifyOptions{Method: strings.ToLower(c.Query("simplify"))}
+	if opts.Method == "" || opts.Method == services.SimplifyStored {
+		return opts, nil
+	}
+
+	if !algorithms.IsSimplifyMethod(opts.Method) {
+		return opts, &ValidationError{Field: "simplify", Message: "Invalid simplify, expected dp, vw or stored"}
+	}
+
+	opts.Tolerance = algorithms.DefaultSimplifyTolerance(opts.Method)
+	if value := c.Query("tolerance"); value != "" {
+		tolerance, err := strconv.ParseFloat(value, 64)
+		if err != nil || tolerance < 0 {
+			return opts, &ValidationError{Field: "tolerance", Message: "Invalid tolerance, expected a non-negative number"}
+		}
+		opts.Tolerance = tolerance
+	}
+
+	return opts, nil
+}
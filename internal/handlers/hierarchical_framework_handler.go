@@ -2,6 +2,10 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,13 +14,13 @@ import (
 	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/models"
 	"github.com/th1enq/go-map/internal/services"
+	"gorm.io/gorm"
 )
 
 // HierarchicalFrameworkHandler handles operations related to the hierarchical framework
 type HierarchicalFrameworkHandler struct {
 	frameworkService *services.HierarchicalFrameworkService
 	stayPointService *services.StayPointServices
-	locationServices *services.LocationServices
 }
 
 // ClusterResponse represents a cluster in the response
@@ -24,8 +28,9 @@ type ClusterResponse struct {
 	ID         uint    `json:"id"`
 	CenterLat  float64 `json:"center_lat"`
 	CenterLng  float64 `json:"center_lng"`
-	Radius     float64 `json:"radius"`
+	Radius     float64 `json:"radius"` // km
 	LayerID    uint    `json:"layer_id"`
+	ParentID   *uint   `json:"parent_id"`
 	VisitCount int     `json:"visit_count"`
 }
 
@@ -49,101 +54,296 @@ type ChildClustersResponse struct {
 	ChildClusters []ClusterResponse `json:"child_clusters"`
 }
 
+// UpdateFrameworkRequest gives the clustering parameters of a framework that did not record
+// the parameters it was built with; they are stored on the framework and default to those
+// of new frameworks
+type UpdateFrameworkRequest struct {
+	Epsilon     *float64  `json:"epsilon"` // km
+	MinPoints   *int      `json:"min_points"`
+	LayerScales []float64 `json:"layer_scales"`
+}
+
+// ClusterChangesResponse represents a response containing cluster changes
+type ClusterChangesResponse struct {
+	Changes []models.ClusterChange `json:"changes"`
+}
+
+// FrameworksResponse represents a response containing framework versions
+type FrameworksResponse struct {
+	Frameworks []models.HierarchicalFramework `json:"frameworks"`
+}
+
 // NewHierarchicalFrameworkHandler creates a new instance of HierarchicalFrameworkHandler
 func NewHierarchicalFrameworkHandler(
 	frameworkService *services.HierarchicalFrameworkService,
 	stayPointService *services.StayPointServices,
-	locationServices *services.LocationServices,
 ) *HierarchicalFrameworkHandler {
 	return &HierarchicalFrameworkHandler{
 		frameworkService: frameworkService,
 		stayPointService: stayPointService,
-		locationServices: locationServices,
 	}
 }
 
-// BuildFramework builds a new hierarchical framework from stay points
-func (h *HierarchicalFrameworkHandler) BuildFramework() {
+// BuildFramework builds a new, inactive hierarchical framework version from stay points and
+// returns it, nil when there was nothing to build
+func (h *HierarchicalFrameworkHandler) BuildFramework(params algorithms.HierarchicalClusteringParams) *models.HierarchicalFramework {
 	// Get all stay points
 	stayPoints, err := h.stayPointService.GetAll()
 	if err != nil {
 		log.Fatalf("failed to load staypoints: %v", err)
-		return
+		return nil
 	}
 
 	if len(stayPoints) == 0 {
 		log.Println("No stay points found to build framework")
-		return
-	}
-
-	// Define clustering parameters
-	params := algorithms.HierarchicalClusteringParams{
-		Epsilon:     0.1, // 200 meters
-		MinPoints:   2,
-		MaxLayers:   3,
-		LayerScales: []float64{1.0, 2.0, 4.0}, // Each layer has double the scale of the previous
+		return nil
 	}
 
 	// Build the framework
 	framework, err := algorithms.BuildHierarchicalFramework(stayPoints, params)
 	if err != nil {
 		log.Fatalf("failed to build hierarchical framework: %v", err)
-		return
+		return nil
 	}
 
 	if framework == nil {
 		log.Println("Failed to build framework: no valid clusters found")
+		return nil
+	}
+
+	// Save the framework to database, with the parent and the stay points of every cluster
+	if err := h.frameworkService.SaveFramework(framework); err != nil {
+		log.Fatalf("failed to save framework in database: %v", err)
+		return nil
+	}
+	log.Printf("Built framework version %d from %d stay points", framework.Version, framework.StayPointCount)
+
+	// Locations of the bottom layer clusters are created when the framework is activated
+	if len(framework.Layers) == 0 {
+		log.Println("No clusters found in the framework")
+	}
+	return framework
+}
+
+// UpdateFramework updates the active framework from the latest stay points without
+// rebuilding it, logging how the clusters changed. params are used when the framework did
+// not record the parameters it was built with.
+func (h *HierarchicalFrameworkHandler) UpdateFramework(params algorithms.HierarchicalClusteringParams) {
+	framework, err := h.frameworkService.GetActiveFramework()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("No active framework found to update")
+		return
+	}
+	if err != nil {
+		log.Fatalf("failed to load framework: %v", err)
 		return
 	}
+	if recorded, ok := algorithms.FrameworkParams(framework); ok {
+		params = recorded
+	}
 
-	// Save the framework to database
-	dbFramework, err := h.frameworkService.CreateFramework()
+	report, err := h.frameworkService.UpdateFramework(framework.ID, params)
 	if err != nil {
-		log.Fatalf("failed to save framework in database: %v", err)
+		log.Fatalf("failed to update hierarchical framework: %v", err)
+		return
+	}
+
+	for _, layer := range report.Layers {
+		log.Printf("Layer %d: %d unclustered stay points, %d assigned, %d clusters created, %d merged, %d split, %d removed",
+			layer.Level, layer.StayPoints, layer.Assigned, layer.Created, layer.Merged, layer.Split, layer.Removed)
+	}
+}
+
+// AdminUpdateFramework incrementally updates a framework from the current stay points
+func (h *HierarchicalFrameworkHandler) AdminUpdateFramework(c *gin.Context) {
+	frameworkID, err := parseUintParam(c, "frameworkID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid framework ID"})
+		return
+	}
+
+	// The body is optional
+	var req UpdateFrameworkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	framework, err := h.frameworkService.GetFrameworkVersion(frameworkID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Framework not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Save layers and clusters
-	for i, layer := range framework.Layers {
-		// Create layer
-		dbLayer, err := h.frameworkService.CreateLayer(dbFramework.ID, layer.Level)
-		if err != nil {
-			log.Fatalf("failed to create layer: %v", err)
+	// Recorded build parameters, or the defaults for frameworks that did not record them.
+	// Updating with other parameters than a framework was built with would mix clusterings.
+	params, recorded := algorithms.FrameworkParams(framework)
+	if recorded {
+		if req.Epsilon != nil || req.MinPoints != nil || len(req.LayerScales) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "The framework is updated with the parameters it was built with; build a new version to change them"})
 			return
 		}
-
-		// Create clusters in the layer
-		for _, cluster := range layer.Clusters {
-			value, err := h.frameworkService.CreateCluster(
-				dbLayer.ID,
-				cluster.CenterLat,
-				cluster.CenterLng,
-				cluster.Radius,
-				cluster.VisitCount,
-			)
-			if err != nil {
-				log.Fatalf("failed to create cluster: %v", err)
-				return
-			}
-
-			if i == 0 {
-				// Create new location from bottom layer clusters
-				newLocation := models.Location{
-					Latitude:   value.CenterLat,
-					Longitude:  value.CenterLng,
-					ClusterID:  value.ID,
-					VisitCount: value.VisitCount,
-				}
-
-				// Save to database
-				_, err := h.locationServices.Create(newLocation)
-				if err != nil {
-					log.Printf("failed to create location from cluster: %v", err)
-					continue
-				}
-			}
+	} else {
+		params = algorithms.DefaultHierarchicalClusteringParams()
+	}
+	if req.Epsilon != nil {
+		if *req.Epsilon <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "epsilon must be positive"})
+			return
+		}
+		params.Epsilon = *req.Epsilon
+	}
+	if req.MinPoints != nil {
+		if *req.MinPoints < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "min_points must be positive"})
+			return
 		}
+		params.MinPoints = *req.MinPoints
+	}
+	if len(req.LayerScales) > 0 {
+		params.LayerScales = req.LayerScales
+		params.MaxLayers = len(req.LayerScales)
+	}
+
+	report, err := h.frameworkService.UpdateFramework(frameworkID, params)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Framework not found"})
+		return
+	}
+	if errors.Is(err, services.ErrNotIncremental) || errors.Is(err, algorithms.ErrInvalidClusteringParams) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update framework: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetClusterChanges returns the latest cluster changes recorded by incremental updates of a
+// framework
+func (h *HierarchicalFrameworkHandler) GetClusterChanges(c *gin.Context) {
+	frameworkID, err := parseUintParam(c, "frameworkID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid framework ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid limit"})
+		return
+	}
+
+	changes, err := h.frameworkService.GetClusterChanges(frameworkID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ClusterChangesResponse{Changes: changes})
+}
+
+// GetFrameworks returns every framework version with its build parameters
+func (h *HierarchicalFrameworkHandler) GetFrameworks(c *gin.Context) {
+	frameworks, err := h.frameworkService.GetFrameworkVersions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, FrameworksResponse{Frameworks: frameworks})
+}
+
+// AdminActivateFramework makes a framework the one user graphs and recommendations use
+func (h *HierarchicalFrameworkHandler) AdminActivateFramework(c *gin.Context) {
+	frameworkID, err := parseUintParam(c, "frameworkID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid framework ID"})
+		return
+	}
+
+	framework, err := h.frameworkService.ActivateFramework(frameworkID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Framework not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to activate framework: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, framework)
+}
+
+// AdminExportFramework downloads a snapshot of a framework with its layers, clusters and
+// user graphs as a JSON file
+func (h *HierarchicalFrameworkHandler) AdminExportFramework(c *gin.Context) {
+	frameworkID, err := parseUintParam(c, "frameworkID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid framework ID"})
+		return
+	}
+
+	snapshot, err := h.frameworkService.ExportFramework(frameworkID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Framework not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to export framework: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("framework-v%d.json", snapshot.Framework.Version)
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent at this point, so a write error can only be logged
+	if err := json.NewEncoder(c.Writer).Encode(snapshot); err != nil {
+		log.Printf("failed to export framework %d: %v", frameworkID, err)
+	}
+}
+
+// AdminImportFramework stores an uploaded framework snapshot as a new, inactive version
+func (h *HierarchicalFrameworkHandler) AdminImportFramework(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A file must be uploaded in the 'file' field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	var snapshot services.FrameworkSnapshot
+	if err := json.NewDecoder(file).Decode(&snapshot); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid framework snapshot: " + err.Error()})
+		return
+	}
+
+	report, err := h.frameworkService.ImportFramework(&snapshot)
+	if errors.Is(err, services.ErrInvalidSnapshot) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to import framework: " + err.Error()})
+		return
 	}
+
+	c.JSON(http.StatusCreated, report)
 }
 
 // GetClustersAtLayer returns all clusters at a specific layer
@@ -174,21 +374,8 @@ func (h *HierarchicalFrameworkHandler) GetClustersAtLayer(c *gin.Context) {
 		return
 	}
 
-	// Convert to response type
-	clusterResponses := make([]ClusterResponse, len(clusters))
-	for i, cluster := range clusters {
-		clusterResponses[i] = ClusterResponse{
-			ID:         cluster.ID,
-			CenterLat:  cluster.CenterLat,
-			CenterLng:  cluster.CenterLng,
-			Radius:     cluster.Radius,
-			LayerID:    cluster.LayerID,
-			VisitCount: cluster.VisitCount,
-		}
-	}
-
 	c.JSON(http.StatusOK, ClustersResponse{
-		Clusters: clusterResponses,
+		Clusters: newClusterResponses(clusters),
 	})
 }
 
@@ -200,23 +387,17 @@ func (h *HierarchicalFrameworkHandler) GetStayPointsInCluster(c *gin.Context) {
 		return
 	}
 
-	// Get cluster
-	cluster, err := h.frameworkService.GetCluster(clusterID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	if _, ok := h.getCluster(c, clusterID); !ok {
 		return
 	}
 
-	// Get all stay points
-	stayPoints, err := h.stayPointService.GetAll()
+	// Get stay points in the cluster
+	clusterStayPoints, err := h.frameworkService.GetStayPointsInCluster(clusterID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Get stay points in the cluster
-	clusterStayPoints := algorithms.GetStayPointsInCluster(*cluster, stayPoints)
-
 	c.JSON(http.StatusOK, StayPointsResponse{
 		StayPoints: clusterStayPoints,
 	})
@@ -230,39 +411,23 @@ func (h *HierarchicalFrameworkHandler) GetParentCluster(c *gin.Context) {
 		return
 	}
 
-	// Get cluster
-	cluster, err := h.frameworkService.GetCluster(clusterID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	// Get next layer
-	nextLayer, err := h.frameworkService.GetClustersAtLayer(cluster.LayerID + 1)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	cluster, ok := h.getCluster(c, clusterID)
+	if !ok {
 		return
 	}
-
-	// Find parent cluster
-	parent := algorithms.FindParentCluster(*cluster, nextLayer)
-	if parent == nil {
+	if cluster.ParentID == nil {
 		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Parent cluster not found"})
 		return
 	}
 
-	// Convert to response type
-	parentResponse := ClusterResponse{
-		ID:         parent.ID,
-		CenterLat:  parent.CenterLat,
-		CenterLng:  parent.CenterLng,
-		Radius:     parent.Radius,
-		LayerID:    parent.LayerID,
-		VisitCount: parent.VisitCount,
+	// Get parent cluster
+	parent, ok := h.getCluster(c, *cluster.ParentID)
+	if !ok {
+		return
 	}
 
 	c.JSON(http.StatusOK, ParentClusterResponse{
-		ParentCluster: parentResponse,
+		ParentCluster: newClusterResponse(*parent),
 	})
 }
 
@@ -274,39 +439,54 @@ func (h *HierarchicalFrameworkHandler) GetChildClusters(c *gin.Context) {
 		return
 	}
 
-	// Get cluster
-	cluster, err := h.frameworkService.GetCluster(clusterID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	if _, ok := h.getCluster(c, clusterID); !ok {
 		return
 	}
 
-	// Get previous layer
-	prevLayer, err := h.frameworkService.GetClustersAtLayer(cluster.LayerID - 1)
+	// Get child clusters
+	children, err := h.frameworkService.GetChildClusters(clusterID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Find child clusters
-	children := algorithms.FindChildClusters(*cluster, prevLayer)
+	c.JSON(http.StatusOK, ChildClustersResponse{
+		ChildClusters: newClusterResponses(children),
+	})
+}
 
-	// Convert to response type
-	childResponses := make([]ClusterResponse, len(children))
-	for i, child := range children {
-		childResponses[i] = ClusterResponse{
-			ID:         child.ID,
-			CenterLat:  child.CenterLat,
-			CenterLng:  child.CenterLng,
-			Radius:     child.Radius,
-			LayerID:    child.LayerID,
-			VisitCount: child.VisitCount,
-		}
+// getCluster loads a cluster, responding 404 when it does not exist
+func (h *HierarchicalFrameworkHandler) getCluster(c *gin.Context, clusterID uint) (*models.Cluster, bool) {
+	cluster, err := h.frameworkService.GetCluster(clusterID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Cluster not found"})
+		return nil, false
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+	return cluster, true
+}
 
-	c.JSON(http.StatusOK, ChildClustersResponse{
-		ChildClusters: childResponses,
-	})
+func newClusterResponse(cluster models.Cluster) ClusterResponse {
+	return ClusterResponse{
+		ID:         cluster.ID,
+		CenterLat:  cluster.CenterLat,
+		CenterLng:  cluster.CenterLng,
+		Radius:     cluster.Radius,
+		LayerID:    cluster.LayerID,
+		ParentID:   cluster.ParentID,
+		VisitCount: cluster.VisitCount,
+	}
+}
+
+func newClusterResponses(clusters []models.Cluster) []ClusterResponse {
+	responses := make([]ClusterResponse, len(clusters))
+	for i, cluster := range clusters {
+		responses[i] = newClusterResponse(cluster)
+	}
+	return responses
 }
 
 // Helper functions for parameter parsing
@@ -0,0 +1,270 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/formats"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// ImportHandler handles trajectory file uploads
+type ImportHandler struct {
+	importService *services.ImportServices
+}
+
+// ImportResponse reports the per-track outcome of a file upload
+type ImportResponse struct {
+	Message  string                  `json:"message"`
+	Imported int                     `json:"imported"`
+	Failed   int                     `json:"failed"`
+	Results  []services.ImportResult `json:"results"`
+
+	// Locations created from GPX waypoints
+	Locations int    `json:"locations,omitempty"`
+	Warning   string `json:"warning,omitempty"`
+}
+
+// NewImportHandler creates a new instance of ImportHandler
+func NewImportHandler(importService *services.ImportServices) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+	}
+}
+
+// ImportTrajectories imports the tracks of an uploaded file as trajectories of the current user
+func (h *ImportHandler) ImportTrajectories(c *gin.Context) {
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A file must be uploaded in the 'file' field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	kmlOptions, err := parseKMLOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	importOptions, err := parseImportOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var tracks []formats.Track
+	var waypoints []formats.Waypoint
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".gpx":
+		tracks, waypoints, err = formats.ParseGPX(file)
+	case ".kml":
+		tracks, err = formats.ParseKML(file, kmlOptions)
+	case ".kmz":
+		tracks, err = formats.ParseKMZ(file, fileHeader.Size, kmlOptions)
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unsupported file format, expected .gpx, .kml or .kmz"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if len(tracks) == 0 && len(waypoints) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No tracks found in file"})
+		return
+	}
+
+	response := newImportResponse(h.importService.ImportTracks(userID.(uint), tracks, importOptions))
+
+	// Waypoints are kept as named places of the user
+	locations, err := h.importService.ImportWaypoints(userID.(uint), waypoints)
+	response.Locations = locations
+	if err != nil {
+		response.Warning = "Some waypoints could not be stored: " + err.Error()
+	}
+
+	status := http.StatusCreated
+	if response.Imported == 0 && len(waypoints) > 0 && err == nil {
+		// A file of waypoints only has no trajectory to store
+		response.Message = "Waypoints imported successfully"
+	} else if response.Imported == 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, response)
+}
+
+// ImportTakeout imports a Google Takeout location history upload: the whole
+// archive (.zip), Records.json or a monthly Semantic Location History file
+func (h *ImportHandler) ImportTakeout(c *gin.Context) {
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A file must be uploaded in the 'file' field"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read uploaded file"})
+		return
+	}
+	defer file.Close()
+
+	importOptions, err := parseImportOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	data := &formats.TakeoutData{}
+	switch strings.ToLower(filepath.Ext(fileHeader.Filename)) {
+	case ".zip":
+		data, err = formats.ParseTakeoutZip(file, fileHeader.Size)
+	case ".json":
+		err = formats.ParseTakeoutJSON(file, data)
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Unsupported file format, expected .zip or .json"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if len(data.Points) == 0 && len(data.Visits) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "No location records or place visits found in file"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.importService.ImportTakeout(userID.(uint), data, importOptions))
+}
+
+// parseKMLOptions reads the optional synthetic timestamp settings from the form
+func parseKMLOptions(c *gin.Context) (formats.KMLOptions, error) {
+	var opts formats.KMLOptions
+
+	if value := c.PostForm("synthetic_timestamps"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, &ValidationError{Field: "synthetic_timestamps", Message: "invalid synthetic_timestamps value"}
+		}
+		opts.SyntheticTimestamps = enabled
+	}
+
+	if value := c.PostForm("synthetic_start"); value != "" {
+		start, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, &ValidationError{Field: "synthetic_start", Message: "invalid synthetic_start, must be RFC3339"}
+		}
+		opts.SyntheticStart = start
+	}
+
+	if value := c.PostForm("synthetic_interval"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return opts, &ValidationError{Field: "synthetic_interval", Message: "invalid synthetic_interval, e.g. 5s"}
+		}
+		opts.SyntheticInterval = interval
+	}
+
+	return opts, nil
+}
+
+// parseImportOptions reads the optional noise filter and trip settings from the form.
+// Filtering uses the defaults unless filter_noise=false; max_speed (m/s), median_window
+// and kalman override single filters. split_trips=true stores one trajectory per trip.
+func parseImportOptions(c *gin.Context) (services.ImportOptions, error) {
+	opts := services.DefaultImportOptions()
+
+	if value := c.PostForm("split_trips"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, &ValidationError{Field: "split_trips", Message: "invalid split_trips value"}
+		}
+		opts.SplitTrips = enabled
+	}
+
+	if value := c.PostForm("filter_noise"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, &ValidationError{Field: "filter_noise", Message: "invalid filter_noise value"}
+		}
+		if !enabled {
+			opts.NoiseFilter = algorithms.NoiseFilterParams{}
+			return opts, nil
+		}
+	}
+
+	if value := c.PostForm("max_speed"); value != "" {
+		maxSpeed, err := strconv.ParseFloat(value, 64)
+		if err != nil || maxSpeed < 0 {
+			return opts, &ValidationError{Field: "max_speed", Message: "invalid max_speed, must be m/s or 0 to disable"}
+		}
+		opts.NoiseFilter.MaxSpeed = maxSpeed
+	}
+
+	if value := c.PostForm("median_window"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil || window < 0 || (window > 1 && window%2 == 0) {
+			return opts, &ValidationError{Field: "median_window", Message: "invalid median_window, must be an odd number of points or 0 to disable"}
+		}
+		opts.NoiseFilter.MedianWindow = window
+	}
+
+	if value := c.PostForm("kalman"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, &ValidationError{Field: "kalman", Message: "invalid kalman value"}
+		}
+		opts.NoiseFilter.Kalman = enabled
+	}
+
+	return opts, nil
+}
+
+// newImportResponse counts the stored and failed tracks of an import
+func newImportResponse(results []services.ImportResult) ImportResponse {
+	response := ImportResponse{Results: results}
+	for _, result := range results {
+		if result.Error == "" {
+			response.Imported++
+		} else {
+			response.Failed++
+		}
+	}
+
+	response.Message = "Trajectories imported successfully"
+	if response.Imported == 0 {
+		response.Message = "No trajectories could be imported"
+	} else if response.Failed > 0 {
+		response.Message = "Some tracks could not be imported"
+	}
+	return response
+}
@@ -5,10 +5,14 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/th1enq/go-map/internal/algorithms"
@@ -19,89 +23,418 @@ import (
 
 // LoadingDataHandler handles the loading and processing of trajectory data
 type LoadingDataHandler struct {
-	trajectoryService *services.TrajectoryServices
-	stayPointService  *services.StayPointServices
-	userService       *services.UserServices
+	userService         *services.UserServices
+	stayPointService    *services.StayPointServices
+	segmentService      *services.TrajectorySegmentServices
+	importRecordService *services.ImportRecordServices
+}
+
+// LoadOptions configures a GeoLife dataset load
+type LoadOptions struct {
+	DataDir          string        // Root of the dataset, containing the Data directory
+	Workers          int           // Number of files processed concurrently
+	BatchSize        int           // Files stored per bulk insert transaction
+	Users            []string      // User folders to load, all users when empty
+	ProgressInterval time.Duration // How often progress is reported, never when zero
+	NoiseFilter      algorithms.NoiseFilterParams
+}
+
+// LoadSummary reports the outcome of a GeoLife dataset load
+type LoadSummary struct {
+	UserIDs    []uint // Users of the loaded folders
+	Changed    []uint // Of those, users who got new stay points
+	Files      int    // Files imported by this run
+	Skipped    int    // Files already imported by a previous run
+	Failed     int    // Files that failed and will be retried by the next run
+	Points     int64
+	StayPoints int
+	Dropped    int64 // Points removed by the noise filter
+	Adjusted   int64 // Points moved by the noise filter
+	Elapsed    time.Duration
+
+	userFolders []string // Folder of each entry of UserIDs
+}
+
+// pltJob is a single trajectory file waiting to be imported
+type pltJob struct {
+	userID     uint
+	path       string
+	sourcePath string
+	size       int64
+	stayParams algorithms.StayPointParams // Stay point thresholds configured for the user
+}
+
+// maxBatchPoints bounds the points held by a worker before its batch is stored
+const maxBatchPoints = 250000
+
+// pltBatch collects parsed files of a worker until they are stored together
+type pltBatch struct {
+	jobs    []pltJob
+	files   []services.FileImport
+	reports []algorithms.NoiseFilterReport
+	points  int
+}
+
+// pltResult is the outcome of importing a pltJob
+type pltResult struct {
+	job        pltJob
+	points     int
+	stayPoints int
+	filter     algorithms.NoiseFilterReport
+	err        error
+}
+
+// loadProgress tracks the throughput of a running load
+type loadProgress struct {
+	start      time.Time
+	totalFiles int
+	totalBytes int64
+	files      atomic.Int64
+	bytes      atomic.Int64
+	points     atomic.Int64
 }
 
 // NewLoadingDataHandler creates a new instance of LoadingDataHandler
 func NewLoadingDataHandler(
-	trajectoryService *services.TrajectoryServices,
-	stayPointService *services.StayPointServices,
 	userService *services.UserServices,
+	stayPointService *services.StayPointServices,
+	segmentService *services.TrajectorySegmentServices,
+	importRecordService *services.ImportRecordServices,
 ) *LoadingDataHandler {
 	return &LoadingDataHandler{
-		trajectoryService: trajectoryService,
-		stayPointService:  stayPointService,
-		userService:       userService,
+		userService:         userService,
+		stayPointService:    stayPointService,
+		segmentService:      segmentService,
+		importRecordService: importRecordService,
 	}
 }
 
-// LoadGeolifeData loads trajectory data from the Geolife dataset
-func (l *LoadingDataHandler) LoadGeolifeData(dataDir string) error {
+// LoadGeolifeData loads trajectory data from the Geolife dataset. Files are imported by a
+// pool of workers and each file is recorded once stored, so a rerun after an interruption
+// only processes the files that are still missing or failed.
+func (l *LoadingDataHandler) LoadGeolifeData(opts LoadOptions) (*LoadSummary, error) {
 	// Check if the data directory exists
-	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
-		return fmt.Errorf("data directory not found: %s", dataDir)
+	if _, err := os.Stat(opts.DataDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("data directory not found: %s", opts.DataDir)
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
 	}
 
-	// Iterate through user directories
-	userDirs, err := os.ReadDir(filepath.Join(dataDir, "Data"))
+	jobs, summary, err := l.collectJobs(opts)
 	if err != nil {
-		return fmt.Errorf("error reading Data directory: %w", err)
+		return nil, err
 	}
 
-	for _, userDir := range userDirs {
-		if !userDir.IsDir() {
+	progress := &loadProgress{start: time.Now(), totalFiles: len(jobs)}
+	for _, job := range jobs {
+		progress.totalBytes += job.size
+	}
+	log.Printf("Loading %d files for %d users with %d workers (%d files already imported)",
+		len(jobs), len(summary.UserIDs), opts.Workers, summary.Skipped)
+
+	// Report progress periodically until all results are collected
+	done := make(chan struct{})
+	if opts.ProgressInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(opts.ProgressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					progress.report()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	jobCh := make(chan pltJob)
+	resultCh := make(chan pltResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := &pltBatch{}
+			for job := range jobCh {
+				file, report, result := l.preparePLTFile(job, opts.NoiseFilter)
+				if file == nil {
+					resultCh <- result
+					continue
+				}
+
+				batch.jobs = append(batch.jobs, job)
+				batch.files = append(batch.files, *file)
+				batch.reports = append(batch.reports, report)
+				batch.points += file.PointCount
+				if len(batch.files) >= opts.BatchSize || batch.points >= maxBatchPoints {
+					l.storeBatch(batch, resultCh)
+				}
+			}
+			l.storeBatch(batch, resultCh)
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobCh <- job
+		}
+		close(jobCh)
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	failedUsers := make(map[uint]bool)
+	changedUsers := make(map[uint]bool)
+	for result := range resultCh {
+		progress.files.Add(1)
+		progress.bytes.Add(result.job.size)
+		progress.points.Add(int64(result.points))
+
+		if result.err != nil {
+			summary.Failed++
+			failedUsers[result.job.userID] = true
+			log.Printf("Error processing file %s: %v", result.job.sourcePath, result.err)
+			continue
+		}
+		summary.Files++
+		summary.Points += int64(result.points)
+		summary.StayPoints += result.stayPoints
+		if result.stayPoints > 0 {
+			changedUsers[result.job.userID] = true
+		}
+		summary.Dropped += int64(result.filter.Dropped)
+		summary.Adjusted += int64(result.filter.Adjusted)
+	}
+	close(done)
+	progress.report()
+
+	// Labels refer to time ranges across trajectories, so they are linked once all files are in
+	for i, userID := range summary.UserIDs {
+		if changedUsers[userID] {
+			summary.Changed = append(summary.Changed, userID)
+		}
+		if failedUsers[userID] {
+			log.Printf("Skipping labels of user %s until all of its files are imported", summary.userFolders[i])
 			continue
 		}
+		l.importUserLabels(opts.DataDir, summary.userFolders[i], userID)
+	}
+
+	summary.Elapsed = time.Since(progress.start)
+	return summary, nil
+}
+
+// collectJobs resolves the users to load and lists their trajectory files that have
+// not been imported yet
+func (l *LoadingDataHandler) collectJobs(opts LoadOptions) ([]pltJob, *LoadSummary, error) {
+	userDirs, err := os.ReadDir(filepath.Join(opts.DataDir, "Data"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading Data directory: %w", err)
+	}
 
+	wanted := make(map[string]bool, len(opts.Users))
+	for _, user := range opts.Users {
+		wanted[user] = true
+	}
+
+	summary := &LoadSummary{}
+	var jobs []pltJob
+	for _, userDir := range userDirs {
 		userFolder := userDir.Name()
+		if !userDir.IsDir() || (len(wanted) > 0 && !wanted[userFolder]) {
+			continue
+		}
+		delete(wanted, userFolder)
+
 		// Create or find corresponding user in the database
 		user, err := l.userService.FindOrCreateByFolder(userFolder)
 		if err != nil {
-			if err.Error() == "user data already imported" {
-				fmt.Printf("Skipping user %s: data already imported\n", userFolder)
-				continue
-			}
-			fmt.Printf("Error getting user for folder %s: %v\n", userFolder, err)
-			continue
+			return nil, nil, fmt.Errorf("error getting user for folder %s: %w", userFolder, err)
 		}
+		summary.UserIDs = append(summary.UserIDs, user.ID)
+		summary.userFolders = append(summary.userFolders, userFolder)
 
-		userID := user.ID
+		stayParams, err := l.stayPointService.ParamsForUser(user.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading stay point settings for user %s: %w", userFolder, err)
+		}
 
-		trajectoryPath := filepath.Join(dataDir, "Data", userFolder, "Trajectory")
-		if _, err := os.Stat(trajectoryPath); os.IsNotExist(err) {
-			continue
+		completed, err := l.importRecordService.GetCompletedPaths(user.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading import records for user %s: %w", userFolder, err)
 		}
 
+		trajectoryPath := filepath.Join(opts.DataDir, "Data", userFolder, "Trajectory")
 		files, err := os.ReadDir(trajectoryPath)
-		if err != nil {
-			fmt.Printf("Error reading trajectory directory for user %s: %v\n", userFolder, err)
+		if os.IsNotExist(err) {
 			continue
 		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading trajectory directory for user %s: %w", userFolder, err)
+		}
 
 		for _, file := range files {
 			if filepath.Ext(file.Name()) != ".plt" {
 				continue
 			}
 
-			filePath := filepath.Join(trajectoryPath, file.Name())
-			err = l.processPLTFile(filePath, userID)
-			if err != nil {
-				fmt.Printf("Error processing file %s: %v\n", filePath, err)
+			sourcePath := filepath.ToSlash(filepath.Join("Data", userFolder, "Trajectory", file.Name()))
+			if completed[sourcePath] {
+				summary.Skipped++
 				continue
 			}
+
+			info, err := file.Info()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			jobs = append(jobs, pltJob{
+				userID:     user.ID,
+				path:       filepath.Join(trajectoryPath, file.Name()),
+				sourcePath: sourcePath,
+				size:       info.Size(),
+				stayParams: stayParams,
+			})
 		}
 	}
 
-	return nil
+	if len(wanted) > 0 {
+		missing := make([]string, 0, len(wanted))
+		for user := range wanted {
+			missing = append(missing, user)
+		}
+		sort.Strings(missing)
+		return nil, nil, fmt.Errorf("user folders not found: %s", strings.Join(missing, ", "))
+	}
+
+	return jobs, summary, nil
+}
+
+// preparePLTFile parses a trajectory file, filters its noise and detects its stay points.
+// It returns nil and the final result when the file is empty or cannot be read.
+func (l *LoadingDataHandler) preparePLTFile(job pltJob, filter algorithms.NoiseFilterParams) (*services.FileImport, algorithms.NoiseFilterReport, pltResult) {
+	result := pltResult{job: job}
+
+	points, err := parsePLTFile(job.path)
+	if err == nil && len(points) == 0 {
+		result.err = l.importRecordService.RecordEmpty(job.userID, job.sourcePath)
+		return nil, result.filter, result
+	}
+
+	var file *services.FileImport
+	if err == nil {
+		points, result.filter = algorithms.FilterNoise(points, filter)
+		file, err = newPLTFileImport(job, points)
+	}
+
+	if err != nil {
+		l.recordFailure(job, err)
+		result.err = err
+		return nil, result.filter, result
+	}
+
+	return file, result.filter, result
+}
+
+// storeBatch stores the files of a batch in one transaction, reports their results and empties the batch
+func (l *LoadingDataHandler) storeBatch(batch *pltBatch, resultCh chan<- pltResult) {
+	if len(batch.files) == 0 {
+		return
+	}
+
+	records, err := l.importRecordService.ImportFiles(batch.files)
+	if err != nil && len(batch.files) > 1 {
+		// Store the files one by one so that a single bad file does not fail the others
+		for i := range batch.files {
+			l.storeBatch(&pltBatch{
+				jobs:    batch.jobs[i : i+1],
+				files:   batch.files[i : i+1],
+				reports: batch.reports[i : i+1],
+			}, resultCh)
+		}
+		*batch = pltBatch{}
+		return
+	}
+
+	for i, job := range batch.jobs {
+		result := pltResult{job: job, filter: batch.reports[i]}
+		if err != nil {
+			l.recordFailure(job, err)
+			result.err = err
+		} else {
+			result.points = records[i].PointCount
+			result.stayPoints = records[i].StayPointCount
+		}
+		resultCh <- result
+	}
+
+	*batch = pltBatch{}
+}
+
+// recordFailure marks a file as failed so that the next run retries it
+func (l *LoadingDataHandler) recordFailure(job pltJob, err error) {
+	if recordErr := l.importRecordService.RecordFailure(job.userID, job.sourcePath, err); recordErr != nil {
+		log.Printf("Error recording failure of %s: %v", job.sourcePath, recordErr)
+	}
 }
 
-// processPLTFile processes a single PLT file and extracts trajectory data
-func (l *LoadingDataHandler) processPLTFile(filePath string, userID uint) error {
+// newPLTFileImport builds the trajectory of a parsed file and detects its stay points;
+// they are linked to the trajectory once it is stored
+func newPLTFileImport(job pltJob, points []models.GPSPoint) (*services.FileImport, error) {
+	// Convert points to JSON
+	pointsJSON, err := json.Marshal(points)
+	if err != nil {
+		return nil, err
+	}
+
+	var startTime, endTime time.Time
+	for _, point := range points {
+		if startTime.IsZero() || point.Timestamp.Before(startTime) {
+			startTime = point.Timestamp
+		}
+		if endTime.IsZero() || point.Timestamp.After(endTime) {
+			endTime = point.Timestamp
+		}
+	}
+
+	trajectory := models.Trajectory{
+		UserID:    job.userID,
+		Points:    datatypes.JSON(pointsJSON),
+		StartTime: startTime,
+		EndTime:   endTime,
+		Stats:     algorithms.TrajectoryStatistics(points),
+	}
+
+	stayPoints := algorithms.DetectStayPoints(trajectory, job.stayParams)
+
+	return &services.FileImport{
+		SourcePath: job.sourcePath,
+		Trajectory: trajectory,
+		PointCount: len(points),
+		StayPoints: stayPoints,
+	}, nil
+}
+
+const (
+	feetToMeters = 0.3048
+	// pltNoAltitude marks an unknown altitude in GeoLife PLT files
+	pltNoAltitude = -777
+)
+
+// parsePLTFile reads the points of a GeoLife PLT file. Altitudes are converted from feet to
+// meters; the -777 marker of an unknown altitude is kept, so statistics still skip it.
+func parsePLTFile(filePath string) ([]models.GPSPoint, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
@@ -110,12 +443,11 @@ func (l *LoadingDataHandler) processPLTFile(filePath string, userID uint) error
 	// Skip first 6 lines (header)
 	for i := 0; i < 6; i++ {
 		if !scanner.Scan() {
-			return fmt.Errorf("file too short, cannot skip header")
+			return nil, fmt.Errorf("file too short, cannot skip header")
 		}
 	}
 
 	var points []models.GPSPoint
-	var startTime, endTime time.Time
 
 	// Read data
 	for scanner.Scan() {
@@ -140,6 +472,9 @@ func (l *LoadingDataHandler) processPLTFile(filePath string, userID uint) error
 		if err != nil {
 			continue
 		}
+		if altitude != pltNoAltitude {
+			altitude *= feetToMeters
+		}
 
 		// Parse date and time
 		dateStr := fields[5] + " " + fields[6]
@@ -148,64 +483,127 @@ func (l *LoadingDataHandler) processPLTFile(filePath string, userID uint) error
 			continue
 		}
 
-		point := models.GPSPoint{
+		points = append(points, models.GPSPoint{
 			Latitude:  lat,
 			Longitude: lng,
 			Altitude:  altitude,
 			Timestamp: timestamp,
-		}
+		})
+	}
 
-		points = append(points, point)
+	return points, scanner.Err()
+}
 
-		// Update start and end times
-		if startTime.IsZero() || timestamp.Before(startTime) {
-			startTime = timestamp
-		}
-		if endTime.IsZero() || timestamp.After(endTime) {
-			endTime = timestamp
-		}
+// report logs the throughput of the load and the estimated remaining time
+func (p *loadProgress) report() {
+	files := p.files.Load()
+	bytes := p.bytes.Load()
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return
 	}
 
-	if len(points) == 0 {
-		return nil
+	percent := 100.0
+	if p.totalFiles > 0 {
+		percent = float64(files) / float64(p.totalFiles) * 100
 	}
 
-	// Convert points to JSON
-	pointsJSON, err := json.Marshal(points)
+	// The remaining time is estimated from bytes since file sizes vary widely
+	eta := "unknown"
+	if bytes > 0 {
+		remaining := float64(p.totalBytes-bytes) / (float64(bytes) / elapsed)
+		eta = (time.Duration(remaining) * time.Second).String()
+	}
+
+	log.Printf("Progress: %d/%d files (%.1f%%), %.1f files/s, %.0f points/s, ETA %s",
+		files, p.totalFiles, percent,
+		float64(files)/elapsed, float64(p.points.Load())/elapsed, eta)
+}
+
+// importUserLabels imports the labels.txt file of a user folder, if any, unless
+// the user already has labelled segments
+func (l *LoadingDataHandler) importUserLabels(dataDir, userFolder string, userID uint) {
+	labelsPath := filepath.Join(dataDir, "Data", userFolder, "labels.txt")
+	if _, err := os.Stat(labelsPath); os.IsNotExist(err) {
+		return
+	}
+
+	imported, err := l.segmentService.HasSegments(userID, models.SourceLabel)
 	if err != nil {
-		return err
+		log.Printf("Error checking labels for user %s: %v", userFolder, err)
+		return
+	}
+	if imported {
+		return
 	}
 
-	// Create new trajectory
-	trajectory := models.Trajectory{
-		UserID:    userID,
-		Points:    datatypes.JSON(pointsJSON),
-		StartTime: startTime,
-		EndTime:   endTime,
+	if err := l.processLabelsFile(labelsPath, userID); err != nil {
+		log.Printf("Error processing file %s: %v", labelsPath, err)
 	}
+}
 
-	// Save trajectory to database
-	trajectoryID, err := l.trajectoryService.Create(trajectory)
+// processLabelsFile processes a GeoLife labels.txt file and stores its transportation modes
+// as segments of the user's trajectories
+func (l *LoadingDataHandler) processLabelsFile(filePath string, userID uint) error {
+	file, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	// Skip header line
+	if !scanner.Scan() {
+		return fmt.Errorf("file too short, cannot skip header")
+	}
+
+	var labels []services.ModeLabel
 
-	// Update ID
-	trajectory.ID = trajectoryID
+	// Read data: Start Time, End Time, Transportation Mode separated by tabs
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), "\t")
+		if len(fields) < 3 {
+			continue
+		}
 
-	// Detect stay points
-	stayPoints := algorithms.StayPointDetection(
-		trajectory,
-		200,            // 200m distance threshold
-		30*time.Minute, // 30 minutes time threshold
-	)
+		startTime, err := time.Parse("2006/01/02 15:04:05", fields[0])
+		if err != nil {
+			continue
+		}
 
-	// Save stay points to database
-	if len(stayPoints) > 0 {
-		err = l.stayPointService.BatchCreate(stayPoints)
+		endTime, err := time.Parse("2006/01/02 15:04:05", fields[1])
 		if err != nil {
-			fmt.Printf("Error saving stay points: %v\n", err)
+			continue
+		}
+
+		mode := models.TransportMode(strings.ToLower(strings.TrimSpace(fields[2])))
+		if !models.IsValidTransportMode(mode) || endTime.Before(startTime) {
+			continue
 		}
+
+		labels = append(labels, services.ModeLabel{
+			StartTime: startTime,
+			EndTime:   endTime,
+			Mode:      mode,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+
+	created, unmatched, err := l.segmentService.ImportLabels(userID, labels)
+	if err != nil {
+		return err
+	}
+
+	if unmatched > 0 {
+		log.Printf("Imported %d segments from %s, %d labels matched no trajectory", created, filePath, unmatched)
 	}
 
 	return nil
@@ -23,6 +23,7 @@ type CreateLocationRequest struct {
 	Longitude   float64                 `json:"longitude" binding:"required"`
 	Description string                  `json:"description"`
 	Category    models.LocationCategory `json:"category" binding:"required"`
+	Activities  []string                `json:"activities"`
 }
 
 // LocationResponse represents a location in the response
@@ -73,6 +74,7 @@ func (h *LocationHandler) CreateLocation(c *gin.Context) {
 		Longitude:   req.Longitude,
 		Description: req.Description,
 		Category:    req.Category,
+		Activities:  req.Activities,
 		UserID:      userID.(uint),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
@@ -122,6 +124,116 @@ func (h *LocationHandler) GetUserLocations(c *gin.Context) {
 	})
 }
 
+const (
+	defaultSearchRadius = 1.0  // kilometers
+	maxSearchRadius     = 50.0 // kilometers
+	defaultSearchLimit  = 10
+	maxSearchLimit      = 100
+)
+
+// FindNearbyLocations returns the current user's locations around a point, nearest first.
+// With an activity parameter only locations tagged with that activity are returned.
+func (h *LocationHandler) FindNearbyLocations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	params, err := extractRadiusSearchParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var locations []models.Location
+	if params.Activity != "" {
+		locations, err = h.locationService.SearchByActivity(userID.(uint), params.Latitude, params.Longitude, params.Activity, params.Radius)
+	} else {
+		locations, err = h.locationService.FindNearby(userID.(uint), params.Latitude, params.Longitude, params.Radius)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to find nearby locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locations": locations,
+		"total":     len(locations),
+	})
+}
+
+// FindMostVisitedLocations returns the current user's most visited locations around a point
+func (h *LocationHandler) FindMostVisitedLocations(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	params, err := extractRadiusSearchParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	limit, err := extractSearchLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	locations, err := h.locationService.FindMostVisited(userID.(uint), params.Latitude, params.Longitude, params.Radius, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to find most visited locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"locations": locations,
+		"total":     len(locations),
+	})
+}
+
+// extractRadiusSearchParams reads lat, lng, radius (km) and activity, applying the default
+// radius and rejecting radii the spatial index cannot answer quickly
+func extractRadiusSearchParams(c *gin.Context) (SearchParams, error) {
+	params, err := extractSearchParams(c)
+	if err != nil {
+		return params, err
+	}
+
+	if params.Latitude < -90 || params.Latitude > 90 {
+		return params, &ValidationError{Field: "lat", Message: "latitude must be between -90 and 90"}
+	}
+	if params.Longitude < -180 || params.Longitude > 180 {
+		return params, &ValidationError{Field: "lng", Message: "longitude must be between -180 and 180"}
+	}
+
+	if params.Radius == 0 {
+		params.Radius = defaultSearchRadius
+	}
+	if params.Radius < 0 || params.Radius > maxSearchRadius {
+		return params, &ValidationError{Field: "radius", Message: "radius must be between 0 and 50 km"}
+	}
+
+	return params, nil
+}
+
+// extractSearchLimit reads the optional limit of a search
+func extractSearchLimit(c *gin.Context) (int, error) {
+	limitStr := c.Query("limit")
+	if limitStr == "" {
+		return defaultSearchLimit, nil
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 || limit > maxSearchLimit {
+		return 0, &ValidationError{Field: "limit", Message: "limit must be between 1 and 100"}
+	}
+	return limit, nil
+}
+
 // getPaginationParams extracts pagination parameters from the request
 func (h *LocationHandler) getPaginationParams(c *gin.Context) (int, int) {
 	// Default pagination values
@@ -0,0 +1,147 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/models"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// OwnTracksHandler ingests positions published by the OwnTracks app in HTTP mode
+type OwnTracksHandler struct {
+	deviceService   *services.DeviceServices
+	trackingService *services.TrackingServices
+}
+
+// OwnTracksMessage is an OwnTracks JSON payload; only location messages are stored
+type OwnTracksMessage struct {
+	Type      string   `json:"_type"`
+	Latitude  *float64 `json:"lat"`
+	Longitude *float64 `json:"lon"`
+	Altitude  float64  `json:"alt"`
+	Timestamp int64    `json:"tst"`
+	TrackerID string   `json:"tid"`
+}
+
+// NewOwnTracksHandler creates a new instance of OwnTracksHandler
+func NewOwnTracksHandler(deviceService *services.DeviceServices, trackingService *services.TrackingServices) *OwnTracksHandler {
+	return &OwnTracksHandler{
+		deviceService:   deviceService,
+		trackingService: trackingService,
+	}
+}
+
+// Publish stores the location messages of a request in the device's daily trajectory
+func (h *OwnTracksHandler) Publish(c *gin.Context) {
+	// Both set by DeviceAuth; deviceID is only present for token-authenticated requests
+	userID := c.GetUint("userID")
+	deviceID := c.GetUint("deviceID")
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read request body"})
+		return
+	}
+
+	// OwnTracks publishes single objects, but batches are accepted as well
+	var messages []OwnTracksMessage
+	body = bytes.TrimSpace(body)
+	if bytes.HasPrefix(body, []byte("[")) {
+		err = json.Unmarshal(body, &messages)
+	} else {
+		var message OwnTracksMessage
+		err = json.Unmarshal(body, &message)
+		messages = []OwnTracksMessage{message}
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid OwnTracks payload"})
+		return
+	}
+
+	// Group location points by UTC day so that each lands in its daily trajectory
+	pointsByDay := make(map[string][]models.GPSPoint)
+	trackerID := ""
+	for _, message := range messages {
+		if message.Type != "location" || message.Latitude == nil || message.Longitude == nil || message.Timestamp == 0 {
+			continue
+		}
+		if trackerID == "" {
+			trackerID = message.TrackerID
+		}
+
+		timestamp := time.Unix(message.Timestamp, 0).UTC()
+		day := timestamp.Format("2006-01-02")
+		pointsByDay[day] = append(pointsByDay[day], models.GPSPoint{
+			Latitude:  *message.Latitude,
+			Longitude: *message.Longitude,
+			Altitude:  message.Altitude,
+			Timestamp: timestamp,
+		})
+	}
+
+	if len(pointsByDay) == 0 {
+		// Non-location messages (transitions, cards, ...) are acknowledged and ignored
+		c.JSON(http.StatusOK, []any{})
+		return
+	}
+
+	device, err := h.resolveDevice(c, userID, deviceID, trackerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to resolve device"})
+		return
+	}
+
+	days := make([]string, 0, len(pointsByDay))
+	for day := range pointsByDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, day := range days {
+		points := pointsByDay[day]
+		trajectory, err := h.trackingService.DailyTrajectory(userID, device.ID, device.Name, points[0].Timestamp)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to open daily trajectory"})
+			return
+		}
+
+		if _, err := h.trackingService.AppendPoints(userID, trajectory.ID, points); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to store location: " + err.Error()})
+			return
+		}
+	}
+
+	if err := h.deviceService.TouchLastSeen(device.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update device"})
+		return
+	}
+
+	// OwnTracks expects a JSON array of messages to deliver back to the device
+	c.JSON(http.StatusOK, []any{})
+}
+
+// resolveDevice returns the token's device, or finds the device named by the
+// X-Limit-D header (falling back to the tracker ID) for credential-authenticated requests
+func (h *OwnTracksHandler) resolveDevice(c *gin.Context, userID, deviceID uint, trackerID string) (*models.TrackingDevice, error) {
+	if deviceID != 0 {
+		return h.deviceService.GetByID(deviceID)
+	}
+
+	name := strings.TrimSpace(c.GetHeader("X-Limit-D"))
+	if name == "" {
+		name = trackerID
+	}
+	if name == "" {
+		name = "owntracks"
+	}
+
+	return h.deviceService.FindOrCreate(userID, name)
+}
@@ -2,16 +2,19 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/th1enq/go-map/internal/services"
+	"gorm.io/gorm"
 )
 
 // RecommendHandler handles location recommendation requests
 type RecommendHandler struct {
 	recommendService *services.RecommendationService
+	frameworkService *services.HierarchicalFrameworkService
 }
 
 // RecommendationParams represents common recommendation parameters
@@ -22,9 +25,10 @@ type RecommendationParams struct {
 }
 
 // NewRecommendHandler creates a new instance of RecommendHandler
-func NewRecommendHandler(r *services.RecommendationService) *RecommendHandler {
+func NewRecommendHandler(r *services.RecommendationService, frameworkService *services.HierarchicalFrameworkService) *RecommendHandler {
 	return &RecommendHandler{
 		recommendService: r,
+		frameworkService: frameworkService,
 	}
 }
 
@@ -57,7 +61,8 @@ func (r *RecommendHandler) RecommendByHotStayPoint(c *gin.Context) {
 	c.JSON(http.StatusOK, locations)
 }
 
-// RecommendBySameTrajectory recommends locations based on similar user trajectories
+// RecommendBySameTrajectory recommends locations based on similar user trajectories in
+// the graphs of the active framework
 func (r *RecommendHandler) RecommendBySameTrajectory(c *gin.Context) {
 	userIDStr := c.Param("id")
 	userID, err := strconv.ParseUint(userIDStr, 10, 0)
@@ -66,19 +71,20 @@ func (r *RecommendHandler) RecommendBySameTrajectory(c *gin.Context) {
 		return
 	}
 
+	framework, err := r.frameworkService.GetActiveFramework()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "No active framework"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Default parameters for recommendation
-	clusterLevel := 1
 	similarityThreshold := 0.5
 	maxResults := 5
 
-	// Get custom parameters if provided
-	levelStr := c.Query("level")
-	if levelStr != "" {
-		if level, err := strconv.Atoi(levelStr); err == nil && level > 0 {
-			clusterLevel = level
-		}
-	}
-
 	thresholdStr := c.Query("threshold")
 	if thresholdStr != "" {
 		if threshold, err := strconv.ParseFloat(thresholdStr, 64); err == nil && threshold > 0 && threshold <= 1 {
@@ -96,7 +102,7 @@ func (r *RecommendHandler) RecommendBySameTrajectory(c *gin.Context) {
 	// Get recommendations based on trajectory similarity
 	clusters, err := r.recommendService.GetRecommendations(
 		uint(userID),
-		uint(clusterLevel),
+		framework.ID,
 		similarityThreshold,
 		maxResults,
 	)
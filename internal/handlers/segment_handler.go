@@ -0,0 +1,102 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// SegmentHandler handles requests for the transportation-mode segments of trajectories
+type SegmentHandler struct {
+	trajectoryService *services.TrajectoryServices
+	segmentService    *services.TrajectorySegmentServices
+}
+
+// NewSegmentHandler creates a new instance of SegmentHandler
+func NewSegmentHandler(
+	trajectoryService *services.TrajectoryServices,
+	segmentService *services.TrajectorySegmentServices,
+) *SegmentHandler {
+	return &SegmentHandler{
+		trajectoryService: trajectoryService,
+		segmentService:    segmentService,
+	}
+}
+
+// GetTrajectorySegments returns the mode-annotated segments of a trajectory owned by the current user
+func (h *SegmentHandler) GetTrajectorySegments(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	// Verify that the trajectory belongs to the user
+	if trajectory.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+		return
+	}
+
+	segments, err := h.segmentService.GetByTrajectoryID(trajectory.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get trajectory segments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, segments)
+}
+
+// AdminGetTrajectorySegments returns the mode-annotated segments of any trajectory
+func (h *SegmentHandler) AdminGetTrajectorySegments(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	segments, err := h.segmentService.GetByTrajectoryID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get trajectory segments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, segments)
+}
+
+// AdminClassifyTrajectory (re)infers the transportation modes of a trajectory without labels
+func (h *SegmentHandler) AdminClassifyTrajectory(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	segments, err := h.segmentService.ClassifyTrajectory(*trajectory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to classify trajectory: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, segments)
+}
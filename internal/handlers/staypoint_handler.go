@@ -0,0 +1,269 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// StayPointHandler handles stay point search requests and the admin stay point settings
+type StayPointHandler struct {
+	stayPointService *services.StayPointServices
+	userService      *services.UserServices
+}
+
+// StayPointSettingsRequest sets the stay point detector, sequential by default, and its thresholds
+type StayPointSettingsRequest struct {
+	Algorithm         string  `json:"algorithm"`
+	DistanceThreshold float64 `json:"distance_threshold" binding:"required,gt=0"` // Meters
+	TimeThreshold     int     `json:"time_threshold" binding:"required,gt=0"`     // Seconds
+}
+
+// StayPointSettingsResponse reports the stored settings, if any, and those in effect
+type StayPointSettingsResponse struct {
+	Settings          *models.StayPointSettings `json:"settings"`
+	Algorithm         string                    `json:"algorithm"`
+	DistanceThreshold float64                   `json:"distance_threshold"`
+	TimeThreshold     int                       `json:"time_threshold"`
+}
+
+// RegenerateStayPointsRequest selects the trajectories whose stay points are detected
+// again. The algorithm and both thresholds override the configured ones when given.
+type RegenerateStayPointsRequest struct {
+	UserIDs           []uint   `json:"user_ids"`
+	TrajectoryIDs     []uint   `json:"trajectory_ids"`
+	Algorithm         string   `json:"algorithm"`
+	DistanceThreshold *float64 `json:"distance_threshold"`
+	TimeThreshold     *int     `json:"time_threshold"`
+	DryRun            bool     `json:"dry_run"`
+}
+
+// stayAlgorithmError rejects an algorithm that names no stay point detector
+var stayAlgorithmError = "algorithm must be one of " + strings.Join(algorithms.StayPointAlgorithms, ", ")
+
+// NewStayPointHandler creates a new instance of StayPointHandler
+func NewStayPointHandler(stayPointService *services.StayPointServices, userService *services.UserServices) *StayPointHandler {
+	return &StayPointHandler{
+		stayPointService: stayPointService,
+		userService:      userService,
+	}
+}
+
+// FindNearbyStayPoints returns the current user's stay points around a point, nearest first
+func (h *StayPointHandler) FindNearbyStayPoints(c *gin.Context) {
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	params, err := extractRadiusSearchParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	stayPoints, err := h.stayPointService.FindNearby(userID.(uint), params.Latitude, params.Longitude, params.Radius)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to find nearby stay points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stay_points": stayPoints,
+		"total":       len(stayPoints),
+	})
+}
+
+// FindPopularPlaces returns the places around a point where stay points of all users
+// concentrate, most visited first
+func (h *StayPointHandler) FindPopularPlaces(c *gin.Context) {
+	params, err := extractRadiusSearchParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	limit, err := extractSearchLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	places, err := h.stayPointService.FindPopular(params.Latitude, params.Longitude, params.Radius, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to find popular places"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"places": places,
+		"total":  len(places),
+	})
+}
+
+// AdminGetStayPointSettings returns the global stay point thresholds
+func (h *StayPointHandler) AdminGetStayPointSettings(c *gin.Context) {
+	h.respondSettings(c, nil)
+}
+
+// AdminUpdateStayPointSettings sets the global stay point thresholds
+func (h *StayPointHandler) AdminUpdateStayPointSettings(c *gin.Context) {
+	h.saveSettings(c, nil)
+}
+
+// AdminDeleteStayPointSettings restores the built-in global stay point thresholds
+func (h *StayPointHandler) AdminDeleteStayPointSettings(c *gin.Context) {
+	h.deleteSettings(c, nil)
+}
+
+// AdminGetUserStayPointSettings returns the stay point thresholds of a user
+func (h *StayPointHandler) AdminGetUserStayPointSettings(c *gin.Context) {
+	if userID, ok := h.userParam(c); ok {
+		h.respondSettings(c, &userID)
+	}
+}
+
+// AdminUpdateUserStayPointSettings sets the stay point thresholds of a user
+func (h *StayPointHandler) AdminUpdateUserStayPointSettings(c *gin.Context) {
+	if userID, ok := h.userParam(c); ok {
+		h.saveSettings(c, &userID)
+	}
+}
+
+// AdminDeleteUserStayPointSettings makes a user fall back to the global stay point thresholds
+func (h *StayPointHandler) AdminDeleteUserStayPointSettings(c *gin.Context) {
+	if userID, ok := h.userParam(c); ok {
+		h.deleteSettings(c, &userID)
+	}
+}
+
+// AdminRegenerateStayPoints deletes and detects again the stay points of the selected
+// users and trajectories, or with dry_run only reports how their counts would change
+func (h *StayPointHandler) AdminRegenerateStayPoints(c *gin.Context) {
+	var req RegenerateStayPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Algorithm != "" && !algorithms.IsStayPointAlgorithm(req.Algorithm) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: stayAlgorithmError})
+		return
+	}
+
+	opts := services.RegenerateOptions{
+		UserIDs:       req.UserIDs,
+		TrajectoryIDs: req.TrajectoryIDs,
+		Algorithm:     req.Algorithm,
+		DryRun:        req.DryRun,
+	}
+	if req.DistanceThreshold != nil || req.TimeThreshold != nil {
+		if req.DistanceThreshold == nil || req.TimeThreshold == nil || *req.DistanceThreshold <= 0 || *req.TimeThreshold <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "distance_threshold and time_threshold must both be positive"})
+			return
+		}
+		opts.Params = &algorithms.StayPointParams{
+			DistanceThreshold: *req.DistanceThreshold,
+			TimeThreshold:     time.Duration(*req.TimeThreshold) * time.Second,
+		}
+	}
+
+	report, err := h.stayPointService.Regenerate(opts)
+	if errors.Is(err, services.ErrNoRegenerateTarget) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to regenerate stay points: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// userParam reads the user ID from the URL and checks that the user exists
+func (h *StayPointHandler) userParam(c *gin.Context) (uint, bool) {
+	userID, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
+		return 0, false
+	}
+
+	if _, err := h.userService.GetUserByID(userID); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+		return 0, false
+	}
+	return userID, true
+}
+
+func (h *StayPointHandler) respondSettings(c *gin.Context, userID *uint) {
+	settings, err := h.stayPointService.GetSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get stay point settings"})
+		return
+	}
+
+	var params algorithms.StayPointParams
+	if userID != nil {
+		params, err = h.stayPointService.ParamsForUser(*userID)
+	} else {
+		params, err = h.stayPointService.GlobalParams()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get stay point settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, StayPointSettingsResponse{
+		Settings:          settings,
+		Algorithm:         params.Algorithm,
+		DistanceThreshold: params.DistanceThreshold,
+		TimeThreshold:     int(params.TimeThreshold.Seconds()),
+	})
+}
+
+func (h *StayPointHandler) saveSettings(c *gin.Context, userID *uint) {
+	var req StayPointSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if req.Algorithm == "" {
+		req.Algorithm = algorithms.StayAlgorithmSequential
+	}
+	if !algorithms.IsStayPointAlgorithm(req.Algorithm) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: stayAlgorithmError})
+		return
+	}
+
+	_, err := h.stayPointService.SaveSettings(userID, algorithms.StayPointParams{
+		Algorithm:         req.Algorithm,
+		DistanceThreshold: req.DistanceThreshold,
+		TimeThreshold:     time.Duration(req.TimeThreshold) * time.Second,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to save stay point settings"})
+		return
+	}
+
+	h.respondSettings(c, userID)
+}
+
+func (h *StayPointHandler) deleteSettings(c *gin.Context, userID *uint) {
+	if err := h.stayPointService.DeleteSettings(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete stay point settings"})
+		return
+	}
+
+	h.respondSettings(c, userID)
+}
@@ -0,0 +1,158 @@
+// Package handlers provides HTTP request handlers for the application
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/models"
+	"github.com/th1enq/go-map/internal/services"
+)
+
+// TrackingHandler handles live tracking sessions
+type TrackingHandler struct {
+	trackingService *services.TrackingServices
+	segmentService  *services.TrajectorySegmentServices
+}
+
+// StartSessionRequest is the input for starting a tracking session
+type StartSessionRequest struct {
+	Name string `json:"name"`
+}
+
+// AppendPointsRequest is the input for appending a batch of points to a session
+type AppendPointsRequest struct {
+	Points []GPSPointRequest `json:"points" binding:"required,min=1"`
+}
+
+// NewTrackingHandler creates a new instance of TrackingHandler
+func NewTrackingHandler(trackingService *services.TrackingServices, segmentService *services.TrajectorySegmentServices) *TrackingHandler {
+	return &TrackingHandler{
+		trackingService: trackingService,
+		segmentService:  segmentService,
+	}
+}
+
+// StartSession opens a new trajectory that accepts appended points
+func (h *TrackingHandler) StartSession(c *gin.Context) {
+	var req StartSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	trajectory, err := h.trackingService.StartSession(userID.(uint), req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to start tracking session"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Tracking session started",
+		"trajectory": trajectory,
+	})
+}
+
+// AppendPoints appends a batch of points to an open trajectory
+func (h *TrackingHandler) AppendPoints(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	var req AppendPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	points := make([]models.GPSPoint, len(req.Points))
+	for i, p := range req.Points {
+		timestamp, err := time.Parse(time.RFC3339, p.Timestamp)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error: "Invalid timestamp format. Use ISO 8601 / RFC 3339 format (e.g. 2023-01-01T12:00:00Z)",
+			})
+			return
+		}
+
+		points[i] = models.GPSPoint{
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			Altitude:  p.Altitude,
+			Timestamp: timestamp,
+		}
+	}
+
+	result, err := h.trackingService.AppendPoints(userID.(uint), id, points)
+	if err != nil {
+		respondTrackingError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// CloseSession finishes a tracking session
+func (h *TrackingHandler) CloseSession(c *gin.Context) {
+	id, err := parseIDParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	trajectory, err := h.trackingService.CloseSession(userID.(uint), id)
+	if err != nil {
+		respondTrackingError(c, err)
+		return
+	}
+
+	// The session is already closed, so a classification failure is only logged
+	if _, err := h.segmentService.ClassifyTrajectory(*trajectory); err != nil {
+		log.Printf("failed to classify transportation modes of trajectory %d: %v", trajectory.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Tracking session closed",
+		"trajectory": trajectory,
+	})
+}
+
+// respondTrackingError maps tracking service errors to HTTP responses
+func respondTrackingError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTrajectoryNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+	case errors.Is(err, services.ErrTrajectoryAccess):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+	case errors.Is(err, services.ErrTrajectoryClosed):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Trajectory is not an open tracking session"})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to update tracking session: " + err.Error()})
+	}
+}
@@ -2,17 +2,24 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
 	"github.com/th1enq/go-map/internal/services"
 )
 
 // TrajectoryHandler handles trajectory-related HTTP requests
 type TrajectoryHandler struct {
 	trajectoryService *services.TrajectoryServices
+	segmentService    *services.TrajectorySegmentServices
 }
 
 // GPSPointRequest represents a single GPS point in a trajectory
@@ -37,6 +44,8 @@ type TrajectoryResponse struct {
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 	Points    []any     `json:"points,omitempty"`
+
+	Stats models.TrajectoryStats `json:"stats"`
 }
 
 // TrajectoriesResponse represents a paginated response containing trajectories
@@ -46,9 +55,10 @@ type TrajectoriesResponse struct {
 }
 
 // NewTrajectoryHandler creates a new instance of TrajectoryHandler
-func NewTrajectoryHandler(trajectoryService *services.TrajectoryServices) *TrajectoryHandler {
+func NewTrajectoryHandler(trajectoryService *services.TrajectoryServices, segmentService *services.TrajectorySegmentServices) *TrajectoryHandler {
 	return &TrajectoryHandler{
 		trajectoryService: trajectoryService,
+		segmentService:    segmentService,
 	}
 }
 
@@ -115,6 +125,11 @@ func (h *TrajectoryHandler) CreateTrajectory(c *gin.Context) {
 		return
 	}
 
+	// The trajectory is already stored, so a classification failure is only logged
+	if _, err := h.segmentService.ClassifyTrajectory(*trajectory); err != nil {
+		log.Printf("failed to classify transportation modes of trajectory %d: %v", trajectory.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message":    "Trajectory created successfully",
 		"trajectory": trajectory,
@@ -185,6 +200,403 @@ func (h *TrajectoryHandler) GetTrajectory(c *gin.Context) {
 	c.JSON(http.StatusOK, trajectory)
 }
 
+// SearchTrajectories returns the current user's trajectories that cross a bounding box,
+// optionally only counting the part recorded between from and to
+func (h *TrajectoryHandler) SearchTrajectories(c *gin.Context) {
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	bbox, err := parseBBox(c.Query("bbox"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	from, err := parseOptionalTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from, use RFC 3339 format"})
+		return
+	}
+
+	to, err := parseOptionalTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to, use RFC 3339 format"})
+		return
+	}
+
+	trajectories, err := h.trajectoryService.FindInBBox(userID.(uint), bbox[0], bbox[1], bbox[2], bbox[3], from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search trajectories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trajectories": trajectories,
+		"total":        len(trajectories),
+	})
+}
+
+// SplitTrajectory splits one of the current user's trajectories into trips separated by
+// stays, time gaps and signal loss. With dry_run=true the trips are returned without
+// being stored; max_gap (e.g. 30m) overrides the time gap that always ends a trip.
+func (h *TrajectoryHandler) SplitTrajectory(c *gin.Context) {
+	// Get trajectory ID from the URL
+	trajectoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	params := algorithms.DefaultTripParams()
+	if value := c.Query("max_gap"); value != "" {
+		maxGap, err := time.ParseDuration(value)
+		if err != nil || maxGap <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid max_gap, e.g. 30m"})
+			return
+		}
+		params.MaxGap = maxGap
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid dry_run value"})
+			return
+		}
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(uint(trajectoryID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	// Verify that the trajectory belongs to the user
+	if trajectory.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+		return
+	}
+
+	if trajectory.IsOpen {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "Close the tracking session before splitting it"})
+		return
+	}
+
+	trips, err := h.trajectoryService.SplitTrajectory(trajectory, params, dryRun)
+	if errors.Is(err, services.ErrNoTrips) {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrAlreadySplit) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to split trajectory"})
+		return
+	}
+
+	// The split trajectories are already stored, so a classification failure is only logged
+	if !dryRun && len(trips) > 1 {
+		for _, trip := range trips {
+			if _, err := h.segmentService.ClassifyTrajectory(trip.Trajectory); err != nil {
+				log.Printf("failed to classify transportation modes of trajectory %d: %v", trip.Trajectory.ID, err)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trips":   trips,
+		"total":   len(trips),
+		"dry_run": dryRun,
+	})
+}
+
+// GetTrajectoryPosition returns where the user was at time at (RFC3339), or with resample
+// (e.g. 10s) the trajectory's positions at that fixed interval. Positions are interpolated
+// linearly across gaps of up to max_span (default 5m, 0 for any gap).
+func (h *TrajectoryHandler) GetTrajectoryPosition(c *gin.Context) {
+	// Get trajectory ID from the URL
+	trajectoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	at, resample := c.Query("at"), c.Query("resample")
+	if (at == "") == (resample == "") {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Either at or resample must be given"})
+		return
+	}
+
+	maxSpan := algorithms.DefaultMaxInterpolationSpan
+	if value := c.Query("max_span"); value != "" {
+		maxSpan, err = time.ParseDuration(value)
+		if err != nil || maxSpan < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid max_span, e.g. 5m or 0 for no limit"})
+			return
+		}
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(uint(trajectoryID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	// Verify that the trajectory belongs to the user
+	if trajectory.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+		return
+	}
+
+	if at != "" {
+		atTime, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid at, use RFC 3339 format"})
+			return
+		}
+
+		position, err := services.PositionAt(*trajectory, atTime, maxSpan)
+		if errors.Is(err, services.ErrPositionUnknown) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to interpolate position"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"trajectory_id": trajectory.ID,
+			"position":      position,
+		})
+		return
+	}
+
+	interval, err := time.ParseDuration(resample)
+	if err != nil || interval < time.Second {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid resample, must be at least 1s"})
+		return
+	}
+
+	points, err := services.ResampledPoints(*trajectory, interval, maxSpan)
+	if errors.Is(err, services.ErrTooManyResamples) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to resample trajectory"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"trajectory_id": trajectory.ID,
+		"interval":      interval.String(),
+		"points":        points,
+		"total":         len(points),
+	})
+}
+
+// PolylinePointRequest is a point of a drawn polyline; the timestamp is optional. The
+// coordinates are pointers so that the equator and the prime meridian are accepted.
+type PolylinePointRequest struct {
+	Latitude  *float64 `json:"latitude" binding:"required,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" binding:"required,min=-180,max=180"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// SimilarTrajectoriesRequest is the polyline to find similar trajectories for
+type SimilarTrajectoriesRequest struct {
+	Points []PolylinePointRequest `json:"points" binding:"required,min=2,dive"`
+}
+
+// GetSimilarTrajectories returns the current user's trajectories most similar to one of them
+func (h *TrajectoryHandler) GetSimilarTrajectories(c *gin.Context) {
+	// Get trajectory ID from the URL
+	trajectoryID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid trajectory ID"})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	query, err := parseSimilarityQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	trajectory, err := h.trajectoryService.GetByID(uint(trajectoryID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Trajectory not found"})
+		return
+	}
+
+	// Verify that the trajectory belongs to the user
+	if trajectory.UserID != userID.(uint) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "Access denied to this trajectory"})
+		return
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil || len(points) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "Trajectory has no points"})
+		return
+	}
+
+	h.respondSimilar(c, userID.(uint), points, trajectory.ID, query)
+}
+
+// FindSimilarTrajectories returns the current user's trajectories most similar to a drawn polyline
+func (h *TrajectoryHandler) FindSimilarTrajectories(c *gin.Context) {
+	var req SimilarTrajectoriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get user ID from context (set by JWT middleware)
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Unauthorized"})
+		return
+	}
+
+	query, err := parseSimilarityQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	points := make([]models.GPSPoint, len(req.Points))
+	for i, p := range req.Points {
+		points[i] = models.GPSPoint{Latitude: *p.Latitude, Longitude: *p.Longitude}
+		if p.Timestamp != "" {
+			points[i].Timestamp, err = time.Parse(time.RFC3339, p.Timestamp)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid timestamp, use RFC 3339 format"})
+				return
+			}
+		}
+	}
+
+	h.respondSimilar(c, userID.(uint), points, 0, query)
+}
+
+func (h *TrajectoryHandler) respondSimilar(c *gin.Context, userID uint, points []models.GPSPoint, excludeID uint, query services.SimilarityQuery) {
+	results, err := h.trajectoryService.FindSimilar(userID, points, excludeID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to search similar trajectories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"measure":      query.Measure,
+		"trajectories": results,
+		"total":        len(results),
+	})
+}
+
+// parseSimilarityQuery reads measure (default dtw), k (default 10, max 50) and for LCSS
+// epsilon in meters and delta as a duration from the query string
+func parseSimilarityQuery(c *gin.Context) (services.SimilarityQuery, error) {
+	query := services.SimilarityQuery{
+		Measure: strings.ToLower(c.DefaultQuery("measure", algorithms.SimilarityDTW)),
+		K:       10,
+		LCSS:    algorithms.DefaultLCSSParams(),
+	}
+	if !algorithms.IsSimilarityMeasure(query.Measure) {
+		return query, &ValidationError{Field: "measure", Message: "measure must be dtw, frechet, hausdorff or lcss"}
+	}
+
+	if value := c.Query("k"); value != "" {
+		k, err := strconv.Atoi(value)
+		if err != nil || k < 1 || k > 50 {
+			return query, &ValidationError{Field: "k", Message: "k must be between 1 and 50"}
+		}
+		query.K = k
+	}
+
+	if value := c.Query("epsilon"); value != "" {
+		epsilon, err := strconv.ParseFloat(value, 64)
+		if err != nil || epsilon <= 0 {
+			return query, &ValidationError{Field: "epsilon", Message: "epsilon must be a positive distance in meters"}
+		}
+		query.LCSS.Epsilon = epsilon
+	}
+
+	if value := c.Query("delta"); value != "" {
+		delta, err := time.ParseDuration(value)
+		if err != nil || delta < 0 {
+			return query, &ValidationError{Field: "delta", Message: "invalid delta, e.g. 15m or 0 to ignore time"}
+		}
+		query.LCSS.Delta = delta
+	}
+
+	return query, nil
+}
+
+// parseBBox parses a "minLng,minLat,maxLng,maxLat" bounding box
+func parseBBox(value string) ([4]float64, error) {
+	var bbox [4]float64
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return bbox, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return bbox, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+		}
+		bbox[i] = v
+	}
+
+	if bbox[0] > bbox[2] || bbox[1] > bbox[3] {
+		return bbox, errors.New("bbox minimum must not exceed its maximum")
+	}
+
+	return bbox, nil
+}
+
+// parseOptionalTime parses an RFC 3339 time, returning nil for an empty value
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // getPaginationParams extracts pagination parameters from the request
 func (h *TrajectoryHandler) getPaginationParams(c *gin.Context) (int, int) {
 	// Default pagination values
@@ -27,8 +27,8 @@ func NewUserGraphHandler(
 	}
 }
 
-// BuildUserGraph builds a hierarchical graph for a specific user
-func (h *UserGraphHandler) BuildUserGraph(userID uint) error {
+// BuildUserGraph builds a hierarchical graph for a specific user in a framework
+func (h *UserGraphHandler) BuildUserGraph(userID, frameworkID uint) error {
 	// Get all stay points for the user
 	stayPoints, err := h.stayPointService.GetByUserID(userID)
 	if err != nil {
@@ -40,20 +40,16 @@ func (h *UserGraphHandler) BuildUserGraph(userID uint) error {
 		return nil
 	}
 
-	// Get the latest framework
-	frameworks, err := h.frameworkService.GetAllFrameworks()
+	framework, err := h.frameworkService.GetFramework(frameworkID)
 	if err != nil {
 		return err
 	}
 
-	if len(frameworks) == 0 {
-		log.Println("No framework found")
+	if len(framework.Layers) == 0 {
+		log.Printf("Framework %d has no layers", frameworkID)
 		return nil
 	}
 
-	// Use the latest framework
-	framework := frameworks[len(frameworks)-1]
-
 	// Create a new hierarchical graph for the user
 	graph, err := h.frameworkService.CreateHierarchicalGraph(userID, framework.ID)
 	if err != nil {
@@ -78,7 +74,7 @@ func (h *UserGraphHandler) BuildUserGraph(userID uint) error {
 		}
 
 		// Find the cluster that contains most of the stay points
-		cluster, err := h.findBestCluster(group, &framework)
+		cluster, err := h.findBestCluster(group, framework)
 		if err != nil {
 			log.Printf("Error finding cluster for group: %v", err)
 			continue
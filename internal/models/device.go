@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TrackingDevice is a phone or app that reports positions on behalf of a user
+type TrackingDevice struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  *string    `json:"-"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
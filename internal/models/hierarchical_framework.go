@@ -2,14 +2,29 @@ package models
 
 import (
 	"time"
+
+	"gorm.io/datatypes"
 )
 
-// HierarchicalFramework represents the top-level framework
+// HierarchicalFramework represents the top-level framework. Every framework built or
+// imported is a new version; user graphs and recommendations use the active one.
 type HierarchicalFramework struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
+	Version   int       `json:"version"`
+	Active    bool      `json:"active"` // At most one framework is active
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Layers    []Layer   `json:"layers" gorm:"foreignKey:FrameworkID"`
+	Layers    []Layer   `json:"layers,omitempty" gorm:"foreignKey:FrameworkID"`
+
+	// Parameters the framework was built with; Algorithm is empty when they are unknown
+	Algorithm       string                       `json:"algorithm"`
+	Epsilon         float64                      `json:"epsilon"` // km
+	MinPoints       int                          `json:"min_points"`
+	MaxLayers       int                          `json:"max_layers"`
+	LayerScales     datatypes.JSONSlice[float64] `json:"layer_scales"`
+	MinClusterSize  int                          `json:"min_cluster_size"`
+	MaxLinkDistance float64                      `json:"max_link_distance"` // km
+	StayPointCount  int                          `json:"stay_point_count"`  // Stay points it was built from
 }
 
 // Layer represents a level in the hierarchical framework
@@ -24,16 +39,51 @@ type Layer struct {
 
 // Cluster represents a group of stay points
 type Cluster struct {
-	ID          uint        `json:"id"`
-	FrameworkID uint        `json:"framework_id"`
-	LayerID     uint        `json:"layer_id"`
-	CenterLat   float64     `json:"center_lat"`
-	CenterLng   float64     `json:"center_lng"`
-	Radius      float64     `json:"radius"` // in meters
-	VisitCount  int         `json:"visit_count"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	StayPoints  []StayPoint `json:"stay_points"`
+	ID             uint        `json:"id"`
+	FrameworkID    uint        `json:"framework_id"`
+	LayerID        uint        `json:"layer_id"`
+	ParentID       *uint       `json:"parent_id"` // Cluster of the next layer containing this one, nil in the top layer
+	CenterLat      float64     `json:"center_lat"`
+	CenterLng      float64     `json:"center_lng"`
+	Radius         float64     `json:"radius"` // km, from the center to the farthest stay point
+	VisitCount     int         `json:"visit_count"`
+	StayPointCount int         `json:"stay_point_count"` // Stored so that deleted stay points are noticed
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+	StayPoints     []StayPoint `json:"stay_points" gorm:"many2many:cluster_stay_points"`
+
+	// Position of the parent in the Clusters of the next layer while a framework is built
+	// and not yet stored, -1 for none
+	ParentIndex int `json:"-" gorm:"-"`
+}
+
+// Kinds of ClusterChange
+const (
+	ClusterCreated = "created" // New stay points seeded the cluster
+	ClusterMerged  = "merged"  // New stay points joined SourceClusterID to the cluster, removing it
+	ClusterSplit   = "split"   // The cluster was split off SourceClusterID after stay points were deleted
+	ClusterRemoved = "removed" // Too few stay points were left; the cluster was deleted
+)
+
+// ClusterChange records how an incremental update of a framework changed a cluster. The
+// cluster IDs are kept after the clusters are deleted.
+type ClusterChange struct {
+	ID              uint      `json:"id"`
+	FrameworkID     uint      `json:"framework_id"`
+	LayerID         uint      `json:"layer_id"`
+	Kind            string    `json:"kind"`
+	ClusterID       uint      `json:"cluster_id"`
+	SourceClusterID *uint     `json:"source_cluster_id"`
+	StayPoints      int       `json:"stay_points"` // Stay points moved, or left in a removed cluster
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ClusterStayPoint records that a stay point belongs to a cluster. A stay point belongs to
+// at most one cluster per layer.
+type ClusterStayPoint struct {
+	ClusterID   uint `json:"cluster_id" gorm:"primaryKey"`
+	StayPointID uint `json:"stay_point_id" gorm:"primaryKey"`
+	LayerID     uint `json:"layer_id"`
 }
 
 // HierarchicalGraph represents a user's personal graph in the framework
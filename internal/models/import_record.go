@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type ImportStatus string
+
+const (
+	ImportCompleted ImportStatus = "completed"
+	ImportFailed    ImportStatus = "failed"
+)
+
+// ImportRecord tracks the import of a single dataset file
+type ImportRecord struct {
+	ID             uint         `json:"id"`
+	UserID         uint         `json:"user_id"`
+	SourcePath     string       `json:"source_path"`
+	Status         ImportStatus `json:"status"`
+	TrajectoryID   *uint        `json:"trajectory_id,omitempty"`
+	PointCount     int          `json:"point_count"`
+	StayPointCount int          `json:"stay_point_count"`
+	Error          string       `json:"error,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
@@ -22,6 +22,15 @@ type Location struct {
 	Category    LocationCategory `json:"category"`
 	VisitCount  int              `json:"visit_count"`
 	ClusterID   uint             `json:"cluster_id"`
+	Activities  []string         `json:"activities,omitempty" gorm:"-"` // Stored in location_activities
 	CreatedAt   time.Time        `json:"created_at"`
 	UpdatedAt   time.Time        `json:"updated_at"`
 }
+
+// LocationActivity tags a location with an activity that can be done there
+type LocationActivity struct {
+	ID         uint      `json:"id"`
+	LocationID uint      `json:"location_id"`
+	Activity   string    `json:"activity"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StayPointSettings overrides the stay point detector and its thresholds for one user or,
+// when UserID is nil, for everybody
+type StayPointSettings struct {
+	ID                uint      `json:"id"`
+	UserID            *uint     `json:"user_id,omitempty"`
+	Algorithm         string    `json:"algorithm"`
+	DistanceThreshold float64   `json:"distance_threshold"` // Meters
+	TimeThreshold     int       `json:"time_threshold"`     // Seconds
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -13,6 +13,8 @@ type GPSPoint struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Trajectory is a recorded GPS track. The database also keeps a geom column
+// (LineStringZM, M = Unix epoch seconds) derived from Points for spatial queries.
 type Trajectory struct {
 	ID        uint           `json:"id"`
 	UserID    uint           `json:"user_id"`
@@ -20,6 +22,36 @@ type Trajectory struct {
 	Points    datatypes.JSON `json:"points"`
 	StartTime time.Time      `json:"start_time"`
 	EndTime   time.Time      `json:"end_time"`
+	IsOpen    bool           `json:"is_open"` // True while a live tracking session is appending points
+	DeviceID  *uint          `json:"device_id,omitempty"`
+	DeviceDay *time.Time     `json:"-" gorm:"type:date"`  // UTC day of a device's daily trajectory, unique per device
+	ParentID  *uint          `json:"parent_id,omitempty"` // Trajectory this trip was split from
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
+
+	// Optional simplified copy of Points for display, cleared when Points change
+	SimplifiedPoints  datatypes.JSON `json:"-"`
+	SimplifyMethod    string         `json:"simplify_method,omitempty"`
+	SimplifyTolerance float64        `json:"simplify_tolerance,omitempty"`
+
+	// Summary of Points, recomputed whenever they change
+	Stats TrajectoryStats `json:"stats" gorm:"embedded;embeddedPrefix:stat_"`
+}
+
+// TrajectoryStats summarizes the points of a trajectory. Lengths and elevations are in
+// meters, times in seconds and speeds in m/s.
+type TrajectoryStats struct {
+	PointCount     int     `json:"point_count"`
+	Length         float64 `json:"length"`
+	MovingTime     float64 `json:"moving_time"`
+	StoppedTime    float64 `json:"stopped_time"`
+	AvgSpeed       float64 `json:"avg_speed"`        // Length over the whole duration
+	AvgMovingSpeed float64 `json:"avg_moving_speed"` // Length over the moving time
+	MaxSpeed       float64 `json:"max_speed"`
+	ElevationGain  float64 `json:"elevation_gain"`
+	ElevationLoss  float64 `json:"elevation_loss"`
+	MinLatitude    float64 `json:"min_latitude"`
+	MinLongitude   float64 `json:"min_longitude"`
+	MaxLatitude    float64 `json:"max_latitude"`
+	MaxLongitude   float64 `json:"max_longitude"`
 }
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+type TransportMode string
+
+const (
+	ModeWalk       TransportMode = "walk"
+	ModeBike       TransportMode = "bike"
+	ModeBus        TransportMode = "bus"
+	ModeCar        TransportMode = "car"
+	ModeTaxi       TransportMode = "taxi"
+	ModeSubway     TransportMode = "subway"
+	ModeTrain      TransportMode = "train"
+	ModeAirplane   TransportMode = "airplane"
+	ModeBoat       TransportMode = "boat"
+	ModeRun        TransportMode = "run"
+	ModeMotorcycle TransportMode = "motorcycle"
+)
+
+// TransportModes lists every supported transportation mode
+var TransportModes = []TransportMode{
+	ModeWalk, ModeBike, ModeBus, ModeCar, ModeTaxi, ModeSubway,
+	ModeTrain, ModeAirplane, ModeBoat, ModeRun, ModeMotorcycle,
+}
+
+type SegmentSource string
+
+const (
+	SourceLabel      SegmentSource = "label"      // Ground truth from GeoLife labels.txt
+	SourceClassifier SegmentSource = "classifier" // Inferred from the motion of the points
+)
+
+// TrajectorySegment is a time range of a trajectory travelled with a single transportation mode
+type TrajectorySegment struct {
+	ID           uint          `json:"id"`
+	TrajectoryID uint          `json:"trajectory_id"`
+	UserID       uint          `json:"user_id"`
+	Mode         TransportMode `json:"mode"`
+	Source       SegmentSource `json:"source"`
+	StartTime    time.Time     `json:"start_time"`
+	EndTime      time.Time     `json:"end_time"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// IsValidTransportMode reports whether a mode is one of the supported modes
+func IsValidTransportMode(mode TransportMode) bool {
+	for _, m := range TransportModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
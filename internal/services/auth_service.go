@@ -83,6 +83,23 @@ func (s *AuthService) Login(email, password string) (string, *models.User, error
 	return token, &user, nil
 }
 
+// VerifyCredentials checks a password against the user identified by email or username
+func (s *AuthService) VerifyCredentials(login, password string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("email = ? OR username = ?", login, login).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, errors.New("invalid password")
+	}
+
+	return &user, nil
+}
+
 func (s *AuthService) GenerateToken(userID uint) (string, error) {
 	// Create claims
 	claims := TokenClaims{
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// Bulk ingestion streams rows with PostgreSQL COPY instead of one INSERT per row.
+// COPY cannot return generated keys, so IDs are reserved from the table's sequence
+// first and written explicitly; callers get the same IDs back as with Create.
+
+var trajectoryCopyColumns = append([]string{
+	"id", "user_id", "name", "points", "start_time", "end_time", "is_open", "device_id", "created_at", "updated_at",
+}, trajectoryStatsColumns...)
+
+var stayPointCopyColumns = []string{
+	"id", "user_id", "trajectory_id", "location_id", "cluster_id", "latitude", "longitude",
+	"arrival_time", "departure_time", "created_at", "updated_at",
+}
+
+// withPgxTx runs fn in a transaction on a pgx connection borrowed from the gorm pool
+func withPgxTx(database *db.DB, fn func(ctx context.Context, tx pgx.Tx) error) error {
+	ctx := context.Background()
+
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("bulk insert requires the pgx database driver")
+		}
+		return pgx.BeginFunc(ctx, stdConn.Conn(), func(tx pgx.Tx) error {
+			return fn(ctx, tx)
+		})
+	})
+}
+
+// reserveIDs allocates n consecutive values of the serial id sequence of a table
+func reserveIDs(ctx context.Context, tx pgx.Tx, table string, n int) ([]uint, error) {
+	rows, err := tx.Query(ctx,
+		"SELECT nextval(pg_get_serial_sequence($1, 'id')) FROM generate_series(1, $2)", table, n)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]uint, len(ids))
+	for i, id := range ids {
+		result[i] = uint(id)
+	}
+	return result, nil
+}
+
+// copyTrajectories inserts trajectories with COPY and sets their IDs. Stats are computed
+// for trajectories whose caller has not already set them from the decoded points.
+func copyTrajectories(ctx context.Context, tx pgx.Tx, trajectories []models.Trajectory) error {
+	if len(trajectories) == 0 {
+		return nil
+	}
+
+	ids, err := reserveIDs(ctx, tx, "trajectories", len(trajectories))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make([][]any, len(trajectories))
+	for i := range trajectories {
+		t := &trajectories[i]
+		t.ID = ids[i]
+		t.CreatedAt, t.UpdatedAt = now, now
+
+		if t.Stats.PointCount == 0 {
+			if err := setTrajectoryStats(t); err != nil {
+				return err
+			}
+		}
+
+		var deviceID any
+		if t.DeviceID != nil {
+			deviceID = int64(*t.DeviceID)
+		}
+
+		st := t.Stats
+		rows[i] = []any{
+			int64(t.ID), int64(t.UserID), t.Name, []byte(t.Points),
+			t.StartTime, t.EndTime, t.IsOpen, deviceID, t.CreatedAt, t.UpdatedAt,
+			int32(st.PointCount), st.Length, st.MovingTime, st.StoppedTime, st.AvgSpeed,
+			st.AvgMovingSpeed, st.MaxSpeed, st.ElevationGain, st.ElevationLoss,
+			st.MinLatitude, st.MinLongitude, st.MaxLatitude, st.MaxLongitude,
+		}
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"trajectories"}, trajectoryCopyColumns, pgx.CopyFromRows(rows))
+	return err
+}
+
+// copyStayPoints inserts stay points with COPY and sets their IDs. A zero trajectory ID
+// is stored as NULL, like StayPointServices.Create does.
+func copyStayPoints(ctx context.Context, tx pgx.Tx, stayPoints []models.StayPoint) error {
+	if len(stayPoints) == 0 {
+		return nil
+	}
+
+	ids, err := reserveIDs(ctx, tx, "stay_points", len(stayPoints))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make([][]any, len(stayPoints))
+	for i := range stayPoints {
+		sp := &stayPoints[i]
+		sp.ID = ids[i]
+		sp.CreatedAt, sp.UpdatedAt = now, now
+
+		var trajectoryID any
+		if sp.TrajectoryID != 0 {
+			trajectoryID = int64(sp.TrajectoryID)
+		}
+
+		rows[i] = []any{
+			int64(sp.ID), int64(sp.UserID), trajectoryID, int64(sp.LocationID), int64(sp.ClusterID),
+			sp.Latitude, sp.Longitude, sp.ArrivalTime, sp.DepartureTime, sp.CreatedAt, sp.UpdatedAt,
+		}
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"stay_points"}, stayPointCopyColumns, pgx.CopyFromRows(rows))
+	return err
+}
+
+// copyTrajectoriesWithStayPoints inserts trajectories and the stay points detected on each
+// of them, linking every stay point to the ID its trajectory received
+func copyTrajectoriesWithStayPoints(ctx context.Context, tx pgx.Tx, trajectories []models.Trajectory, stayPoints [][]models.StayPoint) error {
+	if len(stayPoints) != len(trajectories) {
+		return fmt.Errorf("got stay points for %d trajectories, want %d", len(stayPoints), len(trajectories))
+	}
+
+	if err := copyTrajectories(ctx, tx, trajectories); err != nil {
+		return err
+	}
+
+	var all []models.StayPoint
+	for i := range trajectories {
+		for j := range stayPoints[i] {
+			stayPoints[i][j].TrajectoryID = trajectories[i].ID
+		}
+		all = append(all, stayPoints[i]...)
+	}
+
+	if err := copyStayPoints(ctx, tx, all); err != nil {
+		return err
+	}
+
+	// Hand the assigned stay point IDs back to the caller's slices
+	k := 0
+	for i := range stayPoints {
+		for j := range stayPoints[i] {
+			stayPoints[i][j] = all[k]
+			k++
+		}
+	}
+	return nil
+}
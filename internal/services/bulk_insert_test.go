@@ -0,0 +1,155 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/th1enq/go-map/config"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	benchTrajectories = 100
+	benchPoints       = 1000
+	benchStays        = 3
+)
+
+// BenchmarkTrajectoryInsert compares the row-by-row BatchCreate path with the COPY based
+// bulk path. It needs the DB_* environment of a migrated database and writes its rows for
+// a throwaway user that is deleted afterwards.
+func BenchmarkTrajectoryInsert(b *testing.B) {
+	database := benchDB(b)
+	trajectorySvc := NewTrajectoryServices(database)
+	staypointSvc := NewStayPointServices(database)
+	userSvc := NewUserServices(database)
+
+	user := &models.User{
+		Username: fmt.Sprintf("bench-ingest-%d", time.Now().UnixNano()),
+		Email:    fmt.Sprintf("bench-ingest-%d@bench.local", time.Now().UnixNano()),
+	}
+	if _, err := userSvc.Create(user); err != nil {
+		b.Fatalf("failed to create benchmark user: %v", err)
+	}
+	b.Cleanup(func() {
+		// Trajectories and stay points are removed by the cascading foreign keys
+		if err := userSvc.Delete(user.ID); err != nil {
+			b.Errorf("failed to delete benchmark user %d: %v", user.ID, err)
+		}
+	})
+
+	b.Run("BatchCreate", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			trajectories, stayPoints := benchTrajectoryRows(user.ID, i)
+			b.StartTimer()
+
+			if err := trajectorySvc.BatchCreate(trajectories); err != nil {
+				b.Fatalf("BatchCreate failed: %v", err)
+			}
+			var allStays []models.StayPoint
+			for k := range trajectories {
+				for _, stayPoint := range stayPoints[k] {
+					stayPoint.TrajectoryID = trajectories[k].ID
+					allStays = append(allStays, stayPoint)
+				}
+			}
+			if err := staypointSvc.BatchCreate(allStays); err != nil {
+				b.Fatalf("stay point BatchCreate failed: %v", err)
+			}
+		}
+		reportPointRate(b)
+	})
+
+	b.Run("COPY", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			trajectories, stayPoints := benchTrajectoryRows(user.ID, i)
+			b.StartTimer()
+
+			if _, err := trajectorySvc.BulkCreateWithStayPoints(trajectories, stayPoints); err != nil {
+				b.Fatalf("BulkCreateWithStayPoints failed: %v", err)
+			}
+		}
+		reportPointRate(b)
+	})
+}
+
+// benchDB connects to the database of the DB_* environment, skipping the benchmark without one
+func benchDB(b *testing.B) *db.DB {
+	b.Helper()
+	if os.Getenv("DB_HOST") == "" {
+		b.Skip("DB_HOST is not set, no database to benchmark against")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		b.Fatalf("failed to load config: %v", err)
+	}
+	database, err := db.Load(cfg)
+	if err != nil {
+		b.Skipf("database not available: %v", err)
+	}
+	database.Config.Logger = logger.Default.LogMode(logger.Warn)
+	return database
+}
+
+// benchTrajectoryRows builds random walks around Beijing with evenly spread stay points.
+// Every round starts on its own days so that rounds do not overlap in time.
+func benchTrajectoryRows(userID uint, round int) ([]models.Trajectory, [][]models.StayPoint) {
+	trajectories := make([]models.Trajectory, benchTrajectories)
+	stayPoints := make([][]models.StayPoint, benchTrajectories)
+	start := time.Date(2008, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, round*benchTrajectories)
+
+	for i := range trajectories {
+		lat, lng := 39.9+rand.Float64()*0.1, 116.3+rand.Float64()*0.1
+		points := make([]models.GPSPoint, benchPoints)
+		for j := range points {
+			lat += (rand.Float64() - 0.5) * 0.0005
+			lng += (rand.Float64() - 0.5) * 0.0005
+			points[j] = models.GPSPoint{
+				Latitude:  lat,
+				Longitude: lng,
+				Altitude:  50,
+				Timestamp: start.Add(time.Duration(j) * 5 * time.Second),
+			}
+		}
+
+		pointsJSON, _ := json.Marshal(points)
+		trajectories[i] = models.Trajectory{
+			UserID:    userID,
+			Name:      fmt.Sprintf("bench %d", i),
+			Points:    pointsJSON,
+			StartTime: points[0].Timestamp,
+			EndTime:   points[len(points)-1].Timestamp,
+		}
+
+		for k := 0; k < benchStays; k++ {
+			p := points[(k*benchPoints)/benchStays]
+			stayPoints[i] = append(stayPoints[i], models.StayPoint{
+				UserID:        userID,
+				Latitude:      p.Latitude,
+				Longitude:     p.Longitude,
+				ArrivalTime:   p.Timestamp,
+				DepartureTime: p.Timestamp.Add(30 * time.Minute),
+			})
+		}
+
+		start = start.Add(24 * time.Hour)
+	}
+
+	return trajectories, stayPoints
+}
+
+func reportPointRate(b *testing.B) {
+	seconds := b.Elapsed().Seconds()
+	if seconds > 0 {
+		b.ReportMetric(float64(b.N*benchTrajectories)/seconds, "trajectories/s")
+		b.ReportMetric(float64(b.N*benchTrajectories*benchPoints)/seconds, "points/s")
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+type DeviceServices struct {
+	DB *db.DB
+}
+
+func NewDeviceServices(db *db.DB) *DeviceServices {
+	return &DeviceServices{DB: db}
+}
+
+// CreateDevice registers a device with a new personal token; the plain token is only returned here
+func (s *DeviceServices) CreateDevice(userID uint, name string) (*models.TrackingDevice, string, error) {
+	tokenBytes := make([]byte, 24)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	tokenHash := hashDeviceToken(token)
+
+	device := models.TrackingDevice{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: &tokenHash,
+	}
+	if err := s.DB.Create(&device).Error; err != nil {
+		return nil, "", err
+	}
+
+	return &device, token, nil
+}
+
+// GetByToken finds the device a personal token was issued for
+func (s *DeviceServices) GetByToken(token string) (*models.TrackingDevice, error) {
+	var device models.TrackingDevice
+	if err := s.DB.Where("token_hash = ?", hashDeviceToken(token)).First(&device).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("device not found")
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetByID retrieves a device by its ID
+func (s *DeviceServices) GetByID(id uint) (*models.TrackingDevice, error) {
+	var device models.TrackingDevice
+	if err := s.DB.First(&device, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("device not found")
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// FindOrCreate returns the user's device with the given name, creating it without a token if needed
+func (s *DeviceServices) FindOrCreate(userID uint, name string) (*models.TrackingDevice, error) {
+	device := models.TrackingDevice{UserID: userID, Name: name}
+	err := s.DB.Where("user_id = ? AND name = ?", userID, name).FirstOrCreate(&device).Error
+	if err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetByUser retrieves all devices of a user
+func (s *DeviceServices) GetByUser(userID uint) ([]models.TrackingDevice, error) {
+	var devices []models.TrackingDevice
+	err := s.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// Delete removes a device; its trajectories are kept
+func (s *DeviceServices) Delete(id uint) error {
+	return s.DB.Delete(&models.TrackingDevice{}, id).Error
+}
+
+// TouchLastSeen records that the device has just reported
+func (s *DeviceServices) TouchLastSeen(id uint) error {
+	return s.DB.Model(&models.TrackingDevice{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
+
+// hashDeviceToken hashes a personal token for storage and lookup
+func hashDeviceToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
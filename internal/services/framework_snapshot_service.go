@@ -0,0 +1,432 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+// SnapshotFormat is the version of the framework snapshot format written by ExportFramework
+const SnapshotFormat = 1
+
+// ErrInvalidSnapshot is returned when a framework snapshot cannot be imported
+var ErrInvalidSnapshot = errors.New("invalid framework snapshot")
+
+// FrameworkSnapshot is a portable copy of a framework with its layers, clusters and user
+// graphs. Clusters are identified by their ID in the exporting database and users by
+// username, so a snapshot can be imported into another database. Stay points are local to
+// each database and not included; updating an imported framework assigns the local stay
+// points to its clusters.
+type FrameworkSnapshot struct {
+	Format     int               `json:"format"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Framework  SnapshotFramework `json:"framework"`
+	Layers     []SnapshotLayer   `json:"layers"`
+	Graphs     []SnapshotGraph   `json:"graphs"`
+}
+
+// SnapshotFramework holds the version and build parameters of the exported framework
+type SnapshotFramework struct {
+	Version         int       `json:"version"`
+	Algorithm       string    `json:"algorithm"`
+	Epsilon         float64   `json:"epsilon"`
+	MinPoints       int       `json:"min_points"`
+	MaxLayers       int       `json:"max_layers"`
+	LayerScales     []float64 `json:"layer_scales"`
+	MinClusterSize  int       `json:"min_cluster_size"`
+	MaxLinkDistance float64   `json:"max_link_distance"`
+	StayPointCount  int       `json:"stay_point_count"` // In the exporting database, not imported
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// SnapshotLayer holds the clusters of one layer
+type SnapshotLayer struct {
+	Level    int               `json:"level"`
+	Clusters []SnapshotCluster `json:"clusters"`
+}
+
+// SnapshotCluster is a cluster of a layer. Parent is the ID of its parent in the next layer.
+type SnapshotCluster struct {
+	ID         uint    `json:"id"`
+	Parent     *uint   `json:"parent,omitempty"`
+	CenterLat  float64 `json:"center_lat"`
+	CenterLng  float64 `json:"center_lng"`
+	Radius     float64 `json:"radius"` // km
+	VisitCount int     `json:"visit_count"`
+}
+
+// SnapshotGraph is the graph of one user
+type SnapshotGraph struct {
+	Username string         `json:"username"`
+	Nodes    []SnapshotNode `json:"nodes"`
+	Edges    []SnapshotEdge `json:"edges"`
+}
+
+// SnapshotNode is a graph node on the cluster with ID Cluster
+type SnapshotNode struct {
+	Cluster      uint      `json:"cluster"`
+	VisitCount   int       `json:"visit_count"`
+	FirstVisitAt time.Time `json:"first_visit_at"`
+	LastVisitAt  time.Time `json:"last_visit_at"`
+}
+
+// SnapshotEdge connects the nodes at positions From and To of its graph
+type SnapshotEdge struct {
+	From           int `json:"from"`
+	To             int `json:"to"`
+	TransitionTime int `json:"transition_time"` // Seconds
+	VisitCount     int `json:"visit_count"`
+}
+
+// SnapshotImportReport summarizes an imported snapshot
+type SnapshotImportReport struct {
+	Framework     models.HierarchicalFramework `json:"framework"`
+	Clusters      int                          `json:"clusters"`
+	Graphs        int                          `json:"graphs"`
+	SkippedGraphs []string                     `json:"skipped_graphs"` // Usernames unknown here
+}
+
+// ExportFramework returns a snapshot of a framework
+func (s *HierarchicalFrameworkService) ExportFramework(id uint) (*FrameworkSnapshot, error) {
+	var framework models.HierarchicalFramework
+	if err := s.db.Preload("Layers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("level ASC")
+	}).Preload("Layers.Clusters", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).First(&framework, id).Error; err != nil {
+		return nil, err
+	}
+
+	snapshot := &FrameworkSnapshot{
+		Format:     SnapshotFormat,
+		ExportedAt: time.Now(),
+		Framework: SnapshotFramework{
+			Version:         framework.Version,
+			Algorithm:       framework.Algorithm,
+			Epsilon:         framework.Epsilon,
+			MinPoints:       framework.MinPoints,
+			MaxLayers:       framework.MaxLayers,
+			LayerScales:     framework.LayerScales,
+			MinClusterSize:  framework.MinClusterSize,
+			MaxLinkDistance: framework.MaxLinkDistance,
+			StayPointCount:  framework.StayPointCount,
+			CreatedAt:       framework.CreatedAt,
+		},
+		Layers: make([]SnapshotLayer, len(framework.Layers)),
+		Graphs: []SnapshotGraph{},
+	}
+	for i, layer := range framework.Layers {
+		clusters := make([]SnapshotCluster, len(layer.Clusters))
+		for j, cluster := range layer.Clusters {
+			clusters[j] = SnapshotCluster{
+				ID:         cluster.ID,
+				Parent:     cluster.ParentID,
+				CenterLat:  cluster.CenterLat,
+				CenterLng:  cluster.CenterLng,
+				Radius:     cluster.Radius,
+				VisitCount: cluster.VisitCount,
+			}
+		}
+		snapshot.Layers[i] = SnapshotLayer{Level: layer.Level, Clusters: clusters}
+	}
+
+	var graphs []models.HierarchicalGraph
+	if err := s.db.Preload("Nodes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Preload("Edges", func(db *gorm.DB) *gorm.DB {
+		return db.Order("id ASC")
+	}).Where("framework_id = ?", id).Order("id ASC").Find(&graphs).Error; err != nil {
+		return nil, err
+	}
+	usernames, err := s.usernames(graphs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, graph := range graphs {
+		exported := SnapshotGraph{
+			Username: usernames[graph.UserID],
+			Nodes:    make([]SnapshotNode, len(graph.Nodes)),
+			Edges:    make([]SnapshotEdge, 0, len(graph.Edges)),
+		}
+		position := make(map[uint]int, len(graph.Nodes))
+		for i, node := range graph.Nodes {
+			position[node.ID] = i
+			exported.Nodes[i] = SnapshotNode{
+				Cluster:      node.ClusterID,
+				VisitCount:   node.VisitCount,
+				FirstVisitAt: node.FirstVisitAt,
+				LastVisitAt:  node.LastVisitAt,
+			}
+		}
+		for _, edge := range graph.Edges {
+			from, okFrom := position[edge.FromNodeID]
+			to, okTo := position[edge.ToNodeID]
+			if !okFrom || !okTo {
+				continue
+			}
+			exported.Edges = append(exported.Edges, SnapshotEdge{
+				From:           from,
+				To:             to,
+				TransitionTime: edge.TransitionTime,
+				VisitCount:     edge.VisitCount,
+			})
+		}
+		snapshot.Graphs = append(snapshot.Graphs, exported)
+	}
+
+	return snapshot, nil
+}
+
+// ImportFramework stores a snapshot as a new, inactive framework version in one
+// transaction. Locations of its bottom layer are created once it is activated. Graphs of
+// users who do not exist here are skipped.
+func (s *HierarchicalFrameworkService) ImportFramework(snapshot *FrameworkSnapshot) (*SnapshotImportReport, error) {
+	if err := validateSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+
+	report := &SnapshotImportReport{SkippedGraphs: []string{}}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		version, err := nextFrameworkVersion(tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		// Like its clusters, the framework starts with a stay point count of 0: it was built
+		// from none of the local stay points
+		params := snapshot.Framework
+		framework := models.HierarchicalFramework{
+			Version:         version,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			Algorithm:       params.Algorithm,
+			Epsilon:         params.Epsilon,
+			MinPoints:       params.MinPoints,
+			MaxLayers:       params.MaxLayers,
+			LayerScales:     params.LayerScales,
+			MinClusterSize:  params.MinClusterSize,
+			MaxLinkDistance: params.MaxLinkDistance,
+		}
+		if err := tx.Omit("Layers").Create(&framework).Error; err != nil {
+			return err
+		}
+
+		// IDs of the imported clusters by their ID in the snapshot
+		clusterIDs := make(map[uint]uint)
+		for _, layer := range snapshot.Layers {
+			stored := models.Layer{FrameworkID: framework.ID, Level: layer.Level, CreatedAt: now, UpdatedAt: now}
+			if err := tx.Omit("Clusters").Create(&stored).Error; err != nil {
+				return err
+			}
+			if len(layer.Clusters) == 0 {
+				continue
+			}
+
+			// Stay point counts start at 0: the clusters have no local stay points yet
+			clusters := make([]models.Cluster, len(layer.Clusters))
+			for j, cluster := range layer.Clusters {
+				clusters[j] = models.Cluster{
+					FrameworkID: framework.ID,
+					LayerID:     stored.ID,
+					CenterLat:   cluster.CenterLat,
+					CenterLng:   cluster.CenterLng,
+					Radius:      cluster.Radius,
+					VisitCount:  cluster.VisitCount,
+					CreatedAt:   now,
+					UpdatedAt:   now,
+				}
+			}
+			if err := tx.Omit("StayPoints").CreateInBatches(&clusters, 1000).Error; err != nil {
+				return err
+			}
+			for j, cluster := range layer.Clusters {
+				clusterIDs[cluster.ID] = clusters[j].ID
+			}
+			report.Clusters += len(clusters)
+		}
+
+		// Parents are stored once every layer has IDs
+		children := make(map[uint][]uint)
+		for _, layer := range snapshot.Layers {
+			for _, cluster := range layer.Clusters {
+				if cluster.Parent != nil {
+					parentID := clusterIDs[*cluster.Parent]
+					children[parentID] = append(children[parentID], clusterIDs[cluster.ID])
+				}
+			}
+		}
+		for parentID, ids := range children {
+			if err := tx.Model(&models.Cluster{}).Where("id IN ?", ids).Update("parent_id", parentID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := importGraphs(tx, framework.ID, snapshot.Graphs, clusterIDs, report); err != nil {
+			return err
+		}
+
+		report.Framework = framework
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// importGraphs stores the graphs of a snapshot for the users with the same username
+func importGraphs(tx *gorm.DB, frameworkID uint, graphs []SnapshotGraph, clusterIDs map[uint]uint, report *SnapshotImportReport) error {
+	names := make([]string, 0, len(graphs))
+	for _, graph := range graphs {
+		names = append(names, graph.Username)
+	}
+	var users []models.User
+	if len(names) > 0 {
+		if err := tx.Select("id", "username").Where("username IN ?", names).Find(&users).Error; err != nil {
+			return err
+		}
+	}
+	userIDs := make(map[string]uint, len(users))
+	for _, user := range users {
+		userIDs[user.Username] = user.ID
+	}
+
+	for _, graph := range graphs {
+		userID, ok := userIDs[graph.Username]
+		if !ok {
+			report.SkippedGraphs = append(report.SkippedGraphs, graph.Username)
+			continue
+		}
+
+		stored := models.HierarchicalGraph{UserID: userID, FrameworkID: frameworkID}
+		if err := tx.Create(&stored).Error; err != nil {
+			return err
+		}
+		if len(graph.Nodes) == 0 {
+			report.Graphs++
+			continue
+		}
+
+		nodes := make([]models.GraphNode, len(graph.Nodes))
+		for i, node := range graph.Nodes {
+			nodes[i] = models.GraphNode{
+				GraphID:      stored.ID,
+				ClusterID:    clusterIDs[node.Cluster],
+				VisitCount:   node.VisitCount,
+				FirstVisitAt: node.FirstVisitAt,
+				LastVisitAt:  node.LastVisitAt,
+			}
+		}
+		if err := tx.CreateInBatches(&nodes, 1000).Error; err != nil {
+			return err
+		}
+
+		if len(graph.Edges) > 0 {
+			edges := make([]models.GraphEdge, len(graph.Edges))
+			for i, edge := range graph.Edges {
+				edges[i] = models.GraphEdge{
+					GraphID:        stored.ID,
+					FromNodeID:     nodes[edge.From].ID,
+					ToNodeID:       nodes[edge.To].ID,
+					TransitionTime: edge.TransitionTime,
+					VisitCount:     edge.VisitCount,
+				}
+			}
+			if err := tx.CreateInBatches(&edges, 1000).Error; err != nil {
+				return err
+			}
+		}
+		report.Graphs++
+	}
+	return nil
+}
+
+// validateSnapshot checks that every reference in a snapshot resolves, so that an import
+// cannot fail halfway on a foreign key
+func validateSnapshot(snapshot *FrameworkSnapshot) error {
+	if snapshot.Format != SnapshotFormat {
+		return fmt.Errorf("%w: format %d, expected %d", ErrInvalidSnapshot, snapshot.Format, SnapshotFormat)
+	}
+	if len(snapshot.Layers) == 0 {
+		return fmt.Errorf("%w: no layers", ErrInvalidSnapshot)
+	}
+
+	// Frameworks that did not record their parameters are exported without them
+	if params := snapshot.Framework; params.Algorithm != "" {
+		err := algorithms.HierarchicalClusteringParams{
+			Algorithm:   params.Algorithm,
+			Epsilon:     params.Epsilon,
+			MinPoints:   params.MinPoints,
+			MaxLayers:   params.MaxLayers,
+			LayerScales: params.LayerScales,
+		}.Validate()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+	}
+
+	// Layer of every cluster
+	layerOf := make(map[uint]int)
+	for i, layer := range snapshot.Layers {
+		if i > 0 && layer.Level <= snapshot.Layers[i-1].Level {
+			return fmt.Errorf("%w: layers not in increasing level order", ErrInvalidSnapshot)
+		}
+		for _, cluster := range layer.Clusters {
+			if _, ok := layerOf[cluster.ID]; ok {
+				return fmt.Errorf("%w: duplicate cluster %d", ErrInvalidSnapshot, cluster.ID)
+			}
+			layerOf[cluster.ID] = i
+		}
+	}
+	for i, layer := range snapshot.Layers {
+		for _, cluster := range layer.Clusters {
+			if cluster.Parent == nil {
+				continue
+			}
+			if parentLayer, ok := layerOf[*cluster.Parent]; !ok || parentLayer != i+1 {
+				return fmt.Errorf("%w: parent %d of cluster %d is not in the next layer", ErrInvalidSnapshot, *cluster.Parent, cluster.ID)
+			}
+		}
+	}
+
+	for _, graph := range snapshot.Graphs {
+		for _, node := range graph.Nodes {
+			if _, ok := layerOf[node.Cluster]; !ok {
+				return fmt.Errorf("%w: graph of %q has a node on unknown cluster %d", ErrInvalidSnapshot, graph.Username, node.Cluster)
+			}
+		}
+		for _, edge := range graph.Edges {
+			if edge.From < 0 || edge.From >= len(graph.Nodes) || edge.To < 0 || edge.To >= len(graph.Nodes) {
+				return fmt.Errorf("%w: graph of %q has an edge between unknown nodes", ErrInvalidSnapshot, graph.Username)
+			}
+		}
+	}
+	return nil
+}
+
+// usernames returns the usernames of the owners of graphs by user ID
+func (s *HierarchicalFrameworkService) usernames(graphs []models.HierarchicalGraph) (map[uint]string, error) {
+	ids := make([]uint, 0, len(graphs))
+	for _, graph := range graphs {
+		ids = append(ids, graph.UserID)
+	}
+	names := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return names, nil
+	}
+
+	var users []models.User
+	if err := s.db.Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		names[user.ID] = user.Username
+	}
+	return names, nil
+}
@@ -0,0 +1,618 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ErrNotIncremental is returned when a framework cannot be updated incrementally with the
+// given parameters
+var ErrNotIncremental = errors.New("framework cannot be updated incrementally")
+
+// LayerUpdateReport reports how an incremental update changed one layer
+type LayerUpdateReport struct {
+	Level      int `json:"level"`
+	StayPoints int `json:"stay_points"` // Stay points in no cluster of the layer before the update
+	Assigned   int `json:"assigned"`    // Of those, stay points that joined existing clusters
+	Created    int `json:"created"`
+	Merged     int `json:"merged"`
+	Split      int `json:"split"`
+	Removed    int `json:"removed"`
+}
+
+// FrameworkUpdateReport summarizes an incremental update of a framework
+type FrameworkUpdateReport struct {
+	FrameworkID uint                   `json:"framework_id"`
+	Layers      []LayerUpdateReport    `json:"layers"`
+	Changes     []models.ClusterChange `json:"changes"`
+}
+
+// UpdateFramework brings a stored framework up to date with the stay points without
+// rebuilding it, so that cluster IDs referenced by locations and user graphs stay valid.
+// Per layer, clusters that lost stay points are clustered again and split or removed, then
+// the stay points in no cluster of the layer are assigned to existing clusters, merge them
+// or seed new ones (see algorithms.UpdateLayer). The centres, radii and visit counts of
+// the changed clusters are updated in place, parents are linked again and every created,
+// merged, split and removed cluster is recorded as a models.ClusterChange. Locations of
+// the bottom layer follow their clusters. Only DBSCAN frameworks can be updated, with the
+// parameters they were built with; a framework that did not record them stores params as
+// its parameters, so that later updates use the same.
+func (s *HierarchicalFrameworkService) UpdateFramework(frameworkID uint, params algorithms.HierarchicalClusteringParams) (*FrameworkUpdateReport, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
+	var framework models.HierarchicalFramework
+	if err := s.db.First(&framework, frameworkID).Error; err != nil {
+		return nil, err
+	}
+
+	var layers []models.Layer
+	if err := s.db.Where("framework_id = ?", frameworkID).Order("level ASC").Find(&layers).Error; err != nil {
+		return nil, err
+	}
+	epsilons := make([]float64, len(layers))
+	for i, layer := range layers {
+		epsilon, err := algorithms.LayerEpsilon(params, layer.Level)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotIncremental, err)
+		}
+		epsilons[i] = epsilon
+	}
+
+	report := &FrameworkUpdateReport{FrameworkID: frameworkID}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		u := &frameworkUpdater{tx: tx, frameworkID: frameworkID, now: time.Now()}
+		for i, layer := range layers {
+			// Locations are created from the clusters of the bottom layer once it is active
+			u.locations = i == 0 && framework.Active
+			layerReport, err := u.updateLayer(layer, epsilons[i], params.MinPoints)
+			if err != nil {
+				return err
+			}
+			report.Layers = append(report.Layers, *layerReport)
+		}
+
+		for i := 0; i+1 < len(layers); i++ {
+			if err := linkParents(tx, layers[i].ID, layers[i+1].ID); err != nil {
+				return err
+			}
+		}
+
+		if len(u.changes) > 0 {
+			if err := tx.CreateInBatches(&u.changes, 1000).Error; err != nil {
+				return err
+			}
+		}
+		report.Changes = u.changes
+
+		updates := map[string]interface{}{"updated_at": u.now}
+		if _, recorded := algorithms.FrameworkParams(&framework); !recorded {
+			updates["algorithm"] = algorithms.ClusteringDBSCAN
+			updates["epsilon"] = params.Epsilon
+			updates["min_points"] = params.MinPoints
+			levels := 0
+			if len(layers) > 0 {
+				levels = layers[len(layers)-1].Level
+			}
+			updates["max_layers"] = levels
+			updates["layer_scales"] = datatypes.NewJSONSlice(params.LayerScales[:levels])
+		}
+		return tx.Model(&models.HierarchicalFramework{}).Where("id = ?", frameworkID).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// GetClusterChanges returns the changes recorded by incremental updates of a framework,
+// newest first
+func (s *HierarchicalFrameworkService) GetClusterChanges(frameworkID uint, limit int) ([]models.ClusterChange, error) {
+	var changes []models.ClusterChange
+	if err := s.db.Where("framework_id = ?", frameworkID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// frameworkUpdater applies an incremental update of one framework within a transaction
+type frameworkUpdater struct {
+	tx          *gorm.DB
+	frameworkID uint
+	now         time.Time
+	locations   bool // Whether the layer being updated is the bottom layer
+	changes     []models.ClusterChange
+}
+
+// updateLayer splits or removes the clusters of a layer that lost stay points, then
+// clusters the stay points in no cluster of the layer into the remaining ones
+func (u *frameworkUpdater) updateLayer(layer models.Layer, epsilon float64, minPoints int) (*LayerUpdateReport, error) {
+	report := &LayerUpdateReport{Level: layer.Level}
+
+	var clusters []models.Cluster
+	if err := u.tx.Where("layer_id = ?", layer.ID).Order("id ASC").Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		ClusterID uint
+		Count     int
+	}
+	if err := u.tx.Model(&models.ClusterStayPoint{}).
+		Select("cluster_id, COUNT(*) AS count").
+		Where("layer_id = ?", layer.ID).
+		Group("cluster_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	members := make(map[uint]int, len(counts))
+	for _, count := range counts {
+		members[count.ClusterID] = count.Count
+	}
+
+	// Clusters whose stay points were deleted may have fallen apart
+	kept := make([]models.Cluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if members[cluster.ID] == cluster.StayPointCount {
+			kept = append(kept, cluster)
+			continue
+		}
+
+		stayPoints, err := clusterStayPoints(u.tx, cluster.ID)
+		if err != nil {
+			return nil, err
+		}
+		var parts [][]models.StayPoint
+		if len(stayPoints) > 0 {
+			parts = algorithms.SplitCluster(stayPoints, epsilon, minPoints)
+		}
+
+		if len(parts) == 0 {
+			if err := u.removeCluster(cluster.ID); err != nil {
+				return nil, err
+			}
+			u.record(layer.ID, models.ClusterRemoved, cluster.ID, nil, len(stayPoints))
+			report.Removed++
+			continue
+		}
+
+		// The largest part keeps the cluster; the others and the noise leave it
+		inPart := make(map[uint]bool, len(parts[0]))
+		for _, sp := range parts[0] {
+			inPart[sp.ID] = true
+		}
+		var leaving []uint
+		for _, sp := range stayPoints {
+			if !inPart[sp.ID] {
+				leaving = append(leaving, sp.ID)
+			}
+		}
+		if len(leaving) > 0 {
+			if err := u.tx.Where("cluster_id = ? AND stay_point_id IN ?", cluster.ID, leaving).
+				Delete(&models.ClusterStayPoint{}).Error; err != nil {
+				return nil, err
+			}
+		}
+		for _, part := range parts[1:] {
+			split, err := u.createCluster(layer, part)
+			if err != nil {
+				return nil, err
+			}
+			sourceID := cluster.ID
+			u.record(layer.ID, models.ClusterSplit, split.ID, &sourceID, len(part))
+			report.Split++
+			kept = append(kept, *split)
+		}
+
+		if err := u.refreshCluster(&cluster, parts[0]); err != nil {
+			return nil, err
+		}
+		kept = append(kept, cluster)
+	}
+	clusters = kept
+
+	// Stay points added since the layer was built or last updated, and the noise
+	var stayPoints []models.StayPoint
+	if err := u.tx.Where("NOT EXISTS (SELECT 1 FROM cluster_stay_points WHERE cluster_stay_points.stay_point_id = stay_points.id AND cluster_stay_points.layer_id = ?)", layer.ID).
+		Order("id ASC").
+		Find(&stayPoints).Error; err != nil {
+		return nil, err
+	}
+	report.StayPoints = len(stayPoints)
+
+	layerMembers, err := u.layerMembers(layer.ID, clusters)
+	if err != nil {
+		return nil, err
+	}
+	update := algorithms.UpdateLayer(clusters, layerMembers, stayPoints, epsilon, minPoints)
+
+	changed := make(map[int]bool)
+	for _, merge := range update.Merges {
+		root := clusters[merge[0]]
+		for _, c := range merge[1:] {
+			absorbed := clusters[c]
+			if err := u.mergeCluster(root.ID, absorbed.ID); err != nil {
+				return nil, err
+			}
+			sourceID := absorbed.ID
+			u.record(layer.ID, models.ClusterMerged, root.ID, &sourceID, absorbed.StayPointCount)
+			report.Merged++
+		}
+		changed[merge[0]] = true
+	}
+
+	for c, assigned := range update.Assigned {
+		if err := u.addStayPoints(layer.ID, clusters[c].ID, assigned); err != nil {
+			return nil, err
+		}
+		report.Assigned += len(assigned)
+		changed[c] = true
+	}
+
+	for _, seed := range update.Seeds {
+		cluster, err := u.createCluster(layer, seed)
+		if err != nil {
+			return nil, err
+		}
+		u.record(layer.ID, models.ClusterCreated, cluster.ID, nil, len(seed))
+		report.Created++
+	}
+
+	for c := range changed {
+		stayPoints, err := clusterStayPoints(u.tx, clusters[c].ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := u.refreshCluster(&clusters[c], stayPoints); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// layerMembers returns the positions of the stay points of every cluster of a layer, in
+// the order of clusters
+func (u *frameworkUpdater) layerMembers(layerID uint, clusters []models.Cluster) ([][]models.StayPoint, error) {
+	var rows []struct {
+		ClusterID uint
+		Latitude  float64
+		Longitude float64
+	}
+	if err := u.tx.Table("cluster_stay_points").
+		Select("cluster_stay_points.cluster_id, stay_points.latitude, stay_points.longitude").
+		Joins("JOIN stay_points ON stay_points.id = cluster_stay_points.stay_point_id").
+		Where("cluster_stay_points.layer_id = ?", layerID).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	position := make(map[uint]int, len(clusters))
+	for i, cluster := range clusters {
+		position[cluster.ID] = i
+	}
+	members := make([][]models.StayPoint, len(clusters))
+	for _, row := range rows {
+		if i, ok := position[row.ClusterID]; ok {
+			members[i] = append(members[i], models.StayPoint{Latitude: row.Latitude, Longitude: row.Longitude})
+		}
+	}
+	return members, nil
+}
+
+// createCluster stores a new cluster of a layer with its stay points, and its location in
+// the bottom layer
+func (u *frameworkUpdater) createCluster(layer models.Layer, stayPoints []models.StayPoint) (*models.Cluster, error) {
+	centerLat, centerLng, radius, visitCount := algorithms.ClusterMetrics(stayPoints)
+	cluster := &models.Cluster{
+		FrameworkID:    u.frameworkID,
+		LayerID:        layer.ID,
+		CenterLat:      centerLat,
+		CenterLng:      centerLng,
+		Radius:         radius,
+		VisitCount:     visitCount,
+		StayPointCount: len(stayPoints),
+		CreatedAt:      u.now,
+		UpdatedAt:      u.now,
+	}
+	if err := u.tx.Omit("StayPoints").Create(cluster).Error; err != nil {
+		return nil, err
+	}
+	if err := u.addStayPoints(layer.ID, cluster.ID, stayPoints); err != nil {
+		return nil, err
+	}
+
+	if u.locations {
+		location := models.Location{
+			Latitude:   centerLat,
+			Longitude:  centerLng,
+			ClusterID:  cluster.ID,
+			VisitCount: visitCount,
+		}
+		if err := u.tx.Create(&location).Error; err != nil {
+			return nil, err
+		}
+	}
+	return cluster, nil
+}
+
+// refreshCluster stores the metrics of a cluster computed from all its stay points, and
+// moves its locations in the bottom layer along
+func (u *frameworkUpdater) refreshCluster(cluster *models.Cluster, stayPoints []models.StayPoint) error {
+	cluster.CenterLat, cluster.CenterLng, cluster.Radius, cluster.VisitCount = algorithms.ClusterMetrics(stayPoints)
+	cluster.StayPointCount = len(stayPoints)
+	cluster.UpdatedAt = u.now
+	if err := u.tx.Model(&models.Cluster{}).Where("id = ?", cluster.ID).Updates(map[string]interface{}{
+		"center_lat":       cluster.CenterLat,
+		"center_lng":       cluster.CenterLng,
+		"radius":           cluster.Radius,
+		"visit_count":      cluster.VisitCount,
+		"stay_point_count": cluster.StayPointCount,
+		"updated_at":       cluster.UpdatedAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	if !u.locations {
+		return nil
+	}
+	return u.tx.Model(&models.Location{}).Where("cluster_id = ?", cluster.ID).Updates(map[string]interface{}{
+		"latitude":    cluster.CenterLat,
+		"longitude":   cluster.CenterLng,
+		"visit_count": cluster.VisitCount,
+	}).Error
+}
+
+// mergeCluster moves the stay points and children of a cluster to the cluster absorbing it
+// and deletes it. The root keeps its location, which the stay points of the absorbed
+// cluster's location move to, and user graphs keep one node for both clusters.
+func (u *frameworkUpdater) mergeCluster(rootID, absorbedID uint) error {
+	if err := u.tx.Model(&models.ClusterStayPoint{}).Where("cluster_id = ?", absorbedID).Update("cluster_id", rootID).Error; err != nil {
+		return err
+	}
+	if err := u.tx.Model(&models.Cluster{}).Where("parent_id = ?", absorbedID).Update("parent_id", rootID).Error; err != nil {
+		return err
+	}
+	if err := u.mergeLocations(rootID, absorbedID); err != nil {
+		return err
+	}
+	if err := u.mergeGraphNodes(rootID, absorbedID); err != nil {
+		return err
+	}
+	return u.tx.Delete(&models.Cluster{}, absorbedID).Error
+}
+
+// mergeLocations deletes the locations of an absorbed cluster, moving their stay points to
+// the location of the root. A root without a location takes over the absorbed one.
+func (u *frameworkUpdater) mergeLocations(rootID, absorbedID uint) error {
+	var root []models.Location
+	if err := u.tx.Where("cluster_id = ?", rootID).Order("id ASC").Limit(1).Find(&root).Error; err != nil {
+		return err
+	}
+	if len(root) == 0 {
+		return u.tx.Model(&models.Location{}).Where("cluster_id = ?", absorbedID).Update("cluster_id", rootID).Error
+	}
+
+	absorbed := u.tx.Model(&models.Location{}).Select("id").Where("cluster_id = ?", absorbedID)
+	if err := u.tx.Model(&models.StayPoint{}).Where("location_id IN (?)", absorbed).Update("location_id", root[0].ID).Error; err != nil {
+		return err
+	}
+	return u.tx.Where("cluster_id = ?", absorbedID).Delete(&models.Location{}).Error
+}
+
+// mergeGraphNodes folds the graph nodes of an absorbed cluster into the node of the root in
+// the same graph, adding up the visits. Their edges move to the root's node; transitions
+// between the two clusters are dropped and edges that end up between the same nodes are
+// combined.
+func (u *frameworkUpdater) mergeGraphNodes(rootID, absorbedID uint) error {
+	var absorbed []models.GraphNode
+	if err := u.tx.Where("cluster_id = ?", absorbedID).Order("id ASC").Find(&absorbed).Error; err != nil {
+		return err
+	}
+
+	targets := make(map[uint]*models.GraphNode) // Node of the root by graph ID
+	for i := range absorbed {
+		node := &absorbed[i]
+		target, ok := targets[node.GraphID]
+		if !ok {
+			var root []models.GraphNode
+			if err := u.tx.Where("graph_id = ? AND cluster_id = ?", node.GraphID, rootID).Order("id ASC").Limit(1).Find(&root).Error; err != nil {
+				return err
+			}
+			if len(root) == 0 {
+				// The graph did not visit the root: the node moves over as it is
+				node.ClusterID = rootID
+				if err := u.tx.Model(node).Update("cluster_id", rootID).Error; err != nil {
+					return err
+				}
+				targets[node.GraphID] = node
+				continue
+			}
+			target = &root[0]
+			targets[node.GraphID] = target
+		}
+
+		target.VisitCount += node.VisitCount
+		if node.FirstVisitAt.Before(target.FirstVisitAt) {
+			target.FirstVisitAt = node.FirstVisitAt
+		}
+		if node.LastVisitAt.After(target.LastVisitAt) {
+			target.LastVisitAt = node.LastVisitAt
+		}
+		if err := u.tx.Model(target).Updates(map[string]interface{}{
+			"visit_count":    target.VisitCount,
+			"first_visit_at": target.FirstVisitAt,
+			"last_visit_at":  target.LastVisitAt,
+			"updated_at":     u.now,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := u.tx.Model(&models.GraphEdge{}).Where("from_node_id = ?", node.ID).Update("from_node_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := u.tx.Model(&models.GraphEdge{}).Where("to_node_id = ?", node.ID).Update("to_node_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := u.tx.Delete(&models.GraphNode{}, node.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, target := range targets {
+		if err := u.dedupeEdges(target.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dedupeEdges drops the edges of a node to itself and combines its edges between the same
+// nodes into the oldest one, adding up the visits and averaging the transition times
+func (u *frameworkUpdater) dedupeEdges(nodeID uint) error {
+	if err := u.tx.Where("from_node_id = ? AND to_node_id = ?", nodeID, nodeID).Delete(&models.GraphEdge{}).Error; err != nil {
+		return err
+	}
+
+	var edges []models.GraphEdge
+	if err := u.tx.Where("from_node_id = ? OR to_node_id = ?", nodeID, nodeID).Order("id ASC").Find(&edges).Error; err != nil {
+		return err
+	}
+	byNodes := make(map[[2]uint][]models.GraphEdge)
+	for _, edge := range edges {
+		key := [2]uint{edge.FromNodeID, edge.ToNodeID}
+		byNodes[key] = append(byNodes[key], edge)
+	}
+
+	for _, same := range byNodes {
+		if len(same) < 2 {
+			continue
+		}
+		kept := same[0]
+		transitionTime := 0
+		ids := make([]uint, 0, len(same)-1)
+		for i, edge := range same {
+			transitionTime += edge.TransitionTime
+			if i > 0 {
+				kept.VisitCount += edge.VisitCount
+				ids = append(ids, edge.ID)
+			}
+		}
+		if err := u.tx.Model(&models.GraphEdge{}).Where("id = ?", kept.ID).Updates(map[string]interface{}{
+			"visit_count":     kept.VisitCount,
+			"transition_time": transitionTime / len(same),
+			"updated_at":      u.now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := u.tx.Delete(&models.GraphEdge{}, ids).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeCluster deletes a cluster left without stay points together with its locations,
+// and the nodes of user graphs visiting it with their edges
+func (u *frameworkUpdater) removeCluster(clusterID uint) error {
+	locations := u.tx.Model(&models.Location{}).Select("id").Where("cluster_id = ?", clusterID)
+	if err := u.tx.Model(&models.StayPoint{}).Where("location_id IN (?)", locations).Update("location_id", nil).Error; err != nil {
+		return err
+	}
+	if err := u.tx.Where("cluster_id = ?", clusterID).Delete(&models.Location{}).Error; err != nil {
+		return err
+	}
+
+	nodes := u.tx.Model(&models.GraphNode{}).Select("id").Where("cluster_id = ?", clusterID)
+	if err := u.tx.Where("from_node_id IN (?) OR to_node_id IN (?)", nodes, nodes).Delete(&models.GraphEdge{}).Error; err != nil {
+		return err
+	}
+	if err := u.tx.Where("cluster_id = ?", clusterID).Delete(&models.GraphNode{}).Error; err != nil {
+		return err
+	}
+	return u.tx.Delete(&models.Cluster{}, clusterID).Error
+}
+
+// addStayPoints stores stay points in no cluster of a layer as members of a cluster
+func (u *frameworkUpdater) addStayPoints(layerID, clusterID uint, stayPoints []models.StayPoint) error {
+	if len(stayPoints) == 0 {
+		return nil
+	}
+	members := make([]models.ClusterStayPoint, len(stayPoints))
+	for i, sp := range stayPoints {
+		members[i] = models.ClusterStayPoint{ClusterID: clusterID, StayPointID: sp.ID, LayerID: layerID}
+	}
+	return u.tx.CreateInBatches(&members, 5000).Error
+}
+
+func (u *frameworkUpdater) record(layerID uint, kind string, clusterID uint, sourceID *uint, stayPoints int) {
+	u.changes = append(u.changes, models.ClusterChange{
+		FrameworkID:     u.frameworkID,
+		LayerID:         layerID,
+		Kind:            kind,
+		ClusterID:       clusterID,
+		SourceClusterID: sourceID,
+		StayPoints:      stayPoints,
+		CreatedAt:       u.now,
+	})
+}
+
+// linkParents sets the parent of every cluster of a layer to the cluster of the next layer
+// holding most of its stay points, as algorithms.BuildHierarchicalFramework does
+func linkParents(tx *gorm.DB, layerID, nextLayerID uint) error {
+	var shared []struct {
+		ClusterID uint
+		ParentID  uint
+		Count     int
+	}
+	if err := tx.Table("cluster_stay_points AS child").
+		Select("child.cluster_id, parent.cluster_id AS parent_id, COUNT(*) AS count").
+		Joins("JOIN cluster_stay_points AS parent ON parent.stay_point_id = child.stay_point_id AND parent.layer_id = ?", nextLayerID).
+		Where("child.layer_id = ?", layerID).
+		Group("child.cluster_id, parent.cluster_id").
+		Scan(&shared).Error; err != nil {
+		return err
+	}
+
+	best := make(map[uint]uint)
+	most := make(map[uint]int)
+	for _, s := range shared {
+		if s.Count > most[s.ClusterID] || (s.Count == most[s.ClusterID] && s.ParentID < best[s.ClusterID]) {
+			best[s.ClusterID] = s.ParentID
+			most[s.ClusterID] = s.Count
+		}
+	}
+
+	var clusters []models.Cluster
+	if err := tx.Select("id", "parent_id").Where("layer_id = ?", layerID).Find(&clusters).Error; err != nil {
+		return err
+	}
+	children := make(map[uint][]uint) // By parent ID, 0 for none
+	for _, cluster := range clusters {
+		parentID := best[cluster.ID]
+		if (cluster.ParentID != nil && *cluster.ParentID == parentID) || (cluster.ParentID == nil && parentID == 0) {
+			continue
+		}
+		children[parentID] = append(children[parentID], cluster.ID)
+	}
+	for parentID, ids := range children {
+		var parent interface{}
+		if parentID != 0 {
+			parent = parentID
+		}
+		if err := tx.Model(&models.Cluster{}).Where("id IN ?", ids).Update("parent_id", parent).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // HierarchicalFrameworkService handles operations related to the hierarchical framework
@@ -29,10 +30,79 @@ func (s *HierarchicalFrameworkService) CreateFramework() (*models.HierarchicalFr
 	return framework, nil
 }
 
-// GetFramework retrieves a framework by ID
+// SaveFramework stores a framework built by algorithms.BuildHierarchicalFramework in one
+// transaction as the next version: its layers, their clusters linked to the parent cluster
+// of the next layer, and the stay points of every cluster. The IDs of the stored rows are
+// set on framework.
+func (s *HierarchicalFrameworkService) SaveFramework(framework *models.HierarchicalFramework) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		version, err := nextFrameworkVersion(tx)
+		if err != nil {
+			return err
+		}
+		framework.Version = version
+		if err := tx.Omit("Layers").Create(framework).Error; err != nil {
+			return err
+		}
+
+		for i := range framework.Layers {
+			layer := &framework.Layers[i]
+			layer.FrameworkID = framework.ID
+			if err := tx.Omit("Clusters").Create(layer).Error; err != nil {
+				return err
+			}
+			if len(layer.Clusters) == 0 {
+				continue
+			}
+
+			for j := range layer.Clusters {
+				layer.Clusters[j].FrameworkID = framework.ID
+				layer.Clusters[j].LayerID = layer.ID
+			}
+			if err := tx.Omit("StayPoints").CreateInBatches(&layer.Clusters, 1000).Error; err != nil {
+				return err
+			}
+
+			var members []models.ClusterStayPoint
+			for _, cluster := range layer.Clusters {
+				for _, sp := range cluster.StayPoints {
+					members = append(members, models.ClusterStayPoint{ClusterID: cluster.ID, StayPointID: sp.ID, LayerID: layer.ID})
+				}
+			}
+			if err := tx.CreateInBatches(&members, 5000).Error; err != nil {
+				return err
+			}
+		}
+
+		// Parents are stored once the next layer has IDs
+		for i := 0; i+1 < len(framework.Layers); i++ {
+			parents := framework.Layers[i+1].Clusters
+			children := make(map[uint][]uint)
+			for j := range framework.Layers[i].Clusters {
+				cluster := &framework.Layers[i].Clusters[j]
+				if cluster.ParentIndex < 0 || cluster.ParentIndex >= len(parents) {
+					continue
+				}
+				parentID := parents[cluster.ParentIndex].ID
+				cluster.ParentID = &parentID
+				children[parentID] = append(children[parentID], cluster.ID)
+			}
+			for parentID, ids := range children {
+				if err := tx.Model(&models.Cluster{}).Where("id IN ?", ids).Update("parent_id", parentID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// GetFramework retrieves a framework by ID with its layers, finest first, and their clusters
 func (s *HierarchicalFrameworkService) GetFramework(id uint) (*models.HierarchicalFramework, error) {
 	var framework models.HierarchicalFramework
-	if err := s.db.Preload("Layers.Clusters").First(&framework, id).Error; err != nil {
+	if err := s.db.Preload("Layers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("level ASC")
+	}).Preload("Layers.Clusters").First(&framework, id).Error; err != nil {
 		return nil, err
 	}
 	return &framework, nil
@@ -76,7 +146,8 @@ func (s *HierarchicalFrameworkService) CreateCluster(layerID uint, centerLat, ce
 	return cluster, nil
 }
 
-// AddStayPointToCluster adds a stay point to a cluster
+// AddStayPointToCluster adds a stay point to a cluster, moving it out of the cluster it
+// belonged to in the same layer
 func (s *HierarchicalFrameworkService) AddStayPointToCluster(clusterID uint, stayPointID uint) error {
 	var cluster models.Cluster
 	if err := s.db.First(&cluster, clusterID).Error; err != nil {
@@ -88,7 +159,14 @@ func (s *HierarchicalFrameworkService) AddStayPointToCluster(clusterID uint, sta
 		return err
 	}
 
-	return s.db.Model(&cluster).Association("StayPoints").Append(&stayPoint)
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stay_point_id"}, {Name: "layer_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cluster_id"}),
+	}).Create(&models.ClusterStayPoint{
+		ClusterID:   cluster.ID,
+		StayPointID: stayPoint.ID,
+		LayerID:     cluster.LayerID,
+	}).Error
 }
 
 // GetClustersAtLayer returns all clusters at a specific layer
@@ -100,36 +178,56 @@ func (s *HierarchicalFrameworkService) GetClustersAtLayer(layerID uint) ([]model
 	return clusters, nil
 }
 
-// GetStayPointsInCluster returns all stay points in a cluster
+// GetStayPointsInCluster returns the stay points of a cluster ordered by ID
 func (s *HierarchicalFrameworkService) GetStayPointsInCluster(clusterID uint) ([]models.StayPoint, error) {
-	var cluster models.Cluster
-	if err := s.db.Preload("StayPoints").First(&cluster, clusterID).Error; err != nil {
+	return clusterStayPoints(s.db, clusterID)
+}
+
+func clusterStayPoints(db *gorm.DB, clusterID uint) ([]models.StayPoint, error) {
+	var stayPoints []models.StayPoint
+	if err := db.Joins("JOIN cluster_stay_points ON cluster_stay_points.stay_point_id = stay_points.id").
+		Where("cluster_stay_points.cluster_id = ?", clusterID).
+		Order("stay_points.id ASC").
+		Find(&stayPoints).Error; err != nil {
 		return nil, err
 	}
-	return cluster.StayPoints, nil
+	return stayPoints, nil
 }
 
-// UpdateClusterMetrics updates the metrics of a cluster
+// GetChildClusters returns the clusters of the previous layer that a cluster contains
+func (s *HierarchicalFrameworkService) GetChildClusters(clusterID uint) ([]models.Cluster, error) {
+	var clusters []models.Cluster
+	if err := s.db.Where("parent_id = ?", clusterID).Order("id ASC").Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+// UpdateClusterMetrics updates the metrics of a cluster from its stay points
 func (s *HierarchicalFrameworkService) UpdateClusterMetrics(clusterID uint) error {
 	var cluster models.Cluster
-	if err := s.db.Preload("StayPoints").First(&cluster, clusterID).Error; err != nil {
+	if err := s.db.First(&cluster, clusterID).Error; err != nil {
+		return err
+	}
+	stayPoints, err := s.GetStayPointsInCluster(clusterID)
+	if err != nil {
 		return err
 	}
 
 	// Calculate new center and radius
 	var sumLat, sumLng float64
 	var maxDistance float64
-	for _, sp := range cluster.StayPoints {
+	for _, sp := range stayPoints {
 		sumLat += sp.Latitude
 		sumLng += sp.Longitude
 	}
 
-	if len(cluster.StayPoints) > 0 {
-		centerLat := sumLat / float64(len(cluster.StayPoints))
-		centerLng := sumLng / float64(len(cluster.StayPoints))
+	if len(stayPoints) > 0 {
+		centerLat := sumLat / float64(len(stayPoints))
+		centerLng := sumLng / float64(len(stayPoints))
 
 		// Calculate maximum distance from center
-		for _, sp := range cluster.StayPoints {
+		for _, sp := range stayPoints {
 			distance := algorithms.Distance(centerLat, centerLng, sp.Latitude, sp.Longitude)
 			if distance > maxDistance {
 				maxDistance = distance
@@ -212,6 +310,11 @@ func (s *HierarchicalFrameworkService) GetUserGraph(userID, frameworkID uint) (*
 	return &graph, nil
 }
 
+// DeleteUserGraph deletes a user's hierarchical graph in a framework with its nodes and edges
+func (s *HierarchicalFrameworkService) DeleteUserGraph(userID, frameworkID uint) error {
+	return s.db.Where("user_id = ? AND framework_id = ?", userID, frameworkID).Delete(&models.HierarchicalGraph{}).Error
+}
+
 // GetCluster retrieves a cluster by ID
 func (s *HierarchicalFrameworkService) GetCluster(id uint) (*models.Cluster, error) {
 	var cluster models.Cluster
@@ -221,15 +324,99 @@ func (s *HierarchicalFrameworkService) GetCluster(id uint) (*models.Cluster, err
 	return &cluster, nil
 }
 
-// GetAllFrameworks retrieves all hierarchical frameworks
-func (s *HierarchicalFrameworkService) GetAllFrameworks() ([]models.HierarchicalFramework, error) {
+// GetActiveFramework retrieves the active framework without its layers
+func (s *HierarchicalFrameworkService) GetActiveFramework() (*models.HierarchicalFramework, error) {
+	var framework models.HierarchicalFramework
+	if err := s.db.Where("active").First(&framework).Error; err != nil {
+		return nil, err
+	}
+	return &framework, nil
+}
+
+// GetFrameworkVersion retrieves a framework by ID without its layers
+func (s *HierarchicalFrameworkService) GetFrameworkVersion(id uint) (*models.HierarchicalFramework, error) {
+	var framework models.HierarchicalFramework
+	if err := s.db.First(&framework, id).Error; err != nil {
+		return nil, err
+	}
+	return &framework, nil
+}
+
+// GetFrameworkVersions retrieves all frameworks without their layers, newest version first
+func (s *HierarchicalFrameworkService) GetFrameworkVersions() ([]models.HierarchicalFramework, error) {
 	var frameworks []models.HierarchicalFramework
-	if err := s.db.Preload("Layers.Clusters").Find(&frameworks).Error; err != nil {
+	if err := s.db.Order("version DESC").Find(&frameworks).Error; err != nil {
 		return nil, err
 	}
 	return frameworks, nil
 }
 
+// ActivateFramework makes a framework the one user graphs and recommendations use, and
+// creates the locations of its bottom layer clusters that do not have one yet
+func (s *HierarchicalFrameworkService) ActivateFramework(id uint) (*models.HierarchicalFramework, error) {
+	var framework models.HierarchicalFramework
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&framework, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.HierarchicalFramework{}).Where("active AND id <> ?", id).Update("active", false).Error; err != nil {
+			return err
+		}
+		framework.Active = true
+		if err := tx.Model(&framework).Update("active", true).Error; err != nil {
+			return err
+		}
+		return createClusterLocations(tx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &framework, nil
+}
+
+// createClusterLocations creates a location for every cluster of the bottom layer of a
+// framework that does not have one
+func createClusterLocations(tx *gorm.DB, frameworkID uint) error {
+	var clusters []models.Cluster
+	if err := tx.Joins("JOIN layers ON layers.id = clusters.layer_id").
+		Where("clusters.framework_id = ?", frameworkID).
+		Where("layers.level = (SELECT MIN(level) FROM layers WHERE framework_id = ?)", frameworkID).
+		Where("NOT EXISTS (SELECT 1 FROM locations WHERE locations.cluster_id = clusters.id)").
+		Order("clusters.id ASC").
+		Find(&clusters).Error; err != nil {
+		return err
+	}
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	locations := make([]models.Location, len(clusters))
+	for i, cluster := range clusters {
+		locations[i] = models.Location{
+			Latitude:   cluster.CenterLat,
+			Longitude:  cluster.CenterLng,
+			ClusterID:  cluster.ID,
+			VisitCount: cluster.VisitCount,
+		}
+	}
+	return tx.CreateInBatches(&locations, 1000).Error
+}
+
+// nextFrameworkVersion returns the version of the next framework stored. The table is
+// locked against concurrent inserts until the transaction ends, so that two frameworks
+// stored at once do not get the same version.
+func nextFrameworkVersion(tx *gorm.DB) (int, error) {
+	if err := tx.Exec("LOCK TABLE hierarchical_frameworks IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+		return 0, err
+	}
+
+	var version int
+	if err := tx.Model(&models.HierarchicalFramework{}).Select("COALESCE(MAX(version), 0) + 1").Scan(&version).Error; err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
 // UpdateNode updates a node in the graph
 func (s *HierarchicalFrameworkService) UpdateNode(node *models.GraphNode) error {
 	return s.db.Save(node).Error
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ImportRecordServices stores dataset files together with their import records so
+// that an interrupted load can resume at file granularity
+type ImportRecordServices struct {
+	DB *db.DB
+}
+
+func NewImportRecordServices(db *db.DB) *ImportRecordServices {
+	return &ImportRecordServices{DB: db}
+}
+
+// GetCompletedPaths returns the source paths of the user's files that were imported successfully
+func (s *ImportRecordServices) GetCompletedPaths(userID uint) (map[string]bool, error) {
+	var paths []string
+	if err := s.DB.Model(&models.ImportRecord{}).
+		Where("user_id = ? AND status = ?", userID, models.ImportCompleted).
+		Pluck("source_path", &paths).Error; err != nil {
+		return nil, err
+	}
+
+	completed := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		completed[path] = true
+	}
+	return completed, nil
+}
+
+// FileImport is a parsed dataset file ready to be stored
+type FileImport struct {
+	SourcePath string
+	Trajectory models.Trajectory
+	PointCount int
+	StayPoints []models.StayPoint
+}
+
+// ImportFiles stores the trajectories and stay points of a batch of files together with
+// completed import records in a single transaction, using COPY for the bulk of the rows.
+// If a trajectory with the same user and time range already exists, for instance from a
+// load that predates import records, it is adopted instead of being inserted twice.
+func (s *ImportRecordServices) ImportFiles(files []FileImport) ([]models.ImportRecord, error) {
+	records := make([]models.ImportRecord, len(files))
+
+	err := withPgxTx(s.DB, func(ctx context.Context, tx pgx.Tx) error {
+		existing, err := findExistingTrajectories(ctx, tx, files)
+		if err != nil {
+			return err
+		}
+
+		var trajectories []models.Trajectory
+		var stayPoints [][]models.StayPoint
+		var newFiles []int
+		for i, file := range files {
+			if _, ok := existing[i]; ok {
+				continue
+			}
+			trajectories = append(trajectories, file.Trajectory)
+			stayPoints = append(stayPoints, file.StayPoints)
+			newFiles = append(newFiles, i)
+		}
+
+		if err := copyTrajectoriesWithStayPoints(ctx, tx, trajectories, stayPoints); err != nil {
+			return err
+		}
+
+		for i, file := range files {
+			records[i] = models.ImportRecord{
+				UserID:     file.Trajectory.UserID,
+				SourcePath: file.SourcePath,
+				Status:     models.ImportCompleted,
+				PointCount: file.PointCount,
+			}
+			if id, ok := existing[i]; ok {
+				records[i].TrajectoryID = &id
+			}
+		}
+		for k, i := range newFiles {
+			files[i].Trajectory = trajectories[k]
+			files[i].StayPoints = stayPoints[k]
+			records[i].TrajectoryID = &trajectories[k].ID
+			records[i].StayPointCount = len(stayPoints[k])
+		}
+
+		return upsertImportRecords(ctx, tx, records)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// findExistingTrajectories maps the index of each file whose trajectory is already stored to its ID
+func findExistingTrajectories(ctx context.Context, tx pgx.Tx, files []FileImport) (map[int]uint, error) {
+	userIDs := make([]int64, len(files))
+	startTimes := make([]time.Time, len(files))
+	endTimes := make([]time.Time, len(files))
+	for i, file := range files {
+		userIDs[i] = int64(file.Trajectory.UserID)
+		startTimes[i] = file.Trajectory.StartTime
+		endTimes[i] = file.Trajectory.EndTime
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT ON (f.idx) f.idx, t.id
+		FROM unnest($1::bigint[], $2::timestamp[], $3::timestamp[]) WITH ORDINALITY AS f(user_id, start_time, end_time, idx)
+		JOIN trajectories t ON t.user_id = f.user_id AND t.start_time = f.start_time AND t.end_time = f.end_time
+		ORDER BY f.idx, t.id`,
+		userIDs, startTimes, endTimes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := make(map[int]uint)
+	for rows.Next() {
+		var idx, id int64
+		if err := rows.Scan(&idx, &id); err != nil {
+			return nil, err
+		}
+		existing[int(idx-1)] = uint(id)
+	}
+	return existing, rows.Err()
+}
+
+// upsertImportRecords inserts completed records or replaces the previous records of the same files
+func upsertImportRecords(ctx context.Context, tx pgx.Tx, records []models.ImportRecord) error {
+	userIDs := make([]int64, len(records))
+	paths := make([]string, len(records))
+	trajectoryIDs := make([]int64, len(records))
+	pointCounts := make([]int64, len(records))
+	stayPointCounts := make([]int64, len(records))
+	for i, record := range records {
+		userIDs[i] = int64(record.UserID)
+		paths[i] = record.SourcePath
+		trajectoryIDs[i] = int64(*record.TrajectoryID)
+		pointCounts[i] = int64(record.PointCount)
+		stayPointCounts[i] = int64(record.StayPointCount)
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO import_records (user_id, source_path, status, trajectory_id, point_count, stay_point_count, created_at, updated_at)
+		SELECT r.user_id, r.source_path, $6::text, r.trajectory_id, r.point_count, r.stay_point_count, now(), now()
+		FROM unnest($1::bigint[], $2::text[], $3::bigint[], $4::bigint[], $5::bigint[])
+			AS r(user_id, source_path, trajectory_id, point_count, stay_point_count)
+		ON CONFLICT (source_path) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			status = EXCLUDED.status,
+			trajectory_id = EXCLUDED.trajectory_id,
+			point_count = EXCLUDED.point_count,
+			stay_point_count = EXCLUDED.stay_point_count,
+			error = NULL,
+			updated_at = EXCLUDED.updated_at`,
+		userIDs, paths, trajectoryIDs, pointCounts, stayPointCounts, string(models.ImportCompleted))
+	return err
+}
+
+// RecordEmpty marks a file without usable points as imported so that it is not retried
+func (s *ImportRecordServices) RecordEmpty(userID uint, sourcePath string) error {
+	record := &models.ImportRecord{
+		UserID:     userID,
+		SourcePath: sourcePath,
+		Status:     models.ImportCompleted,
+	}
+	return saveImportRecord(s.DB.DB, record)
+}
+
+// RecordFailure marks a file as failed so that the next run retries it
+func (s *ImportRecordServices) RecordFailure(userID uint, sourcePath string, importErr error) error {
+	record := &models.ImportRecord{
+		UserID:     userID,
+		SourcePath: sourcePath,
+		Status:     models.ImportFailed,
+		Error:      importErr.Error(),
+	}
+	return saveImportRecord(s.DB.DB, record)
+}
+
+// saveImportRecord inserts a record or replaces the previous record of the same file
+func saveImportRecord(tx *gorm.DB, record *models.ImportRecord) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "source_path"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"user_id", "status", "trajectory_id", "point_count", "stay_point_count", "error", "updated_at",
+		}),
+	}).Create(record).Error
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/formats"
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// ImportServices stores parsed tracks as trajectories and detects their stay points and transportation modes
+type ImportServices struct {
+	trajectoryService *TrajectoryServices
+	stayPointService  *StayPointServices
+	locationService   *LocationServices
+	segmentService    *TrajectorySegmentServices
+}
+
+// ImportOptions controls how imported points are processed before they are stored
+type ImportOptions struct {
+	NoiseFilter algorithms.NoiseFilterParams
+	SplitTrips  bool // Store one trajectory per trip instead of one per track
+	Trips       algorithms.TripParams
+	// Skip trajectories whose user and time range are already stored, so that a file
+	// can be imported again without duplicating its trajectories
+	SkipExisting bool
+}
+
+// DefaultImportOptions applies the default noise filters
+func DefaultImportOptions() ImportOptions {
+	return ImportOptions{
+		NoiseFilter: algorithms.DefaultNoiseFilterParams(),
+		Trips:       algorithms.DefaultTripParams(),
+	}
+}
+
+// ImportResult reports the outcome of importing a single track. PointCount is the number
+// of points stored after noise filtering. When the track was split into several trips,
+// TrajectoryIDs lists all of their trajectories and TrajectoryID is the first.
+type ImportResult struct {
+	Track         string                        `json:"track"`
+	TrajectoryID  uint                          `json:"trajectory_id,omitempty"`
+	TrajectoryIDs []uint                        `json:"trajectory_ids,omitempty"`
+	PointCount    int                           `json:"point_count"`
+	StayPoints    int                           `json:"stay_points"`
+	Skipped       int                           `json:"skipped,omitempty"` // Trajectories already stored
+	NoiseFilter   *algorithms.NoiseFilterReport `json:"noise_filter,omitempty"`
+	Error         string                        `json:"error,omitempty"`
+}
+
+// TakeoutResult reports the outcome of a Google Takeout import
+type TakeoutResult struct {
+	Trajectories  []ImportResult `json:"trajectories"`
+	StayPoints    int            `json:"stay_points"`
+	Locations     int            `json:"locations"`
+	FailedVisits  int            `json:"failed_visits"`
+	SkippedVisits int            `json:"skipped_visits"`
+	VisitsWarning string         `json:"visits_warning,omitempty"`
+}
+
+func NewImportServices(
+	trajectoryService *TrajectoryServices,
+	stayPointService *StayPointServices,
+	locationService *LocationServices,
+	segmentService *TrajectorySegmentServices,
+) *ImportServices {
+	return &ImportServices{
+		trajectoryService: trajectoryService,
+		stayPointService:  stayPointService,
+		locationService:   locationService,
+		segmentService:    segmentService,
+	}
+}
+
+// ImportTracks creates one trajectory per valid track; failures are reported per track
+func (s *ImportServices) ImportTracks(userID uint, tracks []formats.Track, opts ImportOptions) []ImportResult {
+	return s.importTracks(userID, tracks, true, opts)
+}
+
+// ImportWaypoints stores the waypoints of a file as named locations of the user. A
+// waypoint near a location of the user with the same name is not stored again. It returns
+// the number of locations created.
+func (s *ImportServices) ImportWaypoints(userID uint, waypoints []formats.Waypoint) (int, error) {
+	created := 0
+	for i, waypoint := range waypoints {
+		name := waypoint.Name
+		if name == "" {
+			name = fmt.Sprintf("Waypoint %d", i+1)
+		}
+
+		_, isNew, err := s.locationService.FindOrCreateNamed(
+			userID, name, waypoint.Description, waypoint.Latitude, waypoint.Longitude, models.CategoryTravel,
+		)
+		if err != nil {
+			return created, err
+		}
+		if isNew {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// ImportTakeout imports a Google Takeout location history. Records are split into daily
+// trajectories. When the export has place visits they are stored as stay points instead
+// of running stay point detection, and named places become locations of the user.
+// Importing the same export again skips the trajectories and visits already stored.
+func (s *ImportServices) ImportTakeout(userID uint, data *formats.TakeoutData, opts ImportOptions) *TakeoutResult {
+	result := &TakeoutResult{}
+
+	opts.SkipExisting = true
+	detectStays := len(data.Visits) == 0
+	result.Trajectories = s.importTracks(userID, formats.SplitByDay(data.Points, "Takeout"), detectStays, opts)
+
+	var lastErr error
+	for _, visit := range data.Visits {
+		exists, err := s.stayPointService.ExistsForTimeRange(userID, visit.Start, visit.End)
+		if err != nil {
+			lastErr = err
+			result.FailedVisits++
+			continue
+		}
+		if exists {
+			result.SkippedVisits++
+			continue
+		}
+
+		stayPoint := models.StayPoint{
+			UserID:        userID,
+			Latitude:      visit.Latitude,
+			Longitude:     visit.Longitude,
+			ArrivalTime:   visit.Start,
+			DepartureTime: visit.End,
+		}
+
+		// Link the visit to the imported trajectory of that day when there is one
+		if trajectory, err := s.trajectoryService.GetByUserAndTime(userID, visit.Start); err == nil {
+			stayPoint.TrajectoryID = trajectory.ID
+		}
+
+		if visit.Name != "" {
+			location, created, err := s.locationService.FindOrCreateNamed(
+				userID, visit.Name, visit.Address, visit.Latitude, visit.Longitude, models.CategoryTravel,
+			)
+			if err != nil {
+				lastErr = err
+				result.FailedVisits++
+				continue
+			}
+			if created {
+				result.Locations++
+			}
+			stayPoint.LocationID = location.ID
+			if err := s.locationService.IncrementVisitCount(location.ID); err != nil {
+				lastErr = err
+			}
+		}
+
+		if _, err := s.stayPointService.Create(stayPoint); err != nil {
+			lastErr = err
+			result.FailedVisits++
+			continue
+		}
+		result.StayPoints++
+	}
+
+	if lastErr != nil {
+		result.VisitsWarning = lastErr.Error()
+	}
+
+	return result
+}
+
+// importTracks filters the noise of all valid tracks and stores them in one bulk insert,
+// optionally detecting stay points and splitting them into trips, then classifies their
+// transportation modes
+func (s *ImportServices) importTracks(userID uint, tracks []formats.Track, detectStays bool, opts ImportOptions) []ImportResult {
+	results := make([]ImportResult, len(tracks))
+
+	var stayParams *algorithms.StayPointParams
+	if detectStays {
+		params, err := s.stayPointService.ParamsForUser(userID)
+		if err != nil {
+			for i, track := range tracks {
+				results[i] = ImportResult{Track: track.Name, PointCount: len(track.Points), Error: err.Error()}
+			}
+			return results
+		}
+		stayParams = &params
+	}
+
+	var trajectories []models.Trajectory
+	var stayPoints [][]models.StayPoint
+	var stored []int
+	for i, track := range tracks {
+		results[i] = ImportResult{
+			Track:      track.Name,
+			PointCount: len(track.Points),
+		}
+
+		if track.Err != nil {
+			results[i].Error = track.Err.Error()
+			continue
+		}
+
+		points, report := algorithms.FilterNoise(track.Points, opts.NoiseFilter)
+		results[i].PointCount = len(points)
+		results[i].NoiseFilter = &report
+
+		trajectory, trajectoryStays, err := newImportTrajectory(userID, track.Name, points, stayParams)
+		if err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+
+		trips := []models.Trajectory{trajectory}
+		tripStays := [][]models.StayPoint{trajectoryStays}
+		if opts.SplitTrips {
+			trips, tripStays, err = splitImportTrajectory(trajectory, points, trajectoryStays, opts.Trips)
+			if err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+		}
+
+		for k := range trips {
+			if opts.SkipExisting {
+				exists, err := s.trajectoryService.ExistsForTimeRange(userID, trips[k].StartTime, trips[k].EndTime)
+				if err != nil {
+					results[i].Error = err.Error()
+					continue
+				}
+				if exists {
+					results[i].Skipped++
+					continue
+				}
+			}
+
+			trajectories = append(trajectories, trips[k])
+			stayPoints = append(stayPoints, tripStays[k])
+			stored = append(stored, i)
+		}
+	}
+
+	if len(trajectories) == 0 {
+		return results
+	}
+
+	if _, err := s.trajectoryService.BulkCreateWithStayPoints(trajectories, stayPoints); err != nil {
+		for _, i := range stored {
+			results[i].Error = err.Error()
+		}
+		return results
+	}
+
+	for k, i := range stored {
+		if results[i].TrajectoryID == 0 {
+			results[i].TrajectoryID = trajectories[k].ID
+		}
+		results[i].TrajectoryIDs = append(results[i].TrajectoryIDs, trajectories[k].ID)
+		results[i].StayPoints += len(stayPoints[k])
+		if _, err := s.segmentService.ClassifyTrajectory(trajectories[k]); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+
+	// A track stored as a single trajectory only reports trajectory_id
+	for _, i := range stored {
+		if len(results[i].TrajectoryIDs) == 1 {
+			results[i].TrajectoryIDs = nil
+		}
+	}
+	return results
+}
+
+// newImportTrajectory builds an unsaved trajectory from chronologically ordered points
+// together with its stay points, detected with stayParams unless they are nil
+func newImportTrajectory(userID uint, name string, points []models.GPSPoint, stayParams *algorithms.StayPointParams) (models.Trajectory, []models.StayPoint, error) {
+	if len(points) == 0 {
+		return models.Trajectory{}, nil, errors.New("track has no points")
+	}
+
+	pointsJSON, err := json.Marshal(points)
+	if err != nil {
+		return models.Trajectory{}, nil, err
+	}
+
+	trajectory := models.Trajectory{
+		UserID:    userID,
+		Name:      name,
+		Points:    pointsJSON,
+		StartTime: points[0].Timestamp,
+		EndTime:   points[len(points)-1].Timestamp,
+		Stats:     algorithms.TrajectoryStatistics(points),
+	}
+
+	if stayParams == nil {
+		return trajectory, nil, nil
+	}
+
+	return trajectory, algorithms.DetectStayPoints(trajectory, *stayParams), nil
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+)
+
+// MaxResamplePoints bounds the number of positions a single resampling may produce
+const MaxResamplePoints = 100000
+
+var (
+	ErrPositionUnknown  = errors.New("no position recorded near that time")
+	ErrTooManyResamples = errors.New("resampling interval too small for the trajectory duration")
+)
+
+// PositionAt returns where a trajectory was at time at, interpolated between the recorded
+// points around it. Times outside the trajectory or inside a gap longer than maxSpan return
+// ErrPositionUnknown; a maxSpan of 0 interpolates across any gap.
+func PositionAt(trajectory models.Trajectory, at time.Time, maxSpan time.Duration) (models.GPSPoint, error) {
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+		return models.GPSPoint{}, err
+	}
+
+	position, ok := algorithms.PositionAt(points, at, maxSpan)
+	if !ok {
+		return models.GPSPoint{}, ErrPositionUnknown
+	}
+	return position, nil
+}
+
+// ResampledPoints returns the positions of a trajectory at the multiples of interval,
+// skipping sample times inside gaps longer than maxSpan
+func ResampledPoints(trajectory models.Trajectory, interval, maxSpan time.Duration) ([]models.GPSPoint, error) {
+	if interval <= 0 {
+		return nil, errors.New("resampling interval must be positive")
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+		return nil, err
+	}
+	if len(points) == 0 {
+		return points, nil
+	}
+
+	duration := points[len(points)-1].Timestamp.Sub(points[0].Timestamp)
+	if int64(duration/interval) >= MaxResamplePoints {
+		return nil, ErrTooManyResamples
+	}
+
+	return algorithms.Resample(points, interval, maxSpan), nil
+}
@@ -2,7 +2,9 @@ package services
 
 import (
 	"errors"
+	"strings"
 
+	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/models"
 
 	"gorm.io/gorm"
@@ -33,13 +35,17 @@ func (r *LocationServices) GetByID(id uint) (*models.Location, error) {
 		}
 		return nil, result.Error
 	}
-	return &location, nil
+
+	locations := []models.Location{location}
+	if err := r.loadActivities(locations); err != nil {
+		return nil, err
+	}
+	return &locations[0], nil
 }
 
 func (r *LocationServices) Create(location models.Location) (uint, error) {
-	result := r.DB.Create(&location)
-	if result.Error != nil {
-		return 0, result.Error
+	if err := r.CreateLocation(&location); err != nil {
+		return 0, err
 	}
 	return location.ID, nil
 }
@@ -54,57 +60,165 @@ func (r *LocationServices) Delete(id uint) error {
 	return result.Error
 }
 
+// FindOrCreateNamed returns the user's location with the given name near the coordinates,
+// creating it when none exists. The boolean reports whether a location was created.
+func (r *LocationServices) FindOrCreateNamed(userID uint, name, description string, lat, lng float64, category models.LocationCategory) (*models.Location, bool, error) {
+	var candidates []models.Location
+	if err := r.DB.Where("user_id = ? AND name = ?", userID, name).Find(&candidates).Error; err != nil {
+		return nil, false, err
+	}
+
+	for i := range candidates {
+		// Distance is in kilometers; places within 100 m are considered the same
+		if algorithms.Distance(lat, lng, candidates[i].Latitude, candidates[i].Longitude) <= 0.1 {
+			return &candidates[i], false, nil
+		}
+	}
+
+	location := models.Location{
+		UserID:      userID,
+		Latitude:    lat,
+		Longitude:   lng,
+		Name:        name,
+		Description: description,
+		Category:    category,
+	}
+	if err := r.DB.Create(&location).Error; err != nil {
+		return nil, false, err
+	}
+	return &location, true, nil
+}
+
 func (r *LocationServices) IncrementVisitCount(id uint) error {
 	result := r.DB.Model(&models.Location{}).Where("id = ?", id).
 		UpdateColumn("visit_count", gorm.Expr("visit_count + ?", 1))
 	return result.Error
 }
 
-func (r *LocationServices) SearchByActivity(lat, lng float64, activity string, radiusKm float64) ([]models.Location, error) {
+// SearchByActivity returns the user's locations tagged with the activity within radiusKm of
+// a point, nearest first
+func (r *LocationServices) SearchByActivity(userID uint, lat, lng float64, activity string, radiusKm float64) ([]models.Location, error) {
 	var locations []models.Location
 	result := r.DB.Raw(`
-		SELECT * FROM locations 
-		WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
-		AND activities::text LIKE ?
-	`, lng, lat, radiusKm*1000, "%"+activity+"%").Scan(&locations)
+		SELECT l.* FROM locations l
+		WHERE l.user_id = ?
+		AND ST_DWithin(l.geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
+		AND EXISTS (
+			SELECT 1 FROM location_activities a
+			WHERE a.location_id = l.id AND a.activity = ?
+		)
+		ORDER BY ST_Distance(l.geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography)
+	`, userID, lng, lat, radiusKm*1000, normalizeActivity(activity), lng, lat).Scan(&locations)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return locations, nil
+	return locations, r.loadActivities(locations)
 }
 
-func (r *LocationServices) FindMostVisited(lat, lng float64, radiusKm float64, limit int) ([]models.Location, error) {
+// FindMostVisited returns the user's locations within radiusKm of a point with the highest visit count
+func (r *LocationServices) FindMostVisited(userID uint, lat, lng float64, radiusKm float64, limit int) ([]models.Location, error) {
 	var locations []models.Location
 
 	result := r.DB.Raw(`
-		SELECT * FROM locations 
-		WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
-		ORDER BY visit_count DESC
+		SELECT * FROM locations
+		WHERE user_id = ?
+		AND ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
+		ORDER BY visit_count DESC, id ASC
 		LIMIT ?
-	`, lng, lat, radiusKm*1000, limit).Scan(&locations)
+	`, userID, lng, lat, radiusKm*1000, limit).Scan(&locations)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return locations, nil
+	return locations, r.loadActivities(locations)
 }
 
-func (r *LocationServices) FindNearby(lat, lng float64, radiusKm float64) ([]models.Location, error) {
+// FindNearby returns the user's locations within radiusKm of a point, nearest first
+func (r *LocationServices) FindNearby(userID uint, lat, lng float64, radiusKm float64) ([]models.Location, error) {
 	var locations []models.Location
 
 	result := r.DB.Raw(`
-		SELECT * FROM locations 
-		WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
-	`, lng, lat, radiusKm*1000).Scan(&locations)
+		SELECT * FROM locations
+		WHERE user_id = ?
+		AND ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
+		ORDER BY ST_Distance(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography)
+	`, userID, lng, lat, radiusKm*1000, lng, lat).Scan(&locations)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return locations, nil
+	return locations, r.loadActivities(locations)
+}
+
+// SetActivities replaces the activities of a location and returns them as stored
+func (r *LocationServices) SetActivities(locationID uint, activities []string) ([]string, error) {
+	var stored []string
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		stored, err = replaceActivities(tx, locationID, activities)
+		return err
+	})
+	return stored, err
+}
+
+// replaceActivities stores the normalized, deduplicated activities of a location and returns them
+func replaceActivities(tx *gorm.DB, locationID uint, activities []string) ([]string, error) {
+	if err := tx.Where("location_id = ?", locationID).Delete(&models.LocationActivity{}).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []models.LocationActivity
+	var stored []string
+	seen := make(map[string]bool)
+	for _, activity := range activities {
+		activity = normalizeActivity(activity)
+		if activity == "" || seen[activity] {
+			continue
+		}
+		seen[activity] = true
+		rows = append(rows, models.LocationActivity{LocationID: locationID, Activity: activity})
+		stored = append(stored, activity)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return stored, tx.Create(&rows).Error
+}
+
+// loadActivities fills in the activities of the given locations with a single query
+func (r *LocationServices) loadActivities(locations []models.Location) error {
+	if len(locations) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(locations))
+	for i := range locations {
+		ids[i] = locations[i].ID
+	}
+
+	var rows []models.LocationActivity
+	if err := r.DB.Where("location_id IN ?", ids).Order("activity ASC").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	byLocation := make(map[uint][]string)
+	for _, row := range rows {
+		byLocation[row.LocationID] = append(byLocation[row.LocationID], row.Activity)
+	}
+	for i := range locations {
+		locations[i].Activities = byLocation[locations[i].ID]
+	}
+	return nil
+}
+
+// normalizeActivity makes activity matching case and whitespace insensitive
+func normalizeActivity(activity string) string {
+	return strings.ToLower(strings.TrimSpace(activity))
 }
 
 func (r *LocationServices) GetByUser(userID uint) ([]models.Location, error) {
@@ -135,9 +249,20 @@ func (s *LocationServices) GetLocationByID(id uint) (*models.Location, error) {
 	return &location, nil
 }
 
+// CreateLocation creates a location together with its activities
 func (s *LocationServices) CreateLocation(location *models.Location) error {
-	err := s.DB.Create(&location).Error
-	return err
+	if len(location.Activities) == 0 {
+		return s.DB.Create(location).Error
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(location).Error; err != nil {
+			return err
+		}
+		activities, err := replaceActivities(tx, location.ID, location.Activities)
+		location.Activities = activities
+		return err
+	})
 }
 
 func (s *LocationServices) UpdateLocation(location *models.Location) error {
@@ -161,7 +286,7 @@ func (s *LocationServices) GetByUserPaginated(userID uint, offset, limit int) ([
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return locations, nil
+	return locations, s.loadActivities(locations)
 }
 
 // GetUserLocationsCount returns the total number of locations for a user
@@ -181,5 +306,5 @@ func (s *LocationServices) GetLocationsPaginated(offset, limit int) ([]models.Lo
 	if result.Error != nil {
 		return nil, result.Error
 	}
-	return locations, nil
+	return locations, s.loadActivities(locations)
 }
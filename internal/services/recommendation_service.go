@@ -147,19 +147,21 @@ func (r *RecommendationService) FixLocations(locations []models.Location) ([]mod
 func (r *RecommendationService) GetNearByCluster(lat, lng, radiusKm float64) ([]models.Location, error) {
 	var clusters []models.Cluster
 
-	// Convert radius from kilometers to meters (since radius in Cluster is stored in meters)
+	// Convert radius from kilometers to meters, the unit of geography distances
 	radiusMeters := radiusKm * 1000
 
-	// Use PostGIS ST_DWithin function to find clusters within the specified radius
-	// The formula used is the Haversine formula for calculating distances on a sphere
+	// Use PostGIS ST_DWithin function to find clusters of the bottom layer of the active
+	// framework within the specified radius
 	query := `
-		SELECT * FROM clusters 
-		WHERE layer_id = 1 and ST_DWithin(
+		SELECT clusters.* FROM clusters
+		JOIN layers ON layers.id = clusters.layer_id AND layers.level = 1
+		JOIN hierarchical_frameworks ON hierarchical_frameworks.id = clusters.framework_id AND hierarchical_frameworks.active
+		WHERE ST_DWithin(
 			ST_MakePoint(center_lng, center_lat)::geography,
 			ST_MakePoint(?, ?)::geography,
 			?
 		)
-		ORDER BY visit_count DESC
+		ORDER BY clusters.visit_count DESC
 	`
 
 	err := r.db.Raw(query, lng, lat, radiusMeters).Scan(&clusters).Error
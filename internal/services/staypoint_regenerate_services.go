@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+// regenerateBatchSize is the number of trajectories whose stay points are replaced per transaction
+const regenerateBatchSize = 100
+
+// ErrNoRegenerateTarget is returned when neither users nor trajectories were selected
+var ErrNoRegenerateTarget = errors.New("select at least one user or trajectory")
+
+// RegenerateOptions selects the trajectories whose stay points are detected again
+type RegenerateOptions struct {
+	UserIDs       []uint                      // All trajectories of these users
+	TrajectoryIDs []uint                      // And these trajectories
+	Params        *algorithms.StayPointParams // Overrides the configured thresholds when set
+	Algorithm     string                      // Overrides the configured detector when set
+	DryRun        bool                        // Only report how the stay counts would change
+}
+
+// UserStayChange reports the stay point counts of one user before and after regeneration
+type UserStayChange struct {
+	UserID            uint    `json:"user_id"`
+	Algorithm         string  `json:"algorithm"`
+	DistanceThreshold float64 `json:"distance_threshold"` // Meters
+	TimeThreshold     int     `json:"time_threshold"`     // Seconds
+	Trajectories      int     `json:"trajectories"`
+	Before            int     `json:"before"`
+	After             int     `json:"after"`
+}
+
+// RegenerateReport summarizes a stay point regeneration
+type RegenerateReport struct {
+	DryRun       bool             `json:"dry_run"`
+	Trajectories int              `json:"trajectories"`
+	SkippedOpen  int              `json:"skipped_open"` // Live tracking sessions are left alone
+	Before       int              `json:"before"`
+	After        int              `json:"after"`
+	Users        []UserStayChange `json:"users"`
+}
+
+// Regenerate deletes the stay points detected on the selected trajectories and detects
+// them again, with each user's configured detector and thresholds unless opts overrides them. Stay points without a
+// trajectory, such as imported place visits, are kept. Each batch of trajectories is
+// replaced in its own transaction, so an interrupted run can simply be repeated. The new
+// stay points belong to no cluster until the hierarchical framework is rebuilt.
+func (r *StayPointServices) Regenerate(opts RegenerateOptions) (*RegenerateReport, error) {
+	if len(opts.UserIDs) == 0 && len(opts.TrajectoryIDs) == 0 {
+		return nil, ErrNoRegenerateTarget
+	}
+	if opts.Algorithm != "" && !algorithms.IsStayPointAlgorithm(opts.Algorithm) {
+		return nil, fmt.Errorf("unknown stay point algorithm %q", opts.Algorithm)
+	}
+
+	query := r.DB.Model(&models.Trajectory{}).Select("id", "user_id", "points", "is_open")
+	switch {
+	case len(opts.UserIDs) > 0 && len(opts.TrajectoryIDs) > 0:
+		query = query.Where("user_id IN ? OR id IN ?", opts.UserIDs, opts.TrajectoryIDs)
+	case len(opts.UserIDs) > 0:
+		query = query.Where("user_id IN ?", opts.UserIDs)
+	default:
+		query = query.Where("id IN ?", opts.TrajectoryIDs)
+	}
+
+	report := &RegenerateReport{DryRun: opts.DryRun}
+	users := make(map[uint]*UserStayChange)
+	params := make(map[uint]algorithms.StayPointParams)
+
+	var batch []models.Trajectory
+	result := query.Order("id ASC").FindInBatches(&batch, regenerateBatchSize, func(_ *gorm.DB, _ int) error {
+		var ids []uint
+		for _, trajectory := range batch {
+			if trajectory.IsOpen {
+				report.SkippedOpen++
+				continue
+			}
+			ids = append(ids, trajectory.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		before, err := r.countByTrajectory(ids)
+		if err != nil {
+			return err
+		}
+
+		var detected []models.StayPoint
+		for _, trajectory := range batch {
+			if trajectory.IsOpen {
+				continue
+			}
+
+			p, ok := params[trajectory.UserID]
+			if !ok {
+				p, err = r.regenerateParams(trajectory.UserID, opts)
+				if err != nil {
+					return err
+				}
+				params[trajectory.UserID] = p
+			}
+
+			stayPoints := algorithms.DetectStayPoints(trajectory, p)
+			detected = append(detected, stayPoints...)
+
+			change := users[trajectory.UserID]
+			if change == nil {
+				change = &UserStayChange{
+					UserID:            trajectory.UserID,
+					Algorithm:         p.Algorithm,
+					DistanceThreshold: p.DistanceThreshold,
+					TimeThreshold:     int(p.TimeThreshold.Seconds()),
+				}
+				users[trajectory.UserID] = change
+			}
+			change.Trajectories++
+			change.Before += before[trajectory.ID]
+			change.After += len(stayPoints)
+
+			report.Trajectories++
+			report.Before += before[trajectory.ID]
+			report.After += len(stayPoints)
+		}
+
+		if opts.DryRun {
+			return nil
+		}
+		return r.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("trajectory_id IN ?", ids).Delete(&models.StayPoint{}).Error; err != nil {
+				return err
+			}
+			if len(detected) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(&detected, 1000).Error
+		})
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	report.Users = make([]UserStayChange, 0, len(users))
+	for _, change := range users {
+		report.Users = append(report.Users, *change)
+	}
+	sort.Slice(report.Users, func(i, j int) bool {
+		return report.Users[i].UserID < report.Users[j].UserID
+	})
+
+	return report, nil
+}
+
+// regenerateParams returns the user's configured detector and thresholds with the
+// overrides of opts applied
+func (r *StayPointServices) regenerateParams(userID uint, opts RegenerateOptions) (algorithms.StayPointParams, error) {
+	params, err := r.ParamsForUser(userID)
+	if err != nil {
+		return params, err
+	}
+	if opts.Params != nil {
+		params.DistanceThreshold = opts.Params.DistanceThreshold
+		params.TimeThreshold = opts.Params.TimeThreshold
+	}
+	if opts.Algorithm != "" {
+		params.Algorithm = opts.Algorithm
+	}
+	return params, nil
+}
+
+// countByTrajectory counts the stay points stored for each trajectory
+func (r *StayPointServices) countByTrajectory(trajectoryIDs []uint) (map[uint]int, error) {
+	var rows []struct {
+		TrajectoryID uint
+		Count        int
+	}
+	err := r.DB.Model(&models.StayPoint{}).
+		Select("trajectory_id, COUNT(*) AS count").
+		Where("trajectory_id IN ?", trajectoryIDs).
+		Group("trajectory_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.TrajectoryID] = row.Count
+	}
+	return counts, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"math"
 	"sort"
 	"time"
 
@@ -42,15 +43,30 @@ func (r *StayPointServices) GetByID(id uint) (*models.StayPoint, error) {
 
 func (r *StayPointServices) GetByTrajectoryID(trajectoryID uint) ([]models.StayPoint, error) {
 	var staypoints []models.StayPoint
-	result := r.DB.Where("trajectory_id = ?", trajectoryID).Find(&staypoints)
+	result := r.DB.Where("trajectory_id = ?", trajectoryID).Order("arrival_time ASC").Find(&staypoints)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 	return staypoints, nil
 }
 
+// ExistsForTimeRange reports whether the user already has a stay point with exactly this time range
+func (r *StayPointServices) ExistsForTimeRange(userID uint, arrival, departure time.Time) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.StayPoint{}).
+		Where("user_id = ? AND arrival_time = ? AND departure_time = ?", userID, arrival, departure).
+		Count(&count).Error
+	return count > 0, err
+}
+
 func (r *StayPointServices) Create(staypoint models.StayPoint) (uint, error) {
-	result := r.DB.Create(&staypoint)
+	query := r.DB.DB
+	// Stay points without a trajectory (e.g. imported place visits) keep a NULL trajectory_id
+	if staypoint.TrajectoryID == 0 {
+		query = query.Omit("TrajectoryID")
+	}
+
+	result := query.Create(&staypoint)
 	if result.Error != nil {
 		return 0, result.Error
 	}
@@ -78,13 +94,25 @@ func (r *StayPointServices) BatchCreate(staypoints []models.StayPoint) error {
 	})
 }
 
-func (r *StayPointServices) FindNearby(lat, lng float64, radiusKm float64) ([]models.StayPoint, error) {
+// PopularPlace is a group of stay points close to each other, visited by one or more users
+type PopularPlace struct {
+	Latitude       float64   `json:"latitude"`
+	Longitude      float64   `json:"longitude"`
+	StayPointCount int       `json:"stay_point_count"`
+	UserCount      int       `json:"user_count"`
+	LastVisit      time.Time `json:"last_visit"`
+}
+
+// FindNearby returns the user's stay points within radiusKm of a point, nearest first
+func (r *StayPointServices) FindNearby(userID uint, lat, lng float64, radiusKm float64) ([]models.StayPoint, error) {
 	var staypoints []models.StayPoint
 
 	result := r.DB.Raw(`
-		SELECT * FROM staypoints 
-		WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
-	`, lng, lat, radiusKm*1000).Scan(&staypoints)
+		SELECT * FROM stay_points
+		WHERE user_id = ?
+		AND ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
+		ORDER BY ST_Distance(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography)
+	`, userID, lng, lat, radiusKm*1000, lng, lat).Scan(&staypoints)
 
 	if result.Error != nil {
 		return nil, result.Error
@@ -93,37 +121,44 @@ func (r *StayPointServices) FindNearby(lat, lng float64, radiusKm float64) ([]mo
 	return staypoints, nil
 }
 
-func (r *StayPointServices) FindPopular(limit int) ([]models.StayPoint, error) {
-	var staypoints []models.StayPoint
+// FindPopular clusters the stay points of all users within radiusKm of a point with DBSCAN
+// (100 m neighbourhood, at least two stay points) and returns the largest clusters. Only the
+// cluster centres and counts are returned, never another user's stay points.
+func (r *StayPointServices) FindPopular(lat, lng float64, radiusKm float64, limit int) ([]PopularPlace, error) {
+	var places []PopularPlace
+
+	// Clustering runs in Web Mercator, whose unit is a metre only at the equator
+	eps := 100 / math.Cos(lat*math.Pi/180)
 
 	result := r.DB.Raw(`
-		WITH clusters AS (
-			SELECT 
-				id,
-				ST_ClusterDBSCAN(geom, eps := 100, minpoints := 2) OVER () AS cluster_id
-			FROM staypoints
-		),
-		cluster_counts AS (
-			SELECT 
-				cluster_id, 
-				COUNT(*) as point_count
-			FROM clusters
-			WHERE cluster_id IS NOT NULL
-			GROUP BY cluster_id
-			ORDER BY point_count DESC
-			LIMIT ?
+		WITH nearby AS (
+			SELECT
+				user_id,
+				latitude,
+				longitude,
+				departure_time,
+				ST_ClusterDBSCAN(ST_Transform(geom::geometry, 3857), eps := ?, minpoints := 2) OVER () AS cluster
+			FROM stay_points
+			WHERE ST_DWithin(geom, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)
 		)
-		SELECT s.* FROM staypoints s
-		JOIN clusters c ON s.id = c.id
-		JOIN cluster_counts cc ON c.cluster_id = cc.cluster_id
+		SELECT
+			AVG(latitude) AS latitude,
+			AVG(longitude) AS longitude,
+			COUNT(*) AS stay_point_count,
+			COUNT(DISTINCT user_id) AS user_count,
+			MAX(departure_time) AS last_visit
+		FROM nearby
+		WHERE cluster IS NOT NULL
+		GROUP BY cluster
+		ORDER BY user_count DESC, stay_point_count DESC
 		LIMIT ?
-	`, limit, limit).Scan(&staypoints)
+	`, eps, lng, lat, radiusKm*1000, limit).Scan(&places)
 
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
-	return staypoints, nil
+	return places, nil
 }
 
 // GroupNearbyStayPoints groups stay points that are close to each other in both space and time
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+// ParamsForUser returns the stay point detection thresholds of a user: the user's settings,
+// else the global settings, else the built-in defaults
+func (r *StayPointServices) ParamsForUser(userID uint) (algorithms.StayPointParams, error) {
+	return stayPointParams(r.DB.DB, userID)
+}
+
+// GlobalParams returns the global stay point detection thresholds, or the built-in
+// defaults when none are stored
+func (r *StayPointServices) GlobalParams() (algorithms.StayPointParams, error) {
+	settings, err := r.GetSettings(nil)
+	if err != nil || settings == nil {
+		return algorithms.DefaultStayPointParams(), err
+	}
+	return settingsParams(*settings), nil
+}
+
+// GetSettings returns the stored thresholds of a user, or the global ones when userID is
+// nil. It returns nil when none are stored.
+func (r *StayPointServices) GetSettings(userID *uint) (*models.StayPointSettings, error) {
+	var settings models.StayPointSettings
+	err := settingsQuery(r.DB.DB, userID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// SaveSettings stores the thresholds of a user, or the global ones when userID is nil.
+// Stay points already stored keep the thresholds they were detected with until they are
+// regenerated.
+func (r *StayPointServices) SaveSettings(userID *uint, params algorithms.StayPointParams) (*models.StayPointSettings, error) {
+	if params.DistanceThreshold <= 0 || params.TimeThreshold < time.Second {
+		return nil, errors.New("distance threshold and time threshold must be positive")
+	}
+	if params.Algorithm == "" {
+		params.Algorithm = algorithms.StayAlgorithmSequential
+	}
+	if !algorithms.IsStayPointAlgorithm(params.Algorithm) {
+		return nil, fmt.Errorf("unknown stay point algorithm %q", params.Algorithm)
+	}
+
+	var settings models.StayPointSettings
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		err := settingsQuery(tx, userID).First(&settings).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		settings.UserID = userID
+		settings.Algorithm = params.Algorithm
+		settings.DistanceThreshold = params.DistanceThreshold
+		settings.TimeThreshold = int(params.TimeThreshold / time.Second)
+		return tx.Save(&settings).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// DeleteSettings removes the thresholds of a user, who falls back to the global ones, or
+// the global thresholds when userID is nil
+func (r *StayPointServices) DeleteSettings(userID *uint) error {
+	return settingsQuery(r.DB.DB, userID).Delete(&models.StayPointSettings{}).Error
+}
+
+// stayPointParams resolves the stay point detection thresholds of a user
+func stayPointParams(db *gorm.DB, userID uint) (algorithms.StayPointParams, error) {
+	var rows []models.StayPointSettings
+	err := db.Where("user_id = ? OR user_id IS NULL", userID).
+		Order("user_id IS NULL").Limit(1).Find(&rows).Error
+	if err != nil {
+		return algorithms.StayPointParams{}, err
+	}
+	if len(rows) == 0 {
+		return algorithms.DefaultStayPointParams(), nil
+	}
+	return settingsParams(rows[0]), nil
+}
+
+// settingsParams converts stored settings to detection parameters
+func settingsParams(settings models.StayPointSettings) algorithms.StayPointParams {
+	return algorithms.StayPointParams{
+		Algorithm:         settings.Algorithm,
+		DistanceThreshold: settings.DistanceThreshold,
+		TimeThreshold:     time.Duration(settings.TimeThreshold) * time.Second,
+	}
+}
+
+func settingsQuery(db *gorm.DB, userID *uint) *gorm.DB {
+	if userID == nil {
+		return db.Where("user_id IS NULL")
+	}
+	return db.Where("user_id = ?", *userID)
+}
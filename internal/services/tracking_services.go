@@ -0,0 +1,281 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTrajectoryNotFound = errors.New("trajectory not found")
+	ErrTrajectoryAccess   = errors.New("access denied to this trajectory")
+	ErrTrajectoryClosed   = errors.New("trajectory is not an open tracking session")
+)
+
+// TrackingServices manages live tracking sessions, i.e. open trajectories that grow over time
+type TrackingServices struct {
+	DB *db.DB
+}
+
+// AppendResult reports the effect of appending a batch of points to a session
+type AppendResult struct {
+	Trajectory    *models.Trajectory `json:"trajectory"`
+	Added         int                `json:"added"`
+	Duplicates    int                `json:"duplicates"`
+	TotalPoints   int                `json:"total_points"`
+	NewStayPoints []models.StayPoint `json:"new_stay_points"`
+}
+
+func NewTrackingServices(db *db.DB) *TrackingServices {
+	return &TrackingServices{DB: db}
+}
+
+// StartSession creates an empty open trajectory for the user
+func (s *TrackingServices) StartSession(userID uint, name string) (*models.Trajectory, error) {
+	now := time.Now()
+	trajectory := models.Trajectory{
+		UserID:    userID,
+		Name:      name,
+		Points:    []byte("[]"),
+		StartTime: now,
+		EndTime:   now,
+		IsOpen:    true,
+	}
+
+	if err := s.DB.Create(&trajectory).Error; err != nil {
+		return nil, err
+	}
+	return &trajectory, nil
+}
+
+// DailyTrajectory returns the open trajectory collecting a device's points for the given UTC day.
+// It is created on the first point of the day, and the device's trajectories of earlier days are closed.
+// The day is unique per device, so concurrent posts of the first points share one trajectory.
+func (s *TrackingServices) DailyTrajectory(userID, deviceID uint, deviceName string, at time.Time) (*models.Trajectory, error) {
+	at = at.UTC()
+	dayStart := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+
+	var trajectory models.Trajectory
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		trajectory = models.Trajectory{
+			UserID:    userID,
+			Name:      deviceName + " " + dayStart.Format("2006-01-02"),
+			Points:    []byte("[]"),
+			StartTime: at,
+			EndTime:   at,
+			IsOpen:    true,
+			DeviceID:  &deviceID,
+			DeviceDay: &dayStart,
+		}
+		created := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "device_id"}, {Name: "device_day"}},
+			DoNothing: true,
+		}).Create(&trajectory)
+		if created.Error != nil {
+			return created.Error
+		}
+		if created.RowsAffected == 1 {
+			return tx.Model(&models.Trajectory{}).
+				Where("device_id = ? AND is_open AND start_time < ?", deviceID, dayStart).
+				Update("is_open", false).Error
+		}
+
+		// The day already has a trajectory
+		trajectory = models.Trajectory{}
+		if err := tx.Where("device_id = ? AND device_day = ?", deviceID, dayStart).First(&trajectory).Error; err != nil {
+			return err
+		}
+
+		// Late points may arrive for a day that was already rolled over
+		if !trajectory.IsOpen {
+			trajectory.IsOpen = true
+			return tx.Save(&trajectory).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &trajectory, nil
+}
+
+// AppendPoints merges a batch of points into an open trajectory and detects new stay points on its tail
+func (s *TrackingServices) AppendPoints(userID, trajectoryID uint, points []models.GPSPoint) (*AppendResult, error) {
+	result := &AppendResult{NewStayPoints: []models.StayPoint{}}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		trajectory, existing, err := lockOpenTrajectory(tx, userID, trajectoryID)
+		if err != nil {
+			return err
+		}
+
+		merged, added := mergeGPSPoints(existing, points)
+		result.Added = added
+		result.Duplicates = len(points) - added
+		result.TotalPoints = len(merged)
+
+		if added > 0 {
+			pointsJSON, err := json.Marshal(merged)
+			if err != nil {
+				return err
+			}
+			trajectory.Points = pointsJSON
+			trajectory.StartTime = merged[0].Timestamp
+			trajectory.EndTime = merged[len(merged)-1].Timestamp
+			trajectory.Stats = algorithms.TrajectoryStatistics(merged)
+
+			if err := tx.Save(trajectory).Error; err != nil {
+				return err
+			}
+
+			result.NewStayPoints, err = detectTailStayPoints(tx, *trajectory, merged)
+			if err != nil {
+				return err
+			}
+		}
+
+		result.Trajectory = trajectory
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// CloseSession marks an open trajectory as finished
+func (s *TrackingServices) CloseSession(userID, trajectoryID uint) (*models.Trajectory, error) {
+	var trajectory *models.Trajectory
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		trajectory, _, err = lockOpenTrajectory(tx, userID, trajectoryID)
+		if err != nil {
+			return err
+		}
+
+		trajectory.IsOpen = false
+		return tx.Save(trajectory).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trajectory, nil
+}
+
+// lockOpenTrajectory loads an open trajectory owned by the user and locks its row for the transaction
+func lockOpenTrajectory(tx *gorm.DB, userID, trajectoryID uint) (*models.Trajectory, []models.GPSPoint, error) {
+	var trajectory models.Trajectory
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&trajectory, trajectoryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrTrajectoryNotFound
+		}
+		return nil, nil, err
+	}
+
+	if trajectory.UserID != userID {
+		return nil, nil, ErrTrajectoryAccess
+	}
+	if !trajectory.IsOpen {
+		return nil, nil, ErrTrajectoryClosed
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+		return nil, nil, err
+	}
+
+	return &trajectory, points, nil
+}
+
+// detectTailStayPoints runs stay point detection on the points recorded since the last known stay.
+// The sequential detector restarts right after each stay, so it only needs the points after it.
+// The other detectors may still grow the last stay with new points, so they see it again and it
+// is replaced when its detection changed.
+func detectTailStayPoints(tx *gorm.DB, trajectory models.Trajectory, points []models.GPSPoint) ([]models.StayPoint, error) {
+	params, err := stayPointParams(tx, trajectory.UserID)
+	if err != nil {
+		return nil, err
+	}
+	sequential := params.Algorithm == "" || params.Algorithm == algorithms.StayAlgorithmSequential
+
+	tail := points
+	var lastStay models.StayPoint
+	err = tx.Where("trajectory_id = ?", trajectory.ID).Order("departure_time DESC").First(&lastStay).Error
+	if err == nil {
+		start := sort.Search(len(points), func(i int) bool {
+			if sequential {
+				return points[i].Timestamp.After(lastStay.DepartureTime)
+			}
+			return !points[i].Timestamp.Before(lastStay.ArrivalTime)
+		})
+		tail = points[start:]
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
+		sequential = true // Nothing to detect again
+	} else {
+		return nil, err
+	}
+
+	tailJSON, err := json.Marshal(tail)
+	if err != nil {
+		return nil, err
+	}
+	trajectory.Points = tailJSON
+
+	stayPoints := algorithms.DetectStayPoints(trajectory, params)
+	if !sequential {
+		if len(stayPoints) > 0 && stayPoints[0].ArrivalTime.Equal(lastStay.ArrivalTime) &&
+			stayPoints[0].DepartureTime.Equal(lastStay.DepartureTime) {
+			stayPoints = stayPoints[1:]
+		} else if err := tx.Delete(&lastStay).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(stayPoints) == 0 {
+		return []models.StayPoint{}, nil
+	}
+
+	if err := tx.Create(&stayPoints).Error; err != nil {
+		return nil, err
+	}
+	return stayPoints, nil
+}
+
+// mergeGPSPoints merges incoming points into a chronologically ordered slice,
+// dropping points whose timestamp is already present. It returns the merged
+// slice and the number of points actually added.
+func mergeGPSPoints(existing, incoming []models.GPSPoint) ([]models.GPSPoint, int) {
+	seen := make(map[int64]bool, len(existing)+len(incoming))
+	merged := make([]models.GPSPoint, 0, len(existing)+len(incoming))
+	for _, p := range existing {
+		seen[p.Timestamp.UnixNano()] = true
+		merged = append(merged, p)
+	}
+
+	added := 0
+	for _, p := range incoming {
+		key := p.Timestamp.UnixNano()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, p)
+		added++
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Timestamp.Before(merged[j].Timestamp)
+	})
+
+	return merged, added
+}
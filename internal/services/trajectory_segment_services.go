@@ -0,0 +1,185 @@
+package services
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/db"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+type TrajectorySegmentServices struct {
+	DB *db.DB
+}
+
+// ModeLabel is a labelled time range, e.g. a line of a GeoLife labels.txt file
+type ModeLabel struct {
+	StartTime time.Time
+	EndTime   time.Time
+	Mode      models.TransportMode
+}
+
+func NewTrajectorySegmentServices(db *db.DB) *TrajectorySegmentServices {
+	return &TrajectorySegmentServices{DB: db}
+}
+
+// GetByTrajectoryID retrieves the segments of a trajectory in chronological order
+func (s *TrajectorySegmentServices) GetByTrajectoryID(trajectoryID uint) ([]models.TrajectorySegment, error) {
+	var segments []models.TrajectorySegment
+	err := s.DB.Where("trajectory_id = ?", trajectoryID).Order("start_time ASC").Find(&segments).Error
+	return segments, err
+}
+
+// HasSegments reports whether a user already has segments from the given source
+func (s *TrajectorySegmentServices) HasSegments(userID uint, source models.SegmentSource) (bool, error) {
+	var count int64
+	err := s.DB.Model(&models.TrajectorySegment{}).
+		Where("user_id = ? AND source = ?", userID, source).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ImportLabels links labelled time ranges to the user's trajectories. A label spanning
+// several trajectories yields one segment per trajectory, clipped to its time range.
+// It returns the number of segments created and the number of labels matching no trajectory.
+func (s *TrajectorySegmentServices) ImportLabels(userID uint, labels []ModeLabel) (int, int, error) {
+	// Only the time ranges are needed, so the points column is not loaded
+	var trajectories []models.Trajectory
+	if err := s.DB.Select("id", "start_time", "end_time").
+		Where("user_id = ?", userID).
+		Order("start_time ASC").
+		Find(&trajectories).Error; err != nil {
+		return 0, 0, err
+	}
+
+	var segments []models.TrajectorySegment
+	unmatched := 0
+	for _, label := range labels {
+		matched := false
+		for _, trajectory := range trajectories {
+			if trajectory.StartTime.After(label.EndTime) {
+				break
+			}
+			if trajectory.EndTime.Before(label.StartTime) {
+				continue
+			}
+
+			start, end := label.StartTime, label.EndTime
+			if trajectory.StartTime.After(start) {
+				start = trajectory.StartTime
+			}
+			if trajectory.EndTime.Before(end) {
+				end = trajectory.EndTime
+			}
+
+			segments = append(segments, models.TrajectorySegment{
+				TrajectoryID: trajectory.ID,
+				UserID:       userID,
+				Mode:         label.Mode,
+				Source:       models.SourceLabel,
+				StartTime:    start,
+				EndTime:      end,
+			})
+			matched = true
+		}
+
+		if !matched {
+			unmatched++
+		}
+	}
+
+	if len(segments) == 0 {
+		return 0, unmatched, nil
+	}
+
+	trajectoryIDs := make([]uint, 0, len(segments))
+	for _, segment := range segments {
+		trajectoryIDs = append(trajectoryIDs, segment.TrajectoryID)
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		// Ground truth replaces any inferred modes of the labelled trajectories
+		if err := tx.Where("trajectory_id IN ? AND source = ?", trajectoryIDs, models.SourceClassifier).
+			Delete(&models.TrajectorySegment{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(&segments, 500).Error
+	})
+	if err != nil {
+		return 0, unmatched, err
+	}
+
+	return len(segments), unmatched, nil
+}
+
+// GetLabelledUserIDs returns the users that have ground-truth label segments
+func (s *TrajectorySegmentServices) GetLabelledUserIDs() ([]uint, error) {
+	var userIDs []uint
+	err := s.DB.Model(&models.TrajectorySegment{}).
+		Where("source = ?", models.SourceLabel).
+		Distinct().
+		Order("user_id ASC").
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// GetByUserID retrieves the segments of a user from the given source in chronological order
+func (s *TrajectorySegmentServices) GetByUserID(userID uint, source models.SegmentSource) ([]models.TrajectorySegment, error) {
+	var segments []models.TrajectorySegment
+	err := s.DB.Where("user_id = ? AND source = ?", userID, source).
+		Order("trajectory_id ASC, start_time ASC").
+		Find(&segments).Error
+	return segments, err
+}
+
+// ClassifyTrajectory infers the transportation modes of a trajectory and replaces its
+// previously inferred segments. Trajectories with ground-truth labels are left untouched
+// and their label segments are returned instead.
+func (s *TrajectorySegmentServices) ClassifyTrajectory(trajectory models.Trajectory) ([]models.TrajectorySegment, error) {
+	var labelCount int64
+	if err := s.DB.Model(&models.TrajectorySegment{}).
+		Where("trajectory_id = ? AND source = ?", trajectory.ID, models.SourceLabel).
+		Count(&labelCount).Error; err != nil {
+		return nil, err
+	}
+	if labelCount > 0 {
+		return s.GetByTrajectoryID(trajectory.ID)
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+		return nil, err
+	}
+
+	modeSegments := algorithms.ClassifyTransportModes(points, algorithms.DefaultModeClassifierParams())
+
+	segments := make([]models.TrajectorySegment, 0, len(modeSegments))
+	for _, modeSegment := range modeSegments {
+		segments = append(segments, models.TrajectorySegment{
+			TrajectoryID: trajectory.ID,
+			UserID:       trajectory.UserID,
+			Mode:         modeSegment.Mode,
+			Source:       models.SourceClassifier,
+			StartTime:    modeSegment.StartTime,
+			EndTime:      modeSegment.EndTime,
+		})
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("trajectory_id = ? AND source = ?", trajectory.ID, models.SourceClassifier).
+			Delete(&models.TrajectorySegment{}).Error; err != nil {
+			return err
+		}
+		if len(segments) == 0 {
+			return nil
+		}
+		return tx.Create(&segments).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
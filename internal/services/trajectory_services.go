@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/th1enq/go-map/internal/algorithms"
 	"github.com/th1enq/go-map/internal/db"
 	"github.com/th1enq/go-map/internal/models"
 	"gorm.io/gorm"
@@ -53,7 +56,76 @@ func (r *TrajectoryServices) GetByID(id uint) (*models.Trajectory, error) {
 	return &trajectory, nil
 }
 
+// GetByUserAndTime returns the user's most recent trajectory whose time range covers t
+func (r *TrajectoryServices) GetByUserAndTime(userID uint, t time.Time) (*models.Trajectory, error) {
+	var trajectory models.Trajectory
+	result := r.DB.Where("user_id = ? AND start_time <= ? AND end_time >= ?", userID, t, t).
+		Order("id DESC").First(&trajectory)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("trajectory not found")
+		}
+		return nil, result.Error
+	}
+	return &trajectory, nil
+}
+
+// ExistsForTimeRange reports whether the user already has a trajectory with exactly this time range
+func (r *TrajectoryServices) ExistsForTimeRange(userID uint, start, end time.Time) (bool, error) {
+	var count int64
+	err := r.DB.Model(&models.Trajectory{}).
+		Where("user_id = ? AND start_time = ? AND end_time = ?", userID, start, end).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// trajectoryStatsColumns are the columns of models.TrajectoryStats
+var trajectoryStatsColumns = []string{
+	"stat_point_count", "stat_length", "stat_moving_time", "stat_stopped_time", "stat_avg_speed",
+	"stat_avg_moving_speed", "stat_max_speed", "stat_elevation_gain", "stat_elevation_loss",
+	"stat_min_latitude", "stat_min_longitude", "stat_max_latitude", "stat_max_longitude",
+}
+
+// trajectorySummaryColumns are the columns of a trajectory except its points
+var trajectorySummaryColumns = append([]string{
+	"id", "user_id", "name", "start_time", "end_time", "is_open", "device_id", "parent_id", "created_at", "updated_at",
+}, trajectoryStatsColumns...)
+
+// FindInBBox returns the user's trajectories whose geometry crosses the bounding box, newest
+// first and without their points. When from or to is set, only the part of a trajectory
+// recorded within that time range is tested, using the M (epoch) coordinate of geom.
+func (r *TrajectoryServices) FindInBBox(userID uint, minLng, minLat, maxLng, maxLat float64, from, to *time.Time) ([]models.Trajectory, error) {
+	query := r.DB.Select(trajectorySummaryColumns).
+		Where("user_id = ?", userID).
+		Where("geom && ST_MakeEnvelope(?, ?, ?, ?, 4326)", minLng, minLat, maxLng, maxLat)
+
+	if from == nil && to == nil {
+		query = query.Where("ST_Intersects(geom, ST_MakeEnvelope(?, ?, ?, ?, 4326))", minLng, minLat, maxLng, maxLat)
+	} else {
+		// Unbounded ends of the range fall back to epochs far outside any recording
+		fromEpoch, toEpoch := -1e11, 1e11
+		if from != nil {
+			query = query.Where("end_time >= ?", *from)
+			fromEpoch = float64(from.Unix())
+		}
+		if to != nil {
+			query = query.Where("start_time <= ?", *to)
+			toEpoch = float64(to.Unix())
+		}
+		query = query.Where("ST_Intersects(ST_LocateBetween(geom, ?, ?), ST_MakeEnvelope(?, ?, ?, ?, 4326))",
+			fromEpoch, toEpoch, minLng, minLat, maxLng, maxLat)
+	}
+
+	var trajectories []models.Trajectory
+	err := query.Order("start_time DESC").Find(&trajectories).Error
+	return trajectories, err
+}
+
+// Create stores a trajectory; its geom column is derived from the points by a database trigger
 func (r *TrajectoryServices) Create(trajectory models.Trajectory) (uint, error) {
+	if err := setTrajectoryStats(&trajectory); err != nil {
+		return 0, err
+	}
 	result := r.DB.Create(&trajectory)
 	if result.Error != nil {
 		return 0, result.Error
@@ -62,6 +134,9 @@ func (r *TrajectoryServices) Create(trajectory models.Trajectory) (uint, error)
 }
 
 func (r *TrajectoryServices) Update(trajectory models.Trajectory) error {
+	if err := setTrajectoryStats(&trajectory); err != nil {
+		return err
+	}
 	result := r.DB.Save(&trajectory)
 	return result.Error
 }
@@ -99,6 +174,9 @@ func (r *TrajectoryServices) Count() (int64, error) {
 func (r *TrajectoryServices) BatchCreate(trajectories []models.Trajectory) error {
 	return r.DB.Transaction(func(tx *gorm.DB) error {
 		for i := range trajectories {
+			if err := setTrajectoryStats(&trajectories[i]); err != nil {
+				return err
+			}
 			if err := tx.Create(&trajectories[i]).Error; err != nil {
 				return err
 			}
@@ -107,6 +185,59 @@ func (r *TrajectoryServices) BatchCreate(trajectories []models.Trajectory) error
 	})
 }
 
+// BulkCreateWithStayPoints inserts trajectories and the stay points detected on each of
+// them (stayPoints[i] belongs to trajectories[i]) in one transaction and returns the
+// trajectory IDs in order. The stay points are linked to their new trajectories.
+func (r *TrajectoryServices) BulkCreateWithStayPoints(trajectories []models.Trajectory, stayPoints [][]models.StayPoint) ([]uint, error) {
+	err := withPgxTx(r.DB, func(ctx context.Context, tx pgx.Tx) error {
+		return copyTrajectoriesWithStayPoints(ctx, tx, trajectories, stayPoints)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trajectoryIDs(trajectories), nil
+}
+
+// setTrajectoryStats recomputes the stats of a trajectory from its points
+func setTrajectoryStats(trajectory *models.Trajectory) error {
+	var points []models.GPSPoint
+	if len(trajectory.Points) > 0 {
+		if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+			return err
+		}
+	}
+	trajectory.Stats = algorithms.TrajectoryStatistics(points)
+	return nil
+}
+
+// RecomputeStats recomputes the stats of all trajectories in batches, e.g. for trajectories
+// stored before stats existed, and returns the number of trajectories updated
+func (s *TrajectoryServices) RecomputeStats(batchSize int) (int, error) {
+	updated := 0
+	var batch []models.Trajectory
+	result := s.DB.Select("id", "points").Order("id ASC").FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := setTrajectoryStats(&batch[i]); err != nil {
+				return err
+			}
+			if err := s.DB.Model(&batch[i]).Select(trajectoryStatsColumns).UpdateColumns(&batch[i]).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	return updated, result.Error
+}
+
+func trajectoryIDs(trajectories []models.Trajectory) []uint {
+	ids := make([]uint, len(trajectories))
+	for i, trajectory := range trajectories {
+		ids[i] = trajectory.ID
+	}
+	return ids
+}
+
 // Các hàm bổ sung cho admin
 func (s *TrajectoryServices) GetAllTrajectories() ([]models.Trajectory, error) {
 	var trajectories []models.Trajectory
@@ -117,14 +248,14 @@ func (s *TrajectoryServices) GetAllTrajectories() ([]models.Trajectory, error) {
 	return trajectories, nil
 }
 
-func (s *TrajectoryServices) GetTrajectoryPoints(trajectoryID uint) ([]map[string]interface{}, error) {
+func (s *TrajectoryServices) GetTrajectoryPoints(trajectoryID uint, simplify SimplifyOptions) ([]map[string]interface{}, error) {
 	var trajectory models.Trajectory
 	if err := s.DB.First(&trajectory, trajectoryID).Error; err != nil {
 		return nil, err
 	}
 
-	var pointsArray []models.GPSPoint
-	if err := json.Unmarshal([]byte(trajectory.Points), &pointsArray); err != nil {
+	pointsArray, err := SimplifiedPoints(trajectory, simplify)
+	if err != nil {
 		return nil, err
 	}
 
@@ -153,6 +284,79 @@ func (s *TrajectoryServices) GetTrajectoryPointsCount(trajectoryID uint) (int, e
 	return count, err
 }
 
+// SimplifyStored selects the simplified copy stored with StoreSimplified
+const SimplifyStored = "stored"
+
+// SimplifyOptions selects how trajectory points are reduced before they are returned.
+// An empty Method keeps every point.
+type SimplifyOptions struct {
+	Method    string // algorithms.SimplifyDouglasPeucker, algorithms.SimplifyVisvalingam or SimplifyStored
+	Tolerance float64
+}
+
+// SimplifiedPoints returns the points of a trajectory reduced as selected by opts. The
+// stored copy falls back to the raw points when none has been stored.
+func SimplifiedPoints(trajectory models.Trajectory, opts SimplifyOptions) ([]models.GPSPoint, error) {
+	source := trajectory.Points
+	if opts.Method == SimplifyStored && len(trajectory.SimplifiedPoints) > 0 {
+		source = trajectory.SimplifiedPoints
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(source), &points); err != nil {
+		return nil, err
+	}
+
+	if opts.Method == "" || opts.Method == SimplifyStored {
+		return points, nil
+	}
+	return algorithms.Simplify(points, opts.Method, opts.Tolerance)
+}
+
+// StoreSimplified stores a simplified copy of a trajectory's points for display. The raw
+// points are kept for analytics; the copy is dropped when they change.
+func (s *TrajectoryServices) StoreSimplified(trajectoryID uint, method string, tolerance float64) (*models.Trajectory, error) {
+	trajectory, err := s.GetByID(trajectoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := SimplifiedPoints(*trajectory, SimplifyOptions{Method: method, Tolerance: tolerance})
+	if err != nil {
+		return nil, err
+	}
+
+	pointsJSON, err := json.Marshal(points)
+	if err != nil {
+		return nil, err
+	}
+
+	trajectory.SimplifiedPoints = pointsJSON
+	trajectory.SimplifyMethod = method
+	trajectory.SimplifyTolerance = tolerance
+
+	// Points are not written, so the trigger keeps the new copy
+	err = s.DB.Model(trajectory).UpdateColumns(map[string]any{
+		"simplified_points":  trajectory.SimplifiedPoints,
+		"simplify_method":    method,
+		"simplify_tolerance": tolerance,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return trajectory, nil
+}
+
+// ClearSimplified removes the stored simplified copy of a trajectory
+func (s *TrajectoryServices) ClearSimplified(trajectoryID uint) error {
+	return s.DB.Model(&models.Trajectory{}).Where("id = ?", trajectoryID).UpdateColumns(map[string]any{
+		"simplified_points":  nil,
+		"simplify_method":    "",
+		"simplify_tolerance": 0,
+	}).Error
+}
+
 func (s *TrajectoryServices) CreateTrajectory(userID uint, startTime, endTime string, points []map[string]any) (*models.Trajectory, error) {
 	// Convert points to GPSPoint array
 	gpsPoints := make([]models.GPSPoint, len(points))
@@ -212,9 +416,10 @@ func (s *TrajectoryServices) CreateTrajectory(userID uint, startTime, endTime st
 		StartTime: parsedStartTime,
 		EndTime:   parsedEndTime,
 		Points:    pointsJSON,
+		Stats:     algorithms.TrajectoryStatistics(gpsPoints),
 	}
 
-	// Save trajectory
+	// Save trajectory; geom is built from the points by the database trigger
 	if err := s.DB.Create(&trajectory).Error; err != nil {
 		return nil, err
 	}
@@ -276,7 +481,13 @@ func (s *TrajectoryServices) UpdateTrajectory(trajectory *models.Trajectory, poi
 		trajectory.Points = pointsJSON
 	}
 
-	// Save trajectory
+	// Stats follow the points, also when they were changed by the caller
+	if err := setTrajectoryStats(trajectory); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Save trajectory; writing points makes the database trigger rebuild geom
 	if err := tx.Save(trajectory).Error; err != nil {
 		tx.Rollback()
 		return err
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxSimilarityCandidates bounds the trajectories compared by one similarity search
+	MaxSimilarityCandidates = 500
+	// similarityMaxPoints bounds the points of each trajectory fed to the quadratic measures
+	similarityMaxPoints = 200
+	// similarityMinMargin is the least slack in meters around the query bounding box
+	similarityMinMargin = 500.0
+)
+
+// SimilarityQuery selects how a similarity search ranks trajectories
+type SimilarityQuery struct {
+	Measure string // One of the algorithms.Similarity* measures
+	K       int
+	LCSS    algorithms.LCSSParams
+}
+
+// SimilarTrajectory is a search result; Distance is in meters, or between 0 and 1 for LCSS
+type SimilarTrajectory struct {
+	TrajectoryID uint                   `json:"trajectory_id"`
+	Name         string                 `json:"name"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	Stats        models.TrajectoryStats `json:"stats"`
+	Distance     float64                `json:"distance"`
+}
+
+// FindSimilar returns the user's K trajectories most similar to the given points, most
+// similar first, skipping excludeID. Candidates are prefiltered on the geom index: for
+// LCSS, which also matches partial overlaps, they must cross the query's bounding box;
+// for the other measures both bounding boxes must contain each other up to a margin of
+// 10% of the query's extent, at least 500 m. At most MaxSimilarityCandidates are compared,
+// those whose bounding box is closest to the query's (by Hausdorff distance) first.
+func (s *TrajectoryServices) FindSimilar(userID uint, points []models.GPSPoint, excludeID uint, query SimilarityQuery) ([]SimilarTrajectory, error) {
+	if !algorithms.IsSimilarityMeasure(query.Measure) {
+		return nil, fmt.Errorf("unknown similarity measure %q", query.Measure)
+	}
+	if len(points) == 0 {
+		return nil, fmt.Errorf("cannot compare an empty trajectory")
+	}
+
+	bounds := algorithms.TrajectoryStatistics(points)
+	margin := similarityMinMargin
+	if query.Measure == algorithms.SimilarityLCSS {
+		margin = math.Max(margin, query.LCSS.Epsilon)
+	} else {
+		diagonal := algorithms.Distance(bounds.MinLatitude, bounds.MinLongitude, bounds.MaxLatitude, bounds.MaxLongitude) * 1000
+		margin = math.Max(margin, diagonal/10)
+	}
+	// Meters to degrees at the query's latitude
+	dLat := margin / 111320
+	dLng := dLat / math.Max(math.Cos((bounds.MinLatitude+bounds.MaxLatitude)/2*math.Pi/180), 0.01)
+
+	columns := append(append([]string(nil), trajectorySummaryColumns...), "points")
+	dbQuery := s.DB.Select(columns).
+		Where("user_id = ? AND id <> ?", userID, excludeID)
+	if query.Measure == algorithms.SimilarityLCSS {
+		dbQuery = dbQuery.Where("geom && ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+			bounds.MinLongitude-dLng, bounds.MinLatitude-dLat, bounds.MaxLongitude+dLng, bounds.MaxLatitude+dLat)
+	} else {
+		dbQuery = dbQuery.
+			Where("geom @ ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+				bounds.MinLongitude-dLng, bounds.MinLatitude-dLat, bounds.MaxLongitude+dLng, bounds.MaxLatitude+dLat).
+			Where("ST_Expand(ST_Envelope(geom), ?, ?) ~ ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+				dLng, dLat, bounds.MinLongitude, bounds.MinLatitude, bounds.MaxLongitude, bounds.MaxLatitude)
+	}
+
+	var candidates []models.Trajectory
+	dbQuery = dbQuery.Order(clause.OrderBy{Expression: clause.Expr{
+		SQL:  "ST_HausdorffDistance(ST_Envelope(geom), ST_MakeEnvelope(?, ?, ?, ?, 4326)), id",
+		Vars: []any{bounds.MinLongitude, bounds.MinLatitude, bounds.MaxLongitude, bounds.MaxLatitude},
+	}})
+	if err := dbQuery.Limit(MaxSimilarityCandidates).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	reference := algorithms.Downsample(points, similarityMaxPoints)
+	results := make([]SimilarTrajectory, 0, len(candidates))
+	for _, candidate := range candidates {
+		var candidatePoints []models.GPSPoint
+		if err := json.Unmarshal([]byte(candidate.Points), &candidatePoints); err != nil {
+			return nil, err
+		}
+		if len(candidatePoints) == 0 {
+			continue
+		}
+
+		distance, err := algorithms.TrajectoryDistance(
+			reference, algorithms.Downsample(candidatePoints, similarityMaxPoints), query.Measure, query.LCSS,
+		)
+		if err != nil {
+			return nil, err
+		}
+		// No point of the trajectory matched, so it is not similar at all
+		if query.Measure == algorithms.SimilarityLCSS && distance >= 1 {
+			continue
+		}
+
+		results = append(results, SimilarTrajectory{
+			TrajectoryID: candidate.ID,
+			Name:         candidate.Name,
+			StartTime:    candidate.StartTime,
+			EndTime:      candidate.EndTime,
+			Stats:        candidate.Stats,
+			Distance:     distance,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+	if query.K > 0 && len(results) > query.K {
+		results = results[:query.K]
+	}
+	return results, nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/th1enq/go-map/internal/algorithms"
+	"github.com/th1enq/go-map/internal/models"
+	"gorm.io/gorm"
+)
+
+// Trip is a trajectory produced by trip segmentation with the stays it starts and ends at
+type Trip struct {
+	Trajectory  models.Trajectory `json:"trajectory"`
+	PointCount  int               `json:"point_count"`
+	StartReason string            `json:"start_reason"`
+	EndReason   string            `json:"end_reason"`
+	StartStay   *models.StayPoint `json:"start_stay,omitempty"`
+	EndStay     *models.StayPoint `json:"end_stay,omitempty"`
+}
+
+// ErrNoTrips is returned when segmentation leaves no trip long enough to keep
+var ErrNoTrips = errors.New("no trips found in trajectory")
+
+// ErrAlreadySplit is returned when a trajectory has already been split into trips
+var ErrAlreadySplit = errors.New("trajectory has already been split")
+
+// SplitTrajectory splits a stored trajectory into one trajectory per trip. The trips are
+// stored as children of the trajectory, which is kept, and its stay points move to the
+// trips. The stored stay points are used as trip boundaries; when there are none they are
+// detected and stored. With dryRun the trips are computed but nothing is written. A
+// trajectory holding a single trip is left unchanged apart from its detected stay points.
+func (s *TrajectoryServices) SplitTrajectory(trajectory *models.Trajectory, params algorithms.TripParams, dryRun bool) ([]Trip, error) {
+	if trajectory.IsOpen {
+		return nil, errors.New("cannot split an open tracking session")
+	}
+
+	var children int64
+	if err := s.DB.Model(&models.Trajectory{}).Where("parent_id = ?", trajectory.ID).Count(&children).Error; err != nil {
+		return nil, err
+	}
+	if children > 0 {
+		return nil, ErrAlreadySplit
+	}
+
+	var points []models.GPSPoint
+	if err := json.Unmarshal([]byte(trajectory.Points), &points); err != nil {
+		return nil, err
+	}
+
+	var stayPoints []models.StayPoint
+	if err := s.DB.Where("trajectory_id = ?", trajectory.ID).Order("arrival_time ASC").Find(&stayPoints).Error; err != nil {
+		return nil, err
+	}
+	if len(stayPoints) == 0 {
+		params, err := stayPointParams(s.DB.DB, trajectory.UserID)
+		if err != nil {
+			return nil, err
+		}
+		stayPoints = algorithms.DetectStayPoints(*trajectory, params)
+	}
+
+	trips, tripStays, err := buildTrips(*trajectory, points, stayPoints, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(trips) == 0 {
+		return nil, ErrNoTrips
+	}
+	if dryRun {
+		return trips, nil
+	}
+	if len(trips) == 1 {
+		trips[0].Trajectory = *trajectory
+		trips[0].PointCount = len(points)
+
+		// Stay points detected above are stored with the unchanged trajectory
+		for _, sp := range tripStays[0] {
+			if sp.ID != 0 {
+				continue
+			}
+			sp.TrajectoryID = trajectory.ID
+			if err := s.DB.Create(sp).Error; err != nil {
+				return nil, err
+			}
+		}
+		return trips, nil
+	}
+
+	var labels []models.TrajectorySegment
+	if err := s.DB.Where("trajectory_id = ? AND source = ?", trajectory.ID, models.SourceLabel).
+		Find(&labels).Error; err != nil {
+		return nil, err
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range trips {
+			trips[i].Trajectory.ParentID = &trajectory.ID
+
+			// The trigger builds geom from the points
+			if err := tx.Create(&trips[i].Trajectory).Error; err != nil {
+				return err
+			}
+
+			for _, sp := range tripStays[i] {
+				sp.TrajectoryID = trips[i].Trajectory.ID
+				if sp.ID == 0 {
+					if err := tx.Create(sp).Error; err != nil {
+						return err
+					}
+					continue
+				}
+				if err := tx.Model(sp).UpdateColumn("trajectory_id", sp.TrajectoryID).Error; err != nil {
+					return err
+				}
+			}
+
+			// Ground-truth labels are copied to the trips, clipped; inferred modes are reclassified later
+			if tripLabels := clipSegments(labels, trips[i].Trajectory); len(tripLabels) > 0 {
+				if err := tx.Create(&tripLabels).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return trips, nil
+}
+
+// splitImportTrajectory splits an unsaved trajectory into trips before it is stored. It
+// returns the trajectory unchanged when it holds at most one trip.
+func splitImportTrajectory(trajectory models.Trajectory, points []models.GPSPoint, stayPoints []models.StayPoint, params algorithms.TripParams) ([]models.Trajectory, [][]models.StayPoint, error) {
+	trips, tripStays, err := buildTrips(trajectory, points, stayPoints, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(trips) <= 1 {
+		return []models.Trajectory{trajectory}, [][]models.StayPoint{stayPoints}, nil
+	}
+
+	trajectories := make([]models.Trajectory, len(trips))
+	stays := make([][]models.StayPoint, len(trips))
+	for i, trip := range trips {
+		trajectories[i] = trip.Trajectory
+		for _, sp := range tripStays[i] {
+			stays[i] = append(stays[i], *sp)
+		}
+	}
+	return trajectories, stays, nil
+}
+
+// buildTrips segments points into unsaved trip trajectories. Every stay point is assigned
+// to exactly one trip: the one arriving at it, else the one departing from it, else the
+// last trip before it.
+func buildTrips(base models.Trajectory, points []models.GPSPoint, stayPoints []models.StayPoint, params algorithms.TripParams) ([]Trip, [][]*models.StayPoint, error) {
+	segments := algorithms.SegmentTrips(points, stayPoints, params)
+	if len(segments) == 0 {
+		return nil, nil, nil
+	}
+
+	trips := make([]Trip, len(segments))
+	owner := make([]int, len(stayPoints))
+	for i := range owner {
+		owner[i] = -1
+	}
+
+	for i, segment := range segments {
+		tripPoints := points[segment.StartIndex : segment.EndIndex+1]
+		pointsJSON, err := json.Marshal(tripPoints)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := base.Name
+		if name != "" {
+			name = fmt.Sprintf("%s (%d/%d)", base.Name, i+1, len(segments))
+		}
+
+		trips[i] = Trip{
+			Trajectory: models.Trajectory{
+				UserID:    base.UserID,
+				Name:      name,
+				Points:    pointsJSON,
+				StartTime: segment.StartTime,
+				EndTime:   segment.EndTime,
+				DeviceID:  base.DeviceID,
+				Stats:     algorithms.TrajectoryStatistics(tripPoints),
+			},
+			PointCount:  len(tripPoints),
+			StartReason: segment.StartReason,
+			EndReason:   segment.EndReason,
+		}
+		if segment.StartStay >= 0 {
+			trips[i].StartStay = &stayPoints[segment.StartStay]
+		}
+		if segment.EndStay >= 0 {
+			trips[i].EndStay = &stayPoints[segment.EndStay]
+			owner[segment.EndStay] = i
+		}
+	}
+
+	for i, segment := range segments {
+		if segment.StartStay >= 0 && owner[segment.StartStay] < 0 {
+			owner[segment.StartStay] = i
+		}
+	}
+
+	tripStays := make([][]*models.StayPoint, len(trips))
+	for k := range stayPoints {
+		i := owner[k]
+		if i < 0 {
+			i = 0
+			for j, segment := range segments {
+				if segment.EndTime.Before(stayPoints[k].ArrivalTime) {
+					i = j
+				}
+			}
+		}
+		tripStays[i] = append(tripStays[i], &stayPoints[k])
+	}
+
+	return trips, tripStays, nil
+}
+
+// clipSegments returns copies of the segments overlapping a trajectory, clipped to its time range
+func clipSegments(segments []models.TrajectorySegment, trajectory models.Trajectory) []models.TrajectorySegment {
+	var clipped []models.TrajectorySegment
+	for _, segment := range segments {
+		if segment.EndTime.Before(trajectory.StartTime) || segment.StartTime.After(trajectory.EndTime) {
+			continue
+		}
+
+		start, end := segment.StartTime, segment.EndTime
+		if trajectory.StartTime.After(start) {
+			start = trajectory.StartTime
+		}
+		if trajectory.EndTime.Before(end) {
+			end = trajectory.EndTime
+		}
+
+		clipped = append(clipped, models.TrajectorySegment{
+			TrajectoryID: trajectory.ID,
+			UserID:       segment.UserID,
+			Mode:         segment.Mode,
+			Source:       segment.Source,
+			StartTime:    start,
+			EndTime:      end,
+		})
+	}
+	return clipped
+}
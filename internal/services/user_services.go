@@ -77,17 +77,6 @@ func (r *UserServices) FindOrCreateByFolder(folder string) (*models.User, error)
 		return nil, err
 	}
 
-	// Kiểm tra xem user đã có dữ liệu chưa
-	var trajectoryCount int64
-	if err := r.DB.Model(&models.Trajectory{}).Where("user_id = ?", user.ID).Count(&trajectoryCount).Error; err != nil {
-		return nil, err
-	}
-
-	// Nếu user đã có dữ liệu, trả về lỗi
-	if trajectoryCount > 0 {
-		return &user, errors.New("user data already imported")
-	}
-
 	return &user, nil
 }
 
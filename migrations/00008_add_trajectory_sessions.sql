@@ -0,0 +1,9 @@
+-- +goose Up
+-- Open trajectories are live tracking sessions that still accept appended points
+ALTER TABLE trajectories ADD COLUMN is_open BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_trajectories_is_open ON trajectories(user_id) WHERE is_open;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trajectories_is_open;
+ALTER TABLE trajectories DROP COLUMN IF EXISTS is_open;
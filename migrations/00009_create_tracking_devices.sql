@@ -0,0 +1,23 @@
+-- +goose Up
+-- Create tracking_devices table to map location-reporting apps (e.g. OwnTracks) to users
+CREATE TABLE tracking_devices (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT UNIQUE, -- SHA-256 of the personal token, NULL for devices authenticated by account credentials
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- Trajectories recorded by a device are rolled over daily
+ALTER TABLE trajectories ADD COLUMN device_id INTEGER REFERENCES tracking_devices(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_tracking_devices_user_id ON tracking_devices(user_id);
+CREATE INDEX idx_trajectories_device_id ON trajectories(device_id, start_time);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trajectories_device_id;
+ALTER TABLE trajectories DROP COLUMN IF EXISTS device_id;
+DROP TABLE IF EXISTS tracking_devices;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Stay points imported from external sources (e.g. Google Takeout place visits)
+-- are not always covered by a stored trajectory
+ALTER TABLE stay_points ALTER COLUMN trajectory_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM stay_points WHERE trajectory_id IS NULL;
+ALTER TABLE stay_points ALTER COLUMN trajectory_id SET NOT NULL;
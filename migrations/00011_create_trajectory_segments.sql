@@ -0,0 +1,21 @@
+-- +goose Up
+-- Create trajectory_segments table to store transportation modes for parts of a trajectory
+CREATE TABLE trajectory_segments (
+    id SERIAL PRIMARY KEY,
+    trajectory_id INTEGER NOT NULL REFERENCES trajectories(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mode TEXT NOT NULL, -- Possible values: 'walk', 'bike', 'bus', 'car', 'taxi', 'subway', 'train', 'airplane', 'boat', 'run', 'motorcycle'
+    source TEXT NOT NULL DEFAULT 'label', -- 'label' for GeoLife ground truth
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for improved query performance
+CREATE INDEX idx_trajectory_segments_trajectory_id ON trajectory_segments(trajectory_id);
+CREATE INDEX idx_trajectory_segments_user_id ON trajectory_segments(user_id);
+CREATE INDEX idx_trajectory_segments_mode ON trajectory_segments(mode);
+
+-- +goose Down
+DROP TABLE IF EXISTS trajectory_segments;
@@ -0,0 +1,19 @@
+-- +goose Up
+-- Create import_records table to track dataset files so interrupted loads resume per file
+CREATE TABLE import_records (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source_path TEXT NOT NULL UNIQUE, -- Path of the file relative to the dataset root
+    status TEXT NOT NULL, -- Possible values: 'completed', 'failed'
+    trajectory_id INTEGER REFERENCES trajectories(id) ON DELETE SET NULL,
+    point_count INTEGER NOT NULL DEFAULT 0,
+    stay_point_count INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_import_records_user_id ON import_records(user_id, status);
+
+-- +goose Down
+DROP TABLE IF EXISTS import_records;
@@ -0,0 +1,47 @@
+-- +goose Up
+-- Store each trajectory as a LineStringZM (X = longitude, Y = latitude, Z = altitude,
+-- M = Unix epoch seconds) so spatial and spatio-temporal queries can run in the database
+ALTER TABLE trajectories ADD COLUMN geom geometry(LineStringZM, 4326);
+
+-- Build the geometry from the JSONB points, ordered by time; NULL for fewer than two points
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION trajectory_geometry(points JSONB) RETURNS geometry(LineStringZM, 4326) AS $$
+    SELECT CASE WHEN count(*) >= 2 THEN
+        ST_SetSRID(ST_MakeLine(
+            ST_MakePoint(
+                (p->>'longitude')::DOUBLE PRECISION,
+                (p->>'latitude')::DOUBLE PRECISION,
+                COALESCE((p->>'altitude')::DOUBLE PRECISION, 0),
+                EXTRACT(EPOCH FROM (p->>'timestamp')::TIMESTAMPTZ)::DOUBLE PRECISION
+            ) ORDER BY (p->>'timestamp')::TIMESTAMPTZ, ord
+        ), 4326)::geometry(LineStringZM, 4326)
+    END
+    FROM jsonb_array_elements(points) WITH ORDINALITY AS e(p, ord)
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- Keep geom in sync with points for every write path (INSERT, UPDATE and COPY)
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION trajectories_sync_geom() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.geom := trajectory_geometry(NEW.points);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Backfill existing trajectories
+UPDATE trajectories SET geom = trajectory_geometry(points);
+
+CREATE TRIGGER trajectories_sync_geom
+    BEFORE INSERT OR UPDATE OF points ON trajectories
+    FOR EACH ROW EXECUTE FUNCTION trajectories_sync_geom();
+
+CREATE INDEX idx_trajectories_geom ON trajectories USING GIST (geom);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trajectories_geom;
+DROP TRIGGER IF EXISTS trajectories_sync_geom ON trajectories;
+DROP FUNCTION IF EXISTS trajectories_sync_geom();
+DROP FUNCTION IF EXISTS trajectory_geometry(JSONB);
+ALTER TABLE trajectories DROP COLUMN IF EXISTS geom;
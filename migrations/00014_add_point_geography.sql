@@ -0,0 +1,30 @@
+-- +goose Up
+-- Geography points derived from latitude/longitude so radius queries measure metres
+-- and can use a GiST index. Being generated, they never drift from the coordinates.
+ALTER TABLE stay_points
+    ADD COLUMN geom geography(Point, 4326)
+    GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED;
+CREATE INDEX idx_stay_points_geom ON stay_points USING GIST (geom);
+
+ALTER TABLE locations
+    ADD COLUMN geom geography(Point, 4326)
+    GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)::geography) STORED;
+CREATE INDEX idx_locations_geom ON locations USING GIST (geom);
+
+-- Activities (tags) offered at a location, e.g. 'coffee' or 'hiking'
+CREATE TABLE location_activities (
+    id SERIAL PRIMARY KEY,
+    location_id INTEGER NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    activity TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    UNIQUE (location_id, activity)
+);
+
+CREATE INDEX idx_location_activities_activity ON location_activities(activity);
+
+-- +goose Down
+DROP TABLE IF EXISTS location_activities;
+DROP INDEX IF EXISTS idx_locations_geom;
+ALTER TABLE locations DROP COLUMN IF EXISTS geom;
+DROP INDEX IF EXISTS idx_stay_points_geom;
+ALTER TABLE stay_points DROP COLUMN IF EXISTS geom;
@@ -0,0 +1,39 @@
+-- +goose Up
+-- Optional simplified copy of the points for display; the raw points stay untouched
+ALTER TABLE trajectories
+    ADD COLUMN simplified_points JSONB,
+    ADD COLUMN simplify_method TEXT NOT NULL DEFAULT '',
+    ADD COLUMN simplify_tolerance DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- A simplified copy no longer matches once the raw points change, so drop it unless
+-- the same statement stores a new one
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION trajectories_sync_geom() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.geom := trajectory_geometry(NEW.points);
+    IF TG_OP = 'UPDATE'
+        AND NEW.points IS DISTINCT FROM OLD.points
+        AND NEW.simplified_points IS NOT DISTINCT FROM OLD.simplified_points THEN
+        NEW.simplified_points := NULL;
+        NEW.simplify_method := '';
+        NEW.simplify_tolerance := 0;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION trajectories_sync_geom() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.geom := trajectory_geometry(NEW.points);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE trajectories
+    DROP COLUMN IF EXISTS simplified_points,
+    DROP COLUMN IF EXISTS simplify_method,
+    DROP COLUMN IF EXISTS simplify_tolerance;
@@ -0,0 +1,33 @@
+-- +goose Up
+-- Summary statistics of the points, computed by the application whenever they are written.
+-- Existing trajectories keep zero stats until `go run ./cmd/recompute_stats` is run.
+ALTER TABLE trajectories
+    ADD COLUMN stat_point_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN stat_length DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_moving_time DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_stopped_time DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_avg_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_avg_moving_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_max_speed DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_elevation_gain DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_elevation_loss DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_min_latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_min_longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_max_latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN stat_max_longitude DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE trajectories
+    DROP COLUMN IF EXISTS stat_point_count,
+    DROP COLUMN IF EXISTS stat_length,
+    DROP COLUMN IF EXISTS stat_moving_time,
+    DROP COLUMN IF EXISTS stat_stopped_time,
+    DROP COLUMN IF EXISTS stat_avg_speed,
+    DROP COLUMN IF EXISTS stat_avg_moving_speed,
+    DROP COLUMN IF EXISTS stat_max_speed,
+    DROP COLUMN IF EXISTS stat_elevation_gain,
+    DROP COLUMN IF EXISTS stat_elevation_loss,
+    DROP COLUMN IF EXISTS stat_min_latitude,
+    DROP COLUMN IF EXISTS stat_min_longitude,
+    DROP COLUMN IF EXISTS stat_max_latitude,
+    DROP COLUMN IF EXISTS stat_max_longitude;
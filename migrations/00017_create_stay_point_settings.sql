@@ -0,0 +1,19 @@
+-- +goose Up
+-- Stay point detection thresholds: the row without a user applies to everybody, user rows
+-- override it. Without any row the built-in defaults (200 m, 30 min) apply.
+CREATE TABLE stay_point_settings (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    distance_threshold DOUBLE PRECISION NOT NULL, -- Meters
+    time_threshold INTEGER NOT NULL, -- Seconds
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (distance_threshold > 0 AND time_threshold > 0)
+);
+
+-- One row per user and a single global row
+CREATE UNIQUE INDEX idx_stay_point_settings_user_id ON stay_point_settings(user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX idx_stay_point_settings_global ON stay_point_settings((user_id IS NULL)) WHERE user_id IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS stay_point_settings;
@@ -0,0 +1,6 @@
+-- +goose Up
+-- Name of the stay point detector applying the thresholds: sequential, st-dbscan or cb-smot
+ALTER TABLE stay_point_settings ADD COLUMN algorithm VARCHAR(20) NOT NULL DEFAULT 'sequential';
+
+-- +goose Down
+ALTER TABLE stay_point_settings DROP COLUMN IF EXISTS algorithm;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Cluster of the next layer up that contains the cluster, NULL in the top layer
+ALTER TABLE clusters ADD COLUMN parent_id INTEGER REFERENCES clusters(id) ON DELETE SET NULL;
+CREATE INDEX idx_clusters_parent_id ON clusters(parent_id);
+
+-- Stay points of each cluster. A stay point belongs to at most one cluster per layer.
+CREATE TABLE cluster_stay_points (
+    cluster_id INTEGER NOT NULL REFERENCES clusters(id) ON DELETE CASCADE,
+    stay_point_id INTEGER NOT NULL REFERENCES stay_points(id) ON DELETE CASCADE,
+    layer_id INTEGER NOT NULL REFERENCES layers(id) ON DELETE CASCADE,
+    PRIMARY KEY (cluster_id, stay_point_id),
+    UNIQUE (stay_point_id, layer_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS cluster_stay_points;
+DROP INDEX IF EXISTS idx_clusters_parent_id;
+ALTER TABLE clusters DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,27 @@
+-- +goose Up
+-- Stay points of each cluster, compared with cluster_stay_points to notice deleted ones
+ALTER TABLE clusters ADD COLUMN stay_point_count INTEGER NOT NULL DEFAULT 0;
+UPDATE clusters SET stay_point_count = (
+    SELECT COUNT(*) FROM cluster_stay_points WHERE cluster_stay_points.cluster_id = clusters.id
+);
+
+-- Clusters created, merged, split and removed by incremental framework updates. Cluster
+-- IDs have no foreign key, so the changes of deleted clusters are kept.
+CREATE TABLE cluster_changes (
+    id SERIAL PRIMARY KEY,
+    framework_id INTEGER NOT NULL REFERENCES hierarchical_frameworks(id) ON DELETE CASCADE,
+    layer_id INTEGER NOT NULL REFERENCES layers(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL, -- created, merged, split or removed
+    cluster_id INTEGER NOT NULL,
+    source_cluster_id INTEGER,
+    stay_points INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_cluster_changes_framework_id ON cluster_changes(framework_id, created_at);
+CREATE INDEX idx_cluster_stay_points_layer_id ON cluster_stay_points(layer_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_cluster_stay_points_layer_id;
+DROP TABLE IF EXISTS cluster_changes;
+ALTER TABLE clusters DROP COLUMN IF EXISTS stay_point_count;
@@ -0,0 +1,42 @@
+-- +goose Up
+-- Build parameters of each framework. Those of existing frameworks are unknown, which an
+-- empty algorithm marks.
+ALTER TABLE hierarchical_frameworks
+    ADD COLUMN version INTEGER,
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN algorithm VARCHAR(10) NOT NULL DEFAULT '',
+    ADD COLUMN epsilon DOUBLE PRECISION NOT NULL DEFAULT 0, -- km
+    ADD COLUMN min_points INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN max_layers INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN layer_scales JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN min_cluster_size INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN max_link_distance DOUBLE PRECISION NOT NULL DEFAULT 0, -- km
+    ADD COLUMN stay_point_count INTEGER NOT NULL DEFAULT 0;
+
+-- Existing frameworks are numbered in build order and the latest, which was in use, is active
+UPDATE hierarchical_frameworks SET version = numbered.version
+FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY id) AS version FROM hierarchical_frameworks) AS numbered
+WHERE numbered.id = hierarchical_frameworks.id;
+UPDATE hierarchical_frameworks SET active = TRUE
+WHERE id = (SELECT MAX(id) FROM hierarchical_frameworks);
+
+ALTER TABLE hierarchical_frameworks ALTER COLUMN version SET NOT NULL;
+CREATE UNIQUE INDEX idx_hierarchical_frameworks_version ON hierarchical_frameworks(version);
+
+-- A single active framework
+CREATE UNIQUE INDEX idx_hierarchical_frameworks_active ON hierarchical_frameworks(active) WHERE active;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_hierarchical_frameworks_active;
+DROP INDEX IF EXISTS idx_hierarchical_frameworks_version;
+ALTER TABLE hierarchical_frameworks
+    DROP COLUMN IF EXISTS stay_point_count,
+    DROP COLUMN IF EXISTS max_link_distance,
+    DROP COLUMN IF EXISTS min_cluster_size,
+    DROP COLUMN IF EXISTS layer_scales,
+    DROP COLUMN IF EXISTS max_layers,
+    DROP COLUMN IF EXISTS min_points,
+    DROP COLUMN IF EXISTS epsilon,
+    DROP COLUMN IF EXISTS algorithm,
+    DROP COLUMN IF EXISTS active,
+    DROP COLUMN IF EXISTS version;
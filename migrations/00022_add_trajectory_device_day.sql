@@ -0,0 +1,16 @@
+-- +goose Up
+-- UTC day of the rolling daily trajectory of a device, so that concurrent OwnTracks posts
+-- cannot create two trajectories for the same day. Of existing duplicates only the latest
+-- keeps its day.
+ALTER TABLE trajectories ADD COLUMN device_day DATE;
+UPDATE trajectories t SET device_day = t.start_time::date
+WHERE t.device_id IS NOT NULL AND NOT EXISTS (
+    SELECT 1 FROM trajectories o
+    WHERE o.device_id = t.device_id AND o.start_time::date = t.start_time::date AND o.id > t.id
+);
+
+CREATE UNIQUE INDEX idx_trajectories_device_day ON trajectories(device_id, device_day);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trajectories_device_day;
+ALTER TABLE trajectories DROP COLUMN IF EXISTS device_day;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Trips split from a trajectory point to it; the original trajectory is kept
+ALTER TABLE trajectories ADD COLUMN parent_id INTEGER REFERENCES trajectories(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_trajectories_parent_id ON trajectories(parent_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_trajectories_parent_id;
+ALTER TABLE trajectories DROP COLUMN IF EXISTS parent_id;